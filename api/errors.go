@@ -0,0 +1,117 @@
+package api
+
+// Стабильные машиночитаемые коды ошибок, на них могут опираться клиенты
+type ErrorCode string
+
+const (
+	ErrNotFound             ErrorCode = "NOT_FOUND"
+	ErrInvalidID            ErrorCode = "INVALID_ID"
+	ErrInvalidJSON          ErrorCode = "INVALID_JSON"
+	ErrInvalidRequest       ErrorCode = "INVALID_REQUEST"
+	ErrMethodNotAllowed     ErrorCode = "METHOD_NOT_ALLOWED"
+	ErrUnsupportedMediaType ErrorCode = "UNSUPPORTED_MEDIA_TYPE"
+	ErrLocked               ErrorCode = "LOCKED"
+	ErrConflict             ErrorCode = "CONFLICT"
+	ErrForbidden            ErrorCode = "FORBIDDEN"
+	ErrIO                   ErrorCode = "IO_ERROR"
+	ErrUnavailable          ErrorCode = "UNAVAILABLE"
+	ErrUpstream             ErrorCode = "UPSTREAM_ERROR"
+	ErrInternal             ErrorCode = "INTERNAL"
+)
+
+type APIError struct {
+	Code    ErrorCode              `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+type ErrorEnvelope struct {
+	Error APIError `json:"error"`
+}
+
+// Result реализуют все структуры ответов: Failure возвращает nil, если операция успешна
+type Result interface {
+	Failure() *APIError
+}
+
+func NewFailure(failed bool, code ErrorCode, message string) *APIError {
+	if !failed {
+		return nil
+	}
+	if code == "" {
+		code = ErrInternal
+	}
+	return &APIError{Code: code, Message: message}
+}
+
+func (r CheckResponse) Failure() *APIError {
+	return NewFailure(r.Error != "", r.ErrorCode, r.Error)
+}
+
+func (r FileContentResponse) Failure() *APIError {
+	return NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+func (r TransferResponse) Failure() *APIError {
+	return NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+func (r EmptySlotResponse) Failure() *APIError {
+	return NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+func (r RestoreSlotResponse) Failure() *APIError {
+	return NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+func (r WriteSlotResponse) Failure() *APIError {
+	return NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+func (r FileContentByPathResponse) Failure() *APIError {
+	return NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+func (r WriteFileResponse) Failure() *APIError {
+	return NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+func (r FileInfoResponse) Failure() *APIError {
+	return NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+func (r DeleteFileResponse) Failure() *APIError {
+	return NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+func (r SlotListResponse) Failure() *APIError {
+	return NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+func (r JobResponse) Failure() *APIError {
+	return NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+func (r JobListResponse) Failure() *APIError {
+	return NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+func (r PlayerListResponse) Failure() *APIError {
+	return NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+func (r ServerListResponse) Failure() *APIError {
+	return NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+func (r BackupListResponse) Failure() *APIError {
+	return NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+func (r BackupRestoreResponse) Failure() *APIError {
+	return NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+func (r MigrateResponse) Failure() *APIError {
+	return NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
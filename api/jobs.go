@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditActor struct {
+	Caller     string `json:"caller"`
+	APIKey     string `json:"api_key,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
+}
+
+type JobProgress struct {
+	Done    int    `json:"done"`
+	Total   int    `json:"total"`
+	Message string `json:"message,omitempty"`
+}
+
+type Job struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Status     string          `json:"status"`
+	Params     json.RawMessage `json:"params,omitempty"`
+	Server     string          `json:"server,omitempty"`
+	CreatedBy  *AuditActor     `json:"created_by,omitempty"`
+	Progress   JobProgress     `json:"progress"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+type JobSubmitRequest struct {
+	Type   string          `json:"type"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Server string          `json:"server,omitempty"`
+}
+
+type JobResponse struct {
+	Success   bool      `json:"success"`
+	Job       *Job      `json:"job,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	ErrorCode ErrorCode `json:"error_code,omitempty"`
+}
+
+type JobListResponse struct {
+	Success   bool      `json:"success"`
+	Jobs      []Job     `json:"jobs"`
+	Error     string    `json:"error,omitempty"`
+	ErrorCode ErrorCode `json:"error_code,omitempty"`
+}
+
+type SnapshotRequest struct {
+	Label string `json:"label,omitempty"`
+}
+
+type SnapshotResult struct {
+	Path    string `json:"path"`
+	Players int    `json:"players"`
+	Slots   int    `json:"slots"`
+	Bytes   int64  `json:"bytes"`
+}
@@ -0,0 +1,237 @@
+// Package api содержит структуры запросов и ответов агента, общие для сервера и клиента.
+package api
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type CheckRequest struct {
+	SteamID   string `json:"steamid"`
+	OldSlotID string `json:"old_slot_id,omitempty"`
+	SlotID    string `json:"slot_id,omitempty"`
+	Force     bool   `json:"force,omitempty"`
+	Server    string `json:"server,omitempty"`
+}
+
+type CheckResponse struct {
+	Exists    bool      `json:"exists"`
+	FilePath  string    `json:"file_path"`
+	Error     string    `json:"error,omitempty"`
+	ErrorCode ErrorCode `json:"error_code,omitempty"`
+}
+
+type FileContentResponse struct {
+	Success   bool            `json:"success"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	ErrorCode ErrorCode       `json:"error_code,omitempty"`
+}
+
+type TransferResponse struct {
+	Success    bool      `json:"success"`
+	Message    string    `json:"message"`
+	PlayerFile string    `json:"player_file"`
+	SlotFile   string    `json:"slot_file"`
+	Error      string    `json:"error,omitempty"`
+	ErrorCode  ErrorCode `json:"error_code,omitempty"`
+}
+
+type EmptySlotResponse struct {
+	Success   bool      `json:"success"`
+	Message   string    `json:"message"`
+	SlotFile  string    `json:"slot_file"`
+	Error     string    `json:"error,omitempty"`
+	ErrorCode ErrorCode `json:"error_code,omitempty"`
+}
+
+type RestoreSlotResponse struct {
+	Success    bool      `json:"success"`
+	Message    string    `json:"message"`
+	PlayerFile string    `json:"player_file"`
+	SlotFile   string    `json:"slot_file"`
+	Error      string    `json:"error,omitempty"`
+	ErrorCode  ErrorCode `json:"error_code,omitempty"`
+}
+
+type WriteSlotRequest struct {
+	SteamID  string          `json:"steamid"`
+	FileName string          `json:"file_name"`
+	Data     json.RawMessage `json:"data"`
+	Force    bool            `json:"force,omitempty"`
+	Server   string          `json:"server,omitempty"`
+}
+
+type WriteSlotResponse struct {
+	Success   bool      `json:"success"`
+	Message   string    `json:"message"`
+	FilePath  string    `json:"file_path,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	ErrorCode ErrorCode `json:"error_code,omitempty"`
+}
+
+type FilePathRequest struct {
+	FilePath string `json:"file_path"`
+}
+
+type DeleteFileRequest struct {
+	FilePath string `json:"file_path"`
+	Backup   *bool  `json:"backup,omitempty"`
+	Force    bool   `json:"force,omitempty"`
+}
+
+type FileContentByPathResponse struct {
+	Success   bool      `json:"success"`
+	Content   string    `json:"content,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	ErrorCode ErrorCode `json:"error_code,omitempty"`
+	Size      int64     `json:"size,omitempty"`
+}
+
+type WriteFileRequest struct {
+	FilePath string          `json:"file_path"`
+	Data     json.RawMessage `json:"data"`
+	Force    bool            `json:"force,omitempty"`
+}
+
+type WriteFileResponse struct {
+	Success   bool      `json:"success"`
+	Message   string    `json:"message"`
+	FilePath  string    `json:"file_path,omitempty"`
+	Size      int64     `json:"size,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	ErrorCode ErrorCode `json:"error_code,omitempty"`
+}
+
+type FileInfoResponse struct {
+	Success              bool      `json:"success"`
+	FilePath             string    `json:"file_path,omitempty"`
+	Exists               bool      `json:"exists"`
+	IsDirectory          bool      `json:"is_directory,omitempty"`
+	Size                 int64     `json:"size,omitempty"`
+	ModTime              time.Time `json:"mod_time,omitempty"`
+	ModTimeUnix          int64     `json:"mod_time_unix,omitempty"`
+	ModTimeFormatted     string    `json:"mod_time_formatted,omitempty"`
+	CreatedTime          time.Time `json:"created_time,omitempty"`
+	CreatedTimeUnix      int64     `json:"created_time_unix,omitempty"`
+	CreatedTimeFormatted string    `json:"created_time_formatted,omitempty"`
+	Error                string    `json:"error,omitempty"`
+	ErrorCode            ErrorCode `json:"error_code,omitempty"`
+}
+
+type DeleteFileResponse struct {
+	Success    bool      `json:"success"`
+	Message    string    `json:"message"`
+	FilePath   string    `json:"file_path,omitempty"`
+	Deleted    bool      `json:"deleted"`
+	BackupPath string    `json:"backup_path,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	ErrorCode  ErrorCode `json:"error_code,omitempty"`
+}
+
+type SlotInfo struct {
+	SlotID  string    `json:"slot_id"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+type SlotListResponse struct {
+	Success   bool       `json:"success"`
+	SteamID   string     `json:"steamid"`
+	Slots     []SlotInfo `json:"slots"`
+	Error     string     `json:"error,omitempty"`
+	ErrorCode ErrorCode  `json:"error_code,omitempty"`
+}
+
+type PlayerInfo struct {
+	SteamID string    `json:"steamid"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+type PlayerListResponse struct {
+	Success   bool         `json:"success"`
+	Players   []PlayerInfo `json:"players"`
+	Error     string       `json:"error,omitempty"`
+	ErrorCode ErrorCode    `json:"error_code,omitempty"`
+}
+
+type BackupInfo struct {
+	Name    string    `json:"name"`
+	Server  string    `json:"server"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+type BackupListResponse struct {
+	Success   bool         `json:"success"`
+	Backups   []BackupInfo `json:"backups"`
+	Error     string       `json:"error,omitempty"`
+	ErrorCode ErrorCode    `json:"error_code,omitempty"`
+}
+
+// Цель восстановления задаётся явно: только steamid - файл игрока, steamid и slot_id - файл слота.
+// Бэкап другого файла восстанавливается только с allow_cross_target
+type BackupRestoreRequest struct {
+	SteamID          string `json:"steamid"`
+	SlotID           string `json:"slot_id,omitempty"`
+	Force            bool   `json:"force,omitempty"`
+	AllowCrossTarget bool   `json:"allow_cross_target,omitempty"`
+}
+
+type BackupRestoreResponse struct {
+	Success   bool      `json:"success"`
+	Message   string    `json:"message"`
+	Backup    string    `json:"backup"`
+	FilePath  string    `json:"file_path,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	ErrorCode ErrorCode `json:"error_code,omitempty"`
+}
+
+type ServerInfo struct {
+	Name       string `json:"name"`
+	PlayersDir string `json:"players_dir"`
+	SlotsDir   string `json:"slots_dir"`
+	RCON       bool   `json:"rcon"`
+	Default    bool   `json:"default,omitempty"`
+}
+
+type ServerListResponse struct {
+	Success   bool         `json:"success"`
+	Servers   []ServerInfo `json:"servers"`
+	Error     string       `json:"error,omitempty"`
+	ErrorCode ErrorCode    `json:"error_code,omitempty"`
+}
+
+// Перенос игрока между профилями: from по умолчанию - сервер, выбранный параметром server
+type MigrateRequest struct {
+	From       string `json:"from,omitempty"`
+	To         string `json:"to"`
+	Mode       string `json:"mode,omitempty"`
+	OnConflict string `json:"on_conflict,omitempty"`
+	DryRun     bool   `json:"dry_run,omitempty"`
+	Force      bool   `json:"force,omitempty"`
+}
+
+type MigratedFile struct {
+	Kind         string `json:"kind"`
+	SlotID       string `json:"slot_id,omitempty"`
+	TargetSlotID string `json:"target_slot_id,omitempty"`
+	Source       string `json:"source"`
+	Target       string `json:"target"`
+	Action       string `json:"action"`
+	BackupPath   string `json:"backup_path,omitempty"`
+}
+
+type MigrateResponse struct {
+	Success   bool           `json:"success"`
+	Message   string         `json:"message"`
+	SteamID   string         `json:"steamid"`
+	From      string         `json:"from"`
+	To        string         `json:"to"`
+	Mode      string         `json:"mode"`
+	DryRun    bool           `json:"dry_run,omitempty"`
+	Files     []MigratedFile `json:"files"`
+	Error     string         `json:"error,omitempty"`
+	ErrorCode ErrorCode      `json:"error_code,omitempty"`
+}
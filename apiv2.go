@@ -0,0 +1,491 @@
+package main
+
+import (
+	"DinoAgentApi/api"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Ресурсный API v2: игроки и их слоты адресуются путём, действие задаёт HTTP метод.
+// Ошибки отдаются в ErrorEnvelope с настоящими HTTP статусами (см. apiVersion).
+
+type (
+	SlotInfo           = api.SlotInfo
+	SlotListResponse   = api.SlotListResponse
+	PlayerInfo         = api.PlayerInfo
+	PlayerListResponse = api.PlayerListResponse
+)
+
+const maxV2BodySize = 10 * 1024 * 1024
+
+func registerV2Routes() {
+	handleRoute("GET /v2/players", v2ListPlayersHandler)
+	handleRoute("GET /v2/players/{steamid}", v2GetPlayerHandler)
+	handleRoute("PUT /v2/players/{steamid}", v2PutPlayerHandler)
+	handleRoute("PATCH /v2/players/{steamid}", v2PatchPlayerHandler)
+	handleRoute("DELETE /v2/players/{steamid}", v2DeletePlayerHandler)
+	handleRoute("GET /v2/players/{steamid}/slots", v2ListSlotsHandler)
+	handleRoute("GET /v2/players/{steamid}/slots/{slot}", v2GetSlotHandler)
+	handleRoute("PUT /v2/players/{steamid}/slots/{slot}", v2PutSlotHandler)
+	handleRoute("PATCH /v2/players/{steamid}/slots/{slot}", v2PatchSlotHandler)
+	handleRoute("DELETE /v2/players/{steamid}/slots/{slot}", v2DeleteSlotHandler)
+	handleRoute("POST /v2/players/{steamid}/slots/{slot}/transfer", v2TransferHandler)
+	handleRoute("POST /v2/players/{steamid}/slots/{slot}/restore", v2RestoreHandler)
+	handleRoute("POST /v2/players/{steamid}/slots/{slot}/empty", v2EmptySlotHandler)
+	handleRoute("POST /v2/players/{steamid}/migrate", v2MigratePlayerHandler)
+	handleRoute("GET /v2/servers", v2ListServersHandler)
+	handleRoute("GET /v2/backups", v2ListBackupsHandler)
+	handleRoute("POST /v2/backups/{name}/restore", v2RestoreBackupHandler)
+
+	// Без этих маршрутов ServeMux ответил бы на чужой метод текстовым 405
+	handleHiddenRoute("/v2/players", v2MethodNotAllowed("GET, HEAD"))
+	handleHiddenRoute("/v2/players/{steamid}", v2MethodNotAllowed("GET, HEAD, PUT, PATCH, DELETE"))
+	handleHiddenRoute("/v2/players/{steamid}/slots", v2MethodNotAllowed("GET, HEAD"))
+	handleHiddenRoute("/v2/players/{steamid}/slots/{slot}", v2MethodNotAllowed("GET, HEAD, PUT, PATCH, DELETE"))
+	handleHiddenRoute("/v2/players/{steamid}/slots/{slot}/{action}", v2MethodNotAllowed("POST"))
+	handleHiddenRoute("/v2/players/{steamid}/migrate", v2MethodNotAllowed("POST"))
+	handleHiddenRoute("/v2/servers", v2MethodNotAllowed("GET, HEAD"))
+	handleHiddenRoute("/v2/backups", v2MethodNotAllowed("GET, HEAD"))
+	handleHiddenRoute("/v2/backups/{name}/restore", v2MethodNotAllowed("POST"))
+	handleHiddenRoute("/v2/", v2NotFoundHandler)
+}
+
+// Маршруты v1 остаются на старых путях и дублируются под /v1; Link подсказывает замену в v2
+func v1Adapter(successor string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if link := v1SuccessorLink(successor, r); link != "" {
+			w.Header().Set("Link", "<"+link+`>; rel="successor-version"`)
+		}
+		handler(w, r)
+	}
+}
+
+// Подставляет идентификаторы из query; для POST с телом ссылку не строим, чтобы не читать body дважды
+func v1SuccessorLink(successor string, r *http.Request) string {
+	if successor == "" {
+		return ""
+	}
+
+	query := r.URL.Query()
+	steamid := query.Get("steamid")
+	slotID := query.Get("slot_id")
+	if slotID == "" {
+		slotID = query.Get("old_slot_id")
+	}
+	if slotID == "" {
+		slotID = strings.TrimSuffix(query.Get("file_name"), ".json")
+	}
+
+	if !validID(steamid) || (strings.Contains(successor, "{slot}") && !validID(slotID)) {
+		return ""
+	}
+	return strings.NewReplacer("{steamid}", steamid, "{slot}", slotID).Replace(successor)
+}
+
+func handleV1(pattern, successor string, handler http.HandlerFunc) {
+	adapted := v1Adapter(successor, handler)
+	handleRoute(pattern, adapted)
+	handleRoute("/v1"+pattern, adapted)
+}
+
+func v2MethodNotAllowed(allowed string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logWarn(r.Context(), "API v2: method %s not allowed for %s", r.Method, r.URL.Path)
+		w.Header().Set("Allow", allowed)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func v2NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	logWarn(r.Context(), "API v2: unknown resource %s", r.URL.Path)
+	writeError(w, r, ErrNotFound, "Unknown resource")
+}
+
+func v2PathIDs(w http.ResponseWriter, r *http.Request, name string) (string, string, bool) {
+	steamid := r.PathValue("steamid")
+	slotID := r.PathValue("slot")
+
+	ids := []string{steamid}
+	if slotID != "" {
+		ids = append(ids, slotID)
+	}
+	return steamid, slotID, checkIDs(w, r, name, ids...)
+}
+
+func v2Force(r *http.Request) bool {
+	return r.URL.Query().Get("force") == "true"
+}
+
+func readJSONBody(w http.ResponseWriter, r *http.Request, name string) (json.RawMessage, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxV2BodySize))
+	if err != nil {
+		logWarn(r.Context(), "%s handler: failed to read body: %v", name, err)
+		writeError(w, r, ErrInvalidRequest, "Failed to read request body")
+		return nil, false
+	}
+	if len(body) == 0 || !json.Valid(body) {
+		logWarn(r.Context(), "%s handler: body is not valid JSON", name)
+		writeError(w, r, ErrInvalidJSON, "Request body must be valid JSON")
+		return nil, false
+	}
+	return body, true
+}
+
+// RFC 7396: null удаляет ключ, объекты сливаются рекурсивно, остальные значения заменяются целиком
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatch(targetObject[key], value)
+	}
+	return targetObject
+}
+
+func applyMergePatch(current, patch json.RawMessage) (json.RawMessage, error) {
+	target, err := decodeDiffJSON(current)
+	if err != nil {
+		return nil, err
+	}
+	patchValue, err := decodeDiffJSON(patch)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergePatch(target, patchValue))
+}
+
+func listPlayers(ctx context.Context) ([]PlayerInfo, error) {
+	entries, err := os.ReadDir(serverFrom(ctx).PlayersDir)
+	if os.IsNotExist(err) {
+		return []PlayerInfo{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	players := []PlayerInfo{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		players = append(players, PlayerInfo{
+			SteamID: strings.TrimSuffix(entry.Name(), ".json"),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+	sort.Slice(players, func(i, j int) bool { return players[i].SteamID < players[j].SteamID })
+	return players, nil
+}
+
+func listPlayerSlots(ctx context.Context, steamid string) ([]SlotInfo, error) {
+	entries, err := os.ReadDir(playerSlotsDir(ctx, steamid))
+	if os.IsNotExist(err) {
+		return []SlotInfo{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	slots := []SlotInfo{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		slots = append(slots, SlotInfo{
+			SlotID:  strings.TrimSuffix(entry.Name(), ".json"),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].SlotID < slots[j].SlotID })
+	return slots, nil
+}
+
+func v2GetPlayerHandler(w http.ResponseWriter, r *http.Request) {
+	steamid, _, ok := v2PathIDs(w, r, "Get player")
+	if !ok {
+		return
+	}
+
+	logInfo(r.Context(), "Get player handler processing request for SteamID: %s", steamid)
+	response := getPlayerFileContent(r.Context(), steamid)
+	writeResponse(w, r, response)
+}
+
+func v2PutPlayerHandler(w http.ResponseWriter, r *http.Request) {
+	steamid, _, ok := v2PathIDs(w, r, "Put player")
+	if !ok {
+		return
+	}
+	data, ok := readJSONBody(w, r, "Put player")
+	if !ok {
+		return
+	}
+
+	logInfo(r.Context(), "Put player handler processing request for SteamID: %s", steamid)
+	if !checkPlayerPresence(w, r, steamid, v2Force(r), "Put player") {
+		return
+	}
+
+	unlock := lockPlayer(r.Context(), steamid)
+	defer unlock()
+	audit := beginAudit(r, "write-player", steamid, "", playerFilePath(r.Context(), steamid))
+	response := writeFileByPath(r.Context(), playerFilePath(r.Context(), steamid), data)
+	audit.finish(response.Success, response.Error)
+	logInfo(r.Context(), "Put player handler response: Success=%t, Error=%s", response.Success, response.Error)
+	writeResponse(w, r, response)
+}
+
+func v2PatchPlayerHandler(w http.ResponseWriter, r *http.Request) {
+	steamid, _, ok := v2PathIDs(w, r, "Patch player")
+	if !ok {
+		return
+	}
+	patch, ok := readJSONBody(w, r, "Patch player")
+	if !ok {
+		return
+	}
+
+	logInfo(r.Context(), "Patch player handler processing request for SteamID: %s", steamid)
+	if !checkPlayerPresence(w, r, steamid, v2Force(r), "Patch player") {
+		return
+	}
+
+	// Чтение и запись под одной блокировкой, чтобы не потерять параллельные изменения
+	unlock := lockPlayer(r.Context(), steamid)
+	defer unlock()
+
+	current := getPlayerFileContent(r.Context(), steamid)
+	if !current.Success {
+		writeResponse(w, r, current)
+		return
+	}
+	data, err := applyMergePatch(current.Content, patch)
+	if err != nil {
+		logWarn(r.Context(), "Patch player handler: failed to apply patch: %v", err)
+		writeError(w, r, ErrInvalidJSON, "Failed to apply patch: "+err.Error())
+		return
+	}
+
+	audit := beginAudit(r, "patch-player", steamid, "", playerFilePath(r.Context(), steamid))
+	response := writeFileByPath(r.Context(), playerFilePath(r.Context(), steamid), data)
+	audit.finish(response.Success, response.Error)
+	logInfo(r.Context(), "Patch player handler response: Success=%t, Error=%s", response.Success, response.Error)
+	writeResponse(w, r, response)
+}
+
+func v2DeletePlayerHandler(w http.ResponseWriter, r *http.Request) {
+	steamid, _, ok := v2PathIDs(w, r, "Delete player")
+	if !ok {
+		return
+	}
+
+	logInfo(r.Context(), "Delete player handler processing request for SteamID: %s", steamid)
+	if !checkPlayerPresence(w, r, steamid, v2Force(r), "Delete player") {
+		return
+	}
+
+	unlock := lockPlayer(r.Context(), steamid)
+	defer unlock()
+	audit := beginAudit(r, "delete-player-file", steamid, "", playerFilePath(r.Context(), steamid))
+	response := deletePlayerFile(r.Context(), steamid)
+	audit.finish(response.Success, response.Error)
+	logInfo(r.Context(), "Delete player handler response: Success=%t, Deleted=%t, Error=%s",
+		response.Success, response.Deleted, response.Error)
+	writeResponse(w, r, response)
+}
+
+func v2ListPlayersHandler(w http.ResponseWriter, r *http.Request) {
+	logInfo(r.Context(), "List players handler processing request")
+	players, err := listPlayers(r.Context())
+	if err != nil {
+		logError(r.Context(), "List players handler: %v", err)
+		writeResponse(w, r, PlayerListResponse{Success: false, Players: []PlayerInfo{}, Error: err.Error(), ErrorCode: ErrIO})
+		return
+	}
+	writeResponse(w, r, PlayerListResponse{Success: true, Players: players})
+}
+
+func v2ListSlotsHandler(w http.ResponseWriter, r *http.Request) {
+	steamid, _, ok := v2PathIDs(w, r, "List slots")
+	if !ok {
+		return
+	}
+
+	logInfo(r.Context(), "List slots handler processing request for SteamID: %s", steamid)
+	slots, err := listPlayerSlots(r.Context(), steamid)
+	if err != nil {
+		logError(r.Context(), "List slots handler: %v", err)
+		writeResponse(w, r, SlotListResponse{Success: false, SteamID: steamid, Slots: []SlotInfo{}, Error: err.Error(), ErrorCode: ErrIO})
+		return
+	}
+	writeResponse(w, r, SlotListResponse{Success: true, SteamID: steamid, Slots: slots})
+}
+
+func v2GetSlotHandler(w http.ResponseWriter, r *http.Request) {
+	steamid, slotID, ok := v2PathIDs(w, r, "Get slot")
+	if !ok {
+		return
+	}
+
+	logInfo(r.Context(), "Get slot handler processing request for SteamID: %s, SlotID: %s", steamid, slotID)
+	response := getSlotFileContent(r.Context(), steamid, slotID)
+	writeResponse(w, r, response)
+}
+
+func v2PutSlotHandler(w http.ResponseWriter, r *http.Request) {
+	steamid, slotID, ok := v2PathIDs(w, r, "Put slot")
+	if !ok {
+		return
+	}
+	data, ok := readJSONBody(w, r, "Put slot")
+	if !ok {
+		return
+	}
+
+	logInfo(r.Context(), "Put slot handler processing request for SteamID: %s, SlotID: %s", steamid, slotID)
+	if !checkPlayerPresence(w, r, steamid, v2Force(r), "Put slot") {
+		return
+	}
+
+	unlock := lockPlayer(r.Context(), steamid)
+	defer unlock()
+	audit := beginAudit(r, "write-slot", steamid, slotID, slotFilePath(r.Context(), steamid, slotID))
+	response := writeSlotFile(r.Context(), steamid, slotID+".json", data)
+	audit.finish(response.Success, response.Error)
+	logInfo(r.Context(), "Put slot handler response: Success=%t, Error=%s", response.Success, response.Error)
+	writeResponse(w, r, response)
+}
+
+func v2PatchSlotHandler(w http.ResponseWriter, r *http.Request) {
+	steamid, slotID, ok := v2PathIDs(w, r, "Patch slot")
+	if !ok {
+		return
+	}
+	patch, ok := readJSONBody(w, r, "Patch slot")
+	if !ok {
+		return
+	}
+
+	logInfo(r.Context(), "Patch slot handler processing request for SteamID: %s, SlotID: %s", steamid, slotID)
+	if !checkPlayerPresence(w, r, steamid, v2Force(r), "Patch slot") {
+		return
+	}
+
+	unlock := lockPlayer(r.Context(), steamid)
+	defer unlock()
+
+	current := getSlotFileContent(r.Context(), steamid, slotID)
+	if !current.Success {
+		writeResponse(w, r, current)
+		return
+	}
+	data, err := applyMergePatch(current.Content, patch)
+	if err != nil {
+		logWarn(r.Context(), "Patch slot handler: failed to apply patch: %v", err)
+		writeError(w, r, ErrInvalidJSON, "Failed to apply patch: "+err.Error())
+		return
+	}
+
+	audit := beginAudit(r, "patch-slot", steamid, slotID, slotFilePath(r.Context(), steamid, slotID))
+	response := writeSlotFile(r.Context(), steamid, slotID+".json", data)
+	audit.finish(response.Success, response.Error)
+	logInfo(r.Context(), "Patch slot handler response: Success=%t, Error=%s", response.Success, response.Error)
+	writeResponse(w, r, response)
+}
+
+func v2DeleteSlotHandler(w http.ResponseWriter, r *http.Request) {
+	steamid, slotID, ok := v2PathIDs(w, r, "Delete slot")
+	if !ok {
+		return
+	}
+
+	logInfo(r.Context(), "Delete slot handler processing request for SteamID: %s, SlotID: %s", steamid, slotID)
+	unlock := lockPlayer(r.Context(), steamid)
+	defer unlock()
+	audit := beginAudit(r, "delete-slot-file", steamid, slotID, slotFilePath(r.Context(), steamid, slotID))
+	response := deleteSlotFile(r.Context(), steamid, slotID)
+	audit.finish(response.Success, response.Error)
+	logInfo(r.Context(), "Delete slot handler response: Success=%t, Deleted=%t, Error=%s",
+		response.Success, response.Deleted, response.Error)
+	writeResponse(w, r, response)
+}
+
+func v2TransferHandler(w http.ResponseWriter, r *http.Request) {
+	steamid, slotID, ok := v2PathIDs(w, r, "Transfer")
+	if !ok {
+		return
+	}
+
+	logInfo(r.Context(), "Transfer handler processing request for SteamID: %s, OldSlotID: %s", steamid, slotID)
+	if !checkPlayerPresence(w, r, steamid, v2Force(r), "Transfer") {
+		return
+	}
+
+	unlock := lockPlayer(r.Context(), steamid)
+	defer unlock()
+	audit := beginAudit(r, "transfer", steamid, slotID, playerFilePath(r.Context(), steamid), slotFilePath(r.Context(), steamid, slotID))
+	response := transferPlayerSlot(r.Context(), steamid, slotID)
+	audit.finish(response.Success, response.Error)
+	logInfo(r.Context(), "Transfer handler response: Success=%t, Error=%s", response.Success, response.Error)
+	writeResponse(w, r, response)
+}
+
+func v2RestoreHandler(w http.ResponseWriter, r *http.Request) {
+	steamid, slotID, ok := v2PathIDs(w, r, "Restore slot")
+	if !ok {
+		return
+	}
+
+	logInfo(r.Context(), "Restore slot handler processing request for SteamID: %s, SlotID: %s", steamid, slotID)
+	if !checkPlayerPresence(w, r, steamid, v2Force(r), "Restore slot") {
+		return
+	}
+
+	unlock := lockPlayer(r.Context(), steamid)
+	defer unlock()
+	audit := beginAudit(r, "restore-slot", steamid, slotID, playerFilePath(r.Context(), steamid), slotFilePath(r.Context(), steamid, slotID))
+	response := restoreSlotFromFile(r.Context(), steamid, slotID)
+	audit.finish(response.Success, response.Error)
+	logInfo(r.Context(), "Restore slot handler response: Success=%t, Error=%s", response.Success, response.Error)
+	writeResponse(w, r, response)
+}
+
+func v2EmptySlotHandler(w http.ResponseWriter, r *http.Request) {
+	steamid, slotID, ok := v2PathIDs(w, r, "Empty slot")
+	if !ok {
+		return
+	}
+
+	logInfo(r.Context(), "Empty slot handler processing request for SteamID: %s, SlotID: %s", steamid, slotID)
+	unlock := lockPlayer(r.Context(), steamid)
+	defer unlock()
+	audit := beginAudit(r, "empty-slot", steamid, slotID, slotFilePath(r.Context(), steamid, slotID))
+	response := createEmptySlot(r.Context(), steamid, slotID)
+	audit.finish(response.Success, response.Error)
+	logInfo(r.Context(), "Empty slot handler response: Success=%t, Error=%s", response.Success, response.Error)
+	writeResponse(w, r, response)
+}
@@ -0,0 +1,425 @@
+"use strict";
+
+// Панель работает только через API агента: v2 для игроков, слотов и бэкапов, /audit для журнала.
+// Ключ API хранится в localStorage и отправляется в X-API-Key, как у любого другого клиента.
+// Выбранный профиль сервера добавляется к каждому запросу параметром server.
+
+const $ = (id) => document.getElementById(id);
+const state = { players: [], steamid: "", editing: null };
+
+const keyInput = $("api-key");
+keyInput.value = localStorage.getItem("dino-agent-api-key") || "";
+keyInput.addEventListener("change", () => {
+  localStorage.setItem("dino-agent-api-key", keyInput.value);
+  if (serverSelect.options.length === 0) loadServers().then(showTab);
+});
+
+class APIError extends Error {
+  constructor(status, body, requestID) {
+    const error = (body && body.error) || {};
+    super(error.message || "HTTP " + status);
+    this.status = status;
+    this.code = error.code || "";
+    this.requestID = requestID;
+  }
+}
+
+const serverSelect = $("server");
+
+async function api(method, path, body) {
+  if (serverSelect.value) path += (path.includes("?") ? "&" : "?") + "server=" + encodeURIComponent(serverSelect.value);
+  const headers = { "X-API-Version": "2", "Accept": "application/json" };
+  if (keyInput.value) headers["X-API-Key"] = keyInput.value;
+  const init = { method, headers };
+  if (body !== undefined) {
+    headers["Content-Type"] = "application/json";
+    init.body = typeof body === "string" ? body : JSON.stringify(body);
+  }
+
+  const response = await fetch(path, init);
+  const text = await response.text();
+  let data = null;
+  try { data = text ? JSON.parse(text) : null; } catch (err) { data = null; }
+  if (!response.ok) throw new APIError(response.status, data, response.headers.get("X-Request-ID"));
+  return data;
+}
+
+function showStatus(message, failed) {
+  const status = $("status");
+  status.textContent = message;
+  status.className = "status" + (failed ? " failed" : "");
+  status.hidden = false;
+}
+
+function showError(err) {
+  let message = err.message;
+  if (err.code) message += " (" + err.code + ")";
+  if (err.requestID) message += " — request " + err.requestID;
+  showStatus(message, true);
+}
+
+function row(cells, onClick) {
+  const tr = document.createElement("tr");
+  for (const cell of cells) {
+    const td = document.createElement("td");
+    if (cell instanceof Node) td.append(cell); else td.textContent = cell == null ? "" : String(cell);
+    tr.append(td);
+  }
+  if (onClick) tr.addEventListener("click", onClick);
+  return tr;
+}
+
+function button(label, onClick, className) {
+  const b = document.createElement("button");
+  b.type = "button";
+  b.textContent = label;
+  if (className) b.className = className;
+  b.addEventListener("click", (event) => { event.stopPropagation(); onClick(); });
+  return b;
+}
+
+function buttons(...list) {
+  const span = document.createElement("span");
+  span.className = "toolbar";
+  span.append(...list);
+  return span;
+}
+
+const formatTime = (value) => value ? new Date(value).toLocaleString() : "";
+const enc = encodeURIComponent;
+const forceQuery = () => $("force").checked ? "?force=true" : "";
+
+// Операция над онлайн-игроком отклоняется с LOCKED; предлагаем повторить с force
+async function mutate(method, path, body) {
+  try {
+    return await api(method, path + forceQuery(), body);
+  } catch (err) {
+    if (err.code === "LOCKED" && !$("force").checked && confirm(err.message + "\n\nRun anyway? The game may overwrite the change.")) {
+      return api(method, path + (path.includes("?") ? "&" : "?") + "force=true", body);
+    }
+    throw err;
+  }
+}
+
+// --- Игроки ---
+
+async function loadPlayers() {
+  try {
+    const data = await api("GET", "/v2/players");
+    state.players = data.players || [];
+    renderPlayers();
+  } catch (err) {
+    showError(err);
+  }
+}
+
+function renderPlayers() {
+  const filter = $("search").value.trim();
+  const tbody = $("players").tBodies[0];
+  tbody.textContent = "";
+  for (const player of state.players) {
+    if (filter && !player.steamid.includes(filter)) continue;
+    const tr = row([player.steamid, formatTime(player.mod_time)], () => openPlayer(player.steamid));
+    if (player.steamid === state.steamid) tr.className = "selected";
+    tbody.append(tr);
+  }
+}
+
+async function openPlayer(steamid) {
+  state.steamid = steamid;
+  $("player").hidden = false;
+  $("player-title").textContent = "Player " + steamid;
+  renderPlayers();
+  await Promise.all([loadSlots(), edit({ kind: "player" })]);
+}
+
+async function loadSlots() {
+  const tbody = $("slots").tBodies[0];
+  tbody.textContent = "";
+  try {
+    const data = await api("GET", "/v2/players/" + enc(state.steamid) + "/slots");
+    for (const slot of data.slots) {
+      tbody.append(row([slot.slot_id, slot.size, formatTime(slot.mod_time), buttons(
+        button("Edit", () => edit({ kind: "slot", slot: slot.slot_id })),
+        button("Restore", () => slotAction("restore", slot.slot_id, "Restore slot " + slot.slot_id + " into the player file?")),
+        button("Transfer here", () => slotAction("transfer", slot.slot_id, "Save the current dinosaur into slot " + slot.slot_id + "? The slot will be overwritten.")),
+        button("Delete", () => deleteFile({ kind: "slot", slot: slot.slot_id }), "danger"),
+      )]));
+    }
+    if (data.slots.length === 0) tbody.append(row(["no slots"]));
+  } catch (err) {
+    showError(err);
+  }
+}
+
+async function slotAction(action, slot, question) {
+  if (!slot) return showStatus("Slot is required", true);
+  if (!confirm(question)) return;
+  try {
+    const path = "/v2/players/" + enc(state.steamid) + "/slots/" + enc(slot) + "/" + action;
+    const result = action === "empty" ? await api("POST", path) : await mutate("POST", path);
+    showStatus(result.message);
+    await openPlayer(state.steamid);
+    loadPlayers();
+  } catch (err) {
+    showError(err);
+  }
+}
+
+function filePath(target) {
+  const player = "/v2/players/" + enc(state.steamid);
+  return target.kind === "slot" ? player + "/slots/" + enc(target.slot) : player;
+}
+
+function targetName(target) {
+  return target.kind === "slot" ? "Slot " + target.slot : "Player file";
+}
+
+// --- Редактор ---
+
+async function edit(target) {
+  state.editing = target;
+  $("editor-title").textContent = targetName(target);
+  $("edit-player").hidden = target.kind === "player";
+  const editor = $("editor");
+  try {
+    const data = await api("GET", filePath(target));
+    editor.value = JSON.stringify(data.content, null, 2);
+  } catch (err) {
+    if (err.code !== "NOT_FOUND") return showError(err);
+    editor.value = "";
+  }
+  validate();
+}
+
+// Сохранять можно только корректный JSON-объект; позицию ошибки показываем как строку и столбец
+function validate() {
+  const editor = $("editor");
+  let message = "";
+  if (editor.value.trim() === "") {
+    message = "File does not exist; enter JSON to create it";
+  } else {
+    try {
+      const value = JSON.parse(editor.value);
+      if (value === null || typeof value !== "object" || Array.isArray(value)) message = "Save data must be a JSON object";
+    } catch (err) {
+      message = err.message;
+      const match = /position (\d+)/.exec(err.message);
+      if (match) {
+        const before = editor.value.slice(0, Number(match[1])).split("\n");
+        message += " (line " + before.length + ", column " + (before[before.length - 1].length + 1) + ")";
+      }
+    }
+  }
+  $("editor-error").textContent = message;
+  editor.classList.toggle("invalid", message !== "" && editor.value.trim() !== "");
+  $("save").disabled = message !== "";
+  $("format").disabled = message !== "";
+  return message === "";
+}
+
+async function save() {
+  if (!validate()) return;
+  const target = state.editing;
+  if (!confirm("Overwrite " + targetName(target).toLowerCase() + " of " + state.steamid + "?")) return;
+  try {
+    const result = await mutate("PUT", filePath(target), $("editor").value);
+    showStatus(result.message);
+    await openPlayer(state.steamid);
+    if (target.kind === "slot") await edit(target);
+  } catch (err) {
+    showError(err);
+  }
+}
+
+async function deleteFile(target) {
+  if (!confirm("Delete " + targetName(target).toLowerCase() + " of " + state.steamid + "? A backup is kept.")) return;
+  try {
+    const result = target.kind === "slot" ? await api("DELETE", filePath(target)) : await mutate("DELETE", filePath(target));
+    showStatus(result.message + (result.backup_path ? " (backup " + result.backup_path + ")" : ""));
+    await openPlayer(state.steamid);
+    loadPlayers();
+  } catch (err) {
+    showError(err);
+  }
+}
+
+$("editor").addEventListener("input", validate);
+$("format").addEventListener("click", () => {
+  if (validate()) $("editor").value = JSON.stringify(JSON.parse($("editor").value), null, 2);
+});
+$("save").addEventListener("click", save);
+$("delete").addEventListener("click", () => deleteFile(state.editing));
+$("edit-player").addEventListener("click", () => edit({ kind: "player" }));
+$("search").addEventListener("input", renderPlayers);
+$("player-search").addEventListener("submit", (event) => {
+  event.preventDefault();
+  const steamid = $("search").value.trim();
+  if (steamid) openPlayer(steamid);
+});
+$("new-slot").addEventListener("submit", (event) => {
+  event.preventDefault();
+  const slot = $("new-slot-id").value.trim();
+  slotAction("transfer", slot, "Save the current dinosaur into slot " + slot + "? The player file will be removed.");
+});
+$("new-empty-slot").addEventListener("click", () => {
+  const slot = $("new-slot-id").value.trim();
+  slotAction("empty", slot, "Create an empty slot " + slot + "? An existing slot is overwritten.");
+});
+
+// --- Бэкапы ---
+
+async function loadBackups() {
+  const tbody = $("backups").tBodies[0];
+  tbody.textContent = "";
+  try {
+    const data = await api("GET", "/v2/backups?prefix=" + enc($("backup-prefix").value.trim()));
+    for (const backup of data.backups) {
+      tbody.append(row([backup.name, backup.size, formatTime(backup.mod_time), button("Restore…", () => restoreBackup(backup.name))]));
+    }
+    if (data.backups.length === 0) tbody.append(row(["no backups"]));
+  } catch (err) {
+    showError(err);
+  }
+}
+
+// Имя бэкапа начинается с исходного файла: SteamID для файла игрока или SteamID_слот для слота
+async function restoreBackup(name) {
+  const source = name.replace(/_\d{8}_\d{6}\.backup$/, "");
+  const steamid = prompt("Restore " + name + " for SteamID:", state.steamid || source.split("_")[0]);
+  if (!steamid) return;
+  const sourceSlot = source.startsWith(steamid.trim() + "_") ? source.slice(steamid.trim().length + 1) : "";
+  const slot = prompt("Slot to restore into (leave empty to restore the player file):", sourceSlot);
+  if (slot === null) return;
+  let request = { steamid: steamid.trim(), slot_id: slot.trim() || undefined };
+  const restore = () => api("POST", "/v2/backups/" + enc(name) + "/restore", request);
+  try {
+    let result;
+    try {
+      result = await restore();
+    } catch (err) {
+      if (err.code === "CONFLICT" && confirm(err.message + "\n\nRestore it into this file anyway?")) {
+        request = { ...request, allow_cross_target: true };
+      } else if (err.code === "LOCKED" && confirm(err.message + "\n\nRun anyway? The game may overwrite the change.")) {
+        request = { ...request, force: true };
+      } else {
+        throw err;
+      }
+      result = await restore().catch((retryErr) => {
+        if (retryErr.code !== "LOCKED" || !confirm(retryErr.message + "\n\nRun anyway? The game may overwrite the change.")) throw retryErr;
+        request = { ...request, force: true };
+        return restore();
+      });
+    }
+    showStatus(result.message);
+  } catch (err) {
+    showError(err);
+  }
+}
+
+// --- Перенос между серверами ---
+
+// Сначала показываем план (dry_run), и только после подтверждения переносим файлы
+async function migratePlayer() {
+  const from = serverSelect.value;
+  const others = [...serverSelect.options].map((option) => option.value).filter((name) => name !== from);
+  const to = prompt("Copy player " + state.steamid + " from " + from + " to server (" + others.join(", ") + "):", others[0] || "");
+  if (!to) return;
+  const mode = prompt("copy keeps the files on " + from + ", move removes them:", "copy");
+  if (!mode) return;
+  const onConflict = prompt("If a file already exists on " + to + ": skip, overwrite (with backup) or rename the slot:", "skip");
+  if (!onConflict) return;
+  const path = "/v2/players/" + enc(state.steamid) + "/migrate";
+  const request = { to: to.trim(), mode: mode.trim(), on_conflict: onConflict.trim(), force: $("force").checked || undefined };
+  try {
+    const plan = await api("POST", path, { ...request, dry_run: true });
+    const files = plan.files.map((file) => file.action + ": " + (file.slot_id ? "slot " + file.slot_id : "player file") +
+      (file.target_slot_id && file.target_slot_id !== file.slot_id ? " → slot " + file.target_slot_id : ""));
+    if (!confirm(plan.message + "\n\n" + files.join("\n") + "\n\nProceed?")) return;
+    let result;
+    try {
+      result = await api("POST", path, request);
+    } catch (err) {
+      if (err.code !== "LOCKED" || !confirm(err.message + "\n\nRun anyway? The game may overwrite the change.")) throw err;
+      result = await api("POST", path, { ...request, force: true });
+    }
+    showStatus(result.message);
+    if (request.mode === "move") await openPlayer(state.steamid);
+    loadPlayers();
+  } catch (err) {
+    showError(err);
+  }
+}
+
+$("migrate").addEventListener("click", migratePlayer);
+
+$("backup-search").addEventListener("submit", (event) => { event.preventDefault(); loadBackups(); });
+
+// --- Журнал аудита ---
+
+async function loadAudit() {
+  const tbody = $("audit").tBodies[0];
+  tbody.textContent = "";
+  const query = new URLSearchParams();
+  for (const input of $("audit-search").elements) {
+    if (input.name && input.value.trim()) query.set(input.name, input.value.trim());
+  }
+  try {
+    const data = await api("GET", "/audit?" + query);
+    for (const entry of data.entries) {
+      const result = document.createElement("span");
+      result.className = entry.success ? "ok" : "fail";
+      result.textContent = entry.success ? "ok" : entry.error || "failed";
+      const tr = row([formatTime(entry.time), entry.server, entry.caller, entry.operation, entry.steamid, entry.slot_id, result, entry.details]);
+      tr.lastChild.className = "wrap";
+      tbody.append(tr);
+    }
+    if (data.entries.length === 0) tbody.append(row(["no entries"]));
+  } catch (err) {
+    showError(err);
+  }
+}
+
+$("audit-search").addEventListener("submit", (event) => { event.preventDefault(); loadAudit(); });
+
+// --- Вкладки ---
+
+const loaders = { players: loadPlayers, backups: loadBackups, audit: loadAudit };
+
+function showTab() {
+  const tab = (location.hash || "#players").slice(1);
+  if (!loaders[tab]) return;
+  for (const name of Object.keys(loaders)) $("tab-" + name).hidden = name !== tab;
+  for (const link of document.querySelectorAll("nav a")) link.classList.toggle("active", link.dataset.tab === tab);
+  loaders[tab]();
+}
+
+// --- Серверы ---
+
+async function loadServers() {
+  try {
+    const data = await api("GET", "/v2/servers");
+    // Профиль, сохранённый раньше, мог исчезнуть из конфига агента
+    let saved = localStorage.getItem("dino-agent-server");
+    if (!data.servers.some((server) => server.name === saved)) saved = "";
+    for (const server of data.servers) {
+      const option = new Option(server.name + (server.rcon ? "" : " (no RCON)"), server.name);
+      option.selected = saved ? server.name === saved : server.default;
+      serverSelect.append(option);
+    }
+    serverSelect.parentElement.hidden = data.servers.length < 2;
+    $("migrate").hidden = data.servers.length < 2;
+  } catch (err) {
+    showError(err);
+  }
+}
+
+serverSelect.addEventListener("change", () => {
+  localStorage.setItem("dino-agent-server", serverSelect.value);
+  state.steamid = "";
+  $("player").hidden = true;
+  showTab();
+});
+
+window.addEventListener("hashchange", showTab);
+loadServers().then(showTab);
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"DinoAgentApi/api"
+	"bufio"
+	"container/heap"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type AuditActor = api.AuditActor
+
+type AuditFile struct {
+	Path   string `json:"path"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+type AuditEntry struct {
+	Time       time.Time   `json:"time"`
+	Caller     string      `json:"caller"`
+	APIKey     string      `json:"api_key,omitempty"`
+	RemoteAddr string      `json:"remote_addr,omitempty"`
+	RequestID  string      `json:"request_id,omitempty"`
+	Server     string      `json:"server,omitempty"`
+	Operation  string      `json:"operation"`
+	SteamID    string      `json:"steamid,omitempty"`
+	SlotID     string      `json:"slot_id,omitempty"`
+	Files      []AuditFile `json:"files,omitempty"`
+	Details    string      `json:"details,omitempty"`
+	Success    bool        `json:"success"`
+	Error      string      `json:"error,omitempty"`
+}
+
+type AuditQuery struct {
+	From      time.Time
+	To        time.Time
+	Operation string
+	SteamID   string
+	SlotID    string
+	Caller    string
+	Server    string
+	Path      string
+	Success   *bool
+	Limit     int
+}
+
+type AuditQueryResponse struct {
+	Success   bool         `json:"success"`
+	Count     int          `json:"count"`
+	Entries   []AuditEntry `json:"entries"`
+	Error     string       `json:"error,omitempty"`
+	ErrorCode ErrorCode    `json:"error_code,omitempty"`
+}
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+type auditActorKey struct{}
+
+func withAuditActor(ctx context.Context, actor AuditActor) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+func auditActorFrom(ctx context.Context) AuditActor {
+	if actor, ok := ctx.Value(auditActorKey{}).(AuditActor); ok {
+		return actor
+	}
+	return AuditActor{Caller: "system"}
+}
+
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return ""
+}
+
+func apiKeyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:4])
+}
+
+func requestActor(r *http.Request) AuditActor {
+	actor := AuditActor{Caller: "anonymous", RemoteAddr: r.RemoteAddr, RequestID: requestIDFrom(r.Context())}
+
+	key := apiKeyFromRequest(r)
+	if key == "" {
+		return actor
+	}
+
+	// В журнал пишем только отпечаток ключа, сам ключ не сохраняется
+	actor.APIKey = apiKeyFingerprint(key)
+	actor.Caller = "unknown-key"
+	for _, known := range config.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(known.Key), []byte(key)) == 1 {
+			actor.Caller = known.Name
+			break
+		}
+	}
+	return actor
+}
+
+func fileHash(filePath string) string {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+type auditRecord struct {
+	entry AuditEntry
+}
+
+func beginAuditAs(ctx context.Context, actor AuditActor, operation, steamid, slotID string, paths ...string) *auditRecord {
+	record := &auditRecord{entry: AuditEntry{
+		Caller:     actor.Caller,
+		APIKey:     actor.APIKey,
+		RemoteAddr: actor.RemoteAddr,
+		RequestID:  actor.RequestID,
+		Server:     serverFrom(ctx).Name,
+		Operation:  operation,
+		SteamID:    steamid,
+		SlotID:     slotID,
+	}}
+
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		record.entry.Files = append(record.entry.Files, AuditFile{Path: path, Before: fileHash(path)})
+	}
+	return record
+}
+
+func beginAudit(r *http.Request, operation, steamid, slotID string, paths ...string) *auditRecord {
+	return beginAuditAs(r.Context(), requestActor(r), operation, steamid, slotID, paths...)
+}
+
+func (a *auditRecord) details(format string, args ...interface{}) *auditRecord {
+	a.entry.Details = fmt.Sprintf(format, args...)
+	return a
+}
+
+func (a *auditRecord) finish(success bool, errMsg string) {
+	a.entry.Time = time.Now()
+	a.entry.Success = success
+	a.entry.Error = errMsg
+	for i := range a.entry.Files {
+		a.entry.Files[i].After = fileHash(a.entry.Files[i].Path)
+	}
+	auditLog.Write(a.entry)
+
+	outcome := "success"
+	if !success {
+		outcome = "failure"
+	}
+	operationsTotal.Inc(a.entry.Operation, outcome)
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+type auditLogger struct {
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+var auditLog = &auditLogger{}
+
+func (l *auditLogger) open() error {
+	path := config.Audit.File
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// Журнал только дописывается, существующие записи не изменяются
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+func (l *auditLogger) rotate() error {
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+
+	path := config.Audit.File
+	maxFiles := config.Audit.MaxFiles
+	if maxFiles < 1 {
+		maxFiles = 1
+	}
+
+	os.Remove(fmt.Sprintf("%s.%d", path, maxFiles))
+	for i := maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+	}
+	if err := os.Rename(path, path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	logInfo(context.Background(), "Audit: rotated %s", path)
+	return l.open()
+}
+
+func (l *auditLogger) Write(entry AuditEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		logError(context.Background(), "Audit: failed to marshal entry: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		if err := l.open(); err != nil {
+			logError(context.Background(), "Audit: failed to open %s: %v", config.Audit.File, err)
+			return
+		}
+	}
+
+	maxSize := int64(config.Audit.MaxSizeMB) * 1024 * 1024
+	if maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > maxSize {
+		if err := l.rotate(); err != nil {
+			logError(context.Background(), "Audit: failed to rotate %s: %v", config.Audit.File, err)
+			return
+		}
+	}
+
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		logError(context.Background(), "Audit: failed to write entry: %v", err)
+	}
+}
+
+func (l *auditLogger) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file != nil {
+		l.file.Sync()
+		l.file.Close()
+		l.file = nil
+	}
+}
+
+func auditEntryMatches(entry AuditEntry, query AuditQuery) bool {
+	if !query.From.IsZero() && entry.Time.Before(query.From) {
+		return false
+	}
+	if !query.To.IsZero() && entry.Time.After(query.To) {
+		return false
+	}
+	if query.Operation != "" && entry.Operation != query.Operation {
+		return false
+	}
+	if query.SteamID != "" && entry.SteamID != query.SteamID {
+		return false
+	}
+	if query.SlotID != "" && entry.SlotID != query.SlotID {
+		return false
+	}
+	if query.Caller != "" && entry.Caller != query.Caller {
+		return false
+	}
+	if query.Server != "" && entry.Server != query.Server {
+		return false
+	}
+	if query.Success != nil && entry.Success != *query.Success {
+		return false
+	}
+	if query.Path != "" {
+		found := false
+		for _, file := range entry.Files {
+			if strings.Contains(strings.ToLower(file.Path), strings.ToLower(query.Path)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Куча удерживает самые новые записи в пределах лимита, наверху самая старая из них
+type auditEntryHeap []AuditEntry
+
+func (h auditEntryHeap) Len() int           { return len(h) }
+func (h auditEntryHeap) Less(i, j int) bool { return h[i].Time.Before(h[j].Time) }
+func (h auditEntryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *auditEntryHeap) Push(x interface{}) {
+	*h = append(*h, x.(AuditEntry))
+}
+
+func (h *auditEntryHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
+
+func (l *auditLogger) Query(query AuditQuery) ([]AuditEntry, error) {
+	// Под блокировкой писателя только список файлов: чтение большого журнала не задерживает
+	// запись аудита. Ротация во время запроса может сдвинуть записи между файлами,
+	// и ответ на границе файлов неточен, но сам журнал это не затрагивает
+	l.mu.Lock()
+	path := config.Audit.File
+	var files []string
+	for i := config.Audit.MaxFiles; i >= 1; i-- {
+		files = append(files, fmt.Sprintf("%s.%d", path, i))
+	}
+	files = append(files, path)
+	l.mu.Unlock()
+
+	// Читаем от самого старого архива к текущему файлу
+	newest := &auditEntryHeap{}
+	for _, name := range files {
+		file, err := os.Open(name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+		for scanner.Scan() {
+			var entry AuditEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				continue
+			}
+			if !auditEntryMatches(entry, query) {
+				continue
+			}
+			heap.Push(newest, entry)
+			if newest.Len() > query.Limit {
+				heap.Pop(newest)
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", name, err)
+		}
+	}
+
+	// Новые записи первыми
+	entries := append([]AuditEntry{}, *newest...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.After(entries[j].Time)
+	})
+	return entries, nil
+}
+
+func parseAuditQuery(r *http.Request) (AuditQuery, error) {
+	params := r.URL.Query()
+	query := AuditQuery{
+		Operation: params.Get("operation"),
+		SteamID:   params.Get("steamid"),
+		SlotID:    params.Get("slot_id"),
+		Caller:    params.Get("caller"),
+		Server:    params.Get("server"),
+		Path:      params.Get("path"),
+		Limit:     defaultAuditLimit,
+	}
+
+	if from := params.Get("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return query, fmt.Errorf("from must be an RFC3339 timestamp")
+		}
+		query.From = t
+	}
+	if to := params.Get("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return query, fmt.Errorf("to must be an RFC3339 timestamp")
+		}
+		query.To = t
+	}
+	if success := params.Get("success"); success != "" {
+		value, err := strconv.ParseBool(success)
+		if err != nil {
+			return query, fmt.Errorf("success must be true or false")
+		}
+		query.Success = &value
+	}
+	if limit := params.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value <= 0 {
+			return query, fmt.Errorf("limit must be a positive integer")
+		}
+		if value > maxAuditLimit {
+			value = maxAuditLimit
+		}
+		query.Limit = value
+	}
+
+	return query, nil
+}
+
+func auditHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		logWarn(r.Context(), "Audit handler: method not allowed: %s", r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	query, err := parseAuditQuery(r)
+	if err != nil {
+		logWarn(r.Context(), "Audit handler: invalid query: %v", err)
+		writeError(w, r, ErrInvalidRequest, err.Error())
+		return
+	}
+
+	entries, err := auditLog.Query(query)
+	if err != nil {
+		logError(r.Context(), "Audit handler: failed to read audit log: %v", err)
+		writeResponseStatus(w, r, http.StatusInternalServerError, AuditQueryResponse{Success: false, Entries: []AuditEntry{}, Error: err.Error(), ErrorCode: ErrIO})
+		return
+	}
+
+	logInfo(r.Context(), "Audit handler response: %d entries", len(entries))
+	writeResponse(w, r, AuditQueryResponse{Success: true, Count: len(entries), Entries: entries})
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"DinoAgentApi/api"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type (
+	BackupInfo            = api.BackupInfo
+	BackupListResponse    = api.BackupListResponse
+	BackupRestoreRequest  = api.BackupRestoreRequest
+	BackupRestoreResponse = api.BackupRestoreResponse
+)
+
+// Бэкапы называются <steamid>_<время>.backup для файла игрока и <steamid>_<слот>_<время>.backup для слота,
+// поэтому prefix позволяет найти бэкапы игрока или слота.
+// Список и восстановление работают с бэкапами выбранного сервера
+func listBackups(ctx context.Context, prefix string) ([]BackupInfo, error) {
+	srv := serverFrom(ctx)
+	entries, err := os.ReadDir(serverBackupDir(srv))
+	if os.IsNotExist(err) {
+		return []BackupInfo{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	backups := []BackupInfo{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".backup" || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, BackupInfo{Name: entry.Name(), Server: srv.Name, Size: info.Size(), ModTime: info.ModTime()})
+	}
+	// Свежие бэкапы первыми
+	sort.Slice(backups, func(i, j int) bool { return backups[i].ModTime.After(backups[j].ModTime) })
+	return backups, nil
+}
+
+var backupNamePattern = regexp.MustCompile(`^(.+)_\d{8}_\d{6}\.backup$`)
+
+// Имя бэкапа начинается с файла, из которого он сделан: <steamid> или <steamid>_<слот>
+func backupMatchesTarget(name, steamid, slotID string) bool {
+	match := backupNamePattern.FindStringSubmatch(name)
+	if match == nil {
+		return false
+	}
+	want := steamid
+	if slotID != "" {
+		want = steamid + "_" + slotID
+	}
+	return match[1] == want
+}
+
+// Текущее содержимое цели не теряется: writeFileByPath сохраняет его в историю версий
+func restoreBackup(ctx context.Context, name, steamid, slotID string, allowCrossTarget bool) BackupRestoreResponse {
+	response := BackupRestoreResponse{Backup: name}
+
+	if name == "" || filepath.Base(name) != name || filepath.Ext(name) != ".backup" {
+		response.Error = "Backup must be a .backup file name inside the server backup directory"
+		response.ErrorCode = ErrInvalidRequest
+		logWarn(ctx, "Restore backup: invalid backup name %q", name)
+		return response
+	}
+
+	// Бэкап слота поверх файла игрока или бэкап другого игрока - почти всегда опечатка
+	if !allowCrossTarget && !backupMatchesTarget(name, steamid, slotID) {
+		response.Error = fmt.Sprintf("Backup %s was not made from the target file, set allow_cross_target to restore it anyway", name)
+		response.ErrorCode = ErrConflict
+		logWarn(ctx, "Restore backup: backup %s does not match target steamid=%s slot=%s", name, steamid, slotID)
+		return response
+	}
+
+	content, err := os.ReadFile(filepath.Join(serverBackupDir(serverFrom(ctx)), name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			response.Error = "Backup not found"
+			response.ErrorCode = ErrNotFound
+			logWarn(ctx, "Restore backup: backup %s not found", name)
+		} else {
+			response.Error = fmt.Sprintf("Failed to read backup: %v", err)
+			response.ErrorCode = ErrIO
+			logError(ctx, "Restore backup: failed to read backup %s: %v", name, err)
+		}
+		return response
+	}
+
+	target := playerFilePath(ctx, steamid)
+	if slotID != "" {
+		target = slotFilePath(ctx, steamid, slotID)
+	}
+	response.FilePath = target
+
+	logInfo(ctx, "Restoring backup %s to %s", name, target)
+	written := writeFileByPath(ctx, target, json.RawMessage(content))
+	if !written.Success {
+		response.Error = written.Error
+		response.ErrorCode = written.ErrorCode
+		return response
+	}
+
+	response.Success = true
+	response.Message = fmt.Sprintf("Backup %s restored to %s", name, filepath.Base(target))
+	return response
+}
+
+func v2ListBackupsHandler(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	logInfo(r.Context(), "List backups handler processing request, prefix: %q", prefix)
+	backups, err := listBackups(r.Context(), prefix)
+	if err != nil {
+		logError(r.Context(), "List backups handler: %v", err)
+		writeResponse(w, r, BackupListResponse{Success: false, Backups: []BackupInfo{}, Error: err.Error(), ErrorCode: ErrIO})
+		return
+	}
+	writeResponse(w, r, BackupListResponse{Success: true, Backups: backups})
+}
+
+func v2RestoreBackupHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	body, ok := readJSONBody(w, r, "Restore backup")
+	if !ok {
+		return
+	}
+	var req BackupRestoreRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		logWarn(r.Context(), "Restore backup handler: invalid request: %v", err)
+		writeError(w, r, ErrInvalidJSON, "Invalid JSON")
+		return
+	}
+	if req.SteamID == "" {
+		logWarn(r.Context(), "Restore backup handler: steamid is required")
+		writeError(w, r, ErrInvalidRequest, "steamid is required")
+		return
+	}
+
+	ids := []string{name, req.SteamID}
+	if req.SlotID != "" {
+		ids = append(ids, req.SlotID)
+	}
+	if !checkIDs(w, r, "Restore backup", ids...) {
+		return
+	}
+
+	logInfo(r.Context(), "Restore backup handler processing request for backup: %s, SteamID: %s, SlotID: %s", name, req.SteamID, req.SlotID)
+	if !checkPlayerPresence(w, r, req.SteamID, req.Force, "Restore backup") {
+		return
+	}
+
+	unlock := lockPlayer(r.Context(), req.SteamID)
+	defer unlock()
+	target := playerFilePath(r.Context(), req.SteamID)
+	if req.SlotID != "" {
+		target = slotFilePath(r.Context(), req.SteamID, req.SlotID)
+	}
+	audit := beginAudit(r, "restore-backup", req.SteamID, req.SlotID, target).details("backup=%s", name)
+	response := restoreBackup(r.Context(), name, req.SteamID, req.SlotID, req.AllowCrossTarget)
+	audit.finish(response.Success, response.Error)
+	writeResponse(w, r, response)
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type BatchOperation struct {
+	ID        string          `json:"id,omitempty"`
+	Op        string          `json:"op"`
+	SteamID   string          `json:"steamid"`
+	OldSlotID string          `json:"old_slot_id,omitempty"`
+	SlotID    string          `json:"slot_id,omitempty"`
+	FileName  string          `json:"file_name,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Force     bool            `json:"force,omitempty"`
+}
+
+type BatchRequest struct {
+	Operations  []BatchOperation `json:"operations"`
+	Parallelism int              `json:"parallelism,omitempty"`
+	StopOnError bool             `json:"stop_on_error,omitempty"`
+	Async       bool             `json:"async,omitempty"`
+	Server      string           `json:"server,omitempty"`
+}
+
+type BatchItemResult struct {
+	Index     int         `json:"index"`
+	ID        string      `json:"id,omitempty"`
+	Op        string      `json:"op"`
+	SteamID   string      `json:"steamid"`
+	Success   bool        `json:"success"`
+	Skipped   bool        `json:"skipped,omitempty"`
+	Result    interface{} `json:"result,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	ErrorCode ErrorCode   `json:"error_code,omitempty"`
+}
+
+type BatchResponse struct {
+	Success   bool              `json:"success"`
+	Total     int               `json:"total"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Skipped   int               `json:"skipped"`
+	Results   []BatchItemResult `json:"results"`
+	Error     string            `json:"error,omitempty"`
+	ErrorCode ErrorCode         `json:"error_code,omitempty"`
+}
+
+const (
+	maxBatchOperations      = 1000
+	defaultBatchParallelism = 4
+	maxBatchParallelism     = 16
+)
+
+func validateBatchOperation(op BatchOperation) error {
+	if op.SteamID == "" {
+		return fmt.Errorf("steamid is required")
+	}
+
+	switch op.Op {
+	case "check", "delete":
+	case "transfer":
+		if op.OldSlotID == "" {
+			return fmt.Errorf("old_slot_id is required for transfer")
+		}
+	case "restore":
+		if op.SlotID == "" {
+			return fmt.Errorf("slot_id is required for restore")
+		}
+	case "empty-slot":
+		if op.OldSlotID == "" && op.SlotID == "" {
+			return fmt.Errorf("old_slot_id is required for empty-slot")
+		}
+	case "write-slot":
+		if op.FileName == "" {
+			return fmt.Errorf("file_name is required for write-slot")
+		}
+	default:
+		return fmt.Errorf("unknown operation %q", op.Op)
+	}
+
+	for _, id := range []string{op.SteamID, op.OldSlotID, op.SlotID, op.FileName} {
+		if id != "" && !validID(id) {
+			return fmt.Errorf("invalid identifier %q", id)
+		}
+	}
+	return nil
+}
+
+func runBatchOperation(ctx context.Context, index int, op BatchOperation) BatchItemResult {
+	actor := auditActorFrom(ctx)
+	item := BatchItemResult{
+		Index:   index,
+		ID:      op.ID,
+		Op:      op.Op,
+		SteamID: op.SteamID,
+	}
+
+	if err := validateBatchOperation(op); err != nil {
+		item.Error = err.Error()
+		item.ErrorCode = ErrInvalidRequest
+		return item
+	}
+
+	// Изменения файлов онлайн-игрока будут перезаписаны игрой
+	if op.Op == "transfer" || op.Op == "restore" || op.Op == "write-slot" || (op.Op == "delete" && op.SlotID == "") {
+		if err := ensurePlayerOffline(ctx, op.SteamID, op.Force); err != nil {
+			item.Error = err.Error()
+			item.ErrorCode = errorCodeFor(err)
+			return item
+		}
+	}
+
+	// Операции над одним игроком не должны пересекаться
+	unlock := lockPlayer(ctx, op.SteamID)
+	defer unlock()
+
+	switch op.Op {
+	case "check":
+		response := checkPlayerFile(ctx, op.SteamID)
+		item.Result, item.Success, item.Error, item.ErrorCode = response, response.Error == "", response.Error, response.ErrorCode
+
+	case "transfer":
+		audit := beginAuditAs(ctx, actor, "transfer", op.SteamID, op.OldSlotID, playerFilePath(ctx, op.SteamID), slotFilePath(ctx, op.SteamID, op.OldSlotID)).details("batch")
+		response := transferPlayerSlot(ctx, op.SteamID, op.OldSlotID)
+		audit.finish(response.Success, response.Error)
+		item.Result, item.Success, item.Error, item.ErrorCode = response, response.Success, response.Error, response.ErrorCode
+
+	case "restore":
+		audit := beginAuditAs(ctx, actor, "restore-slot", op.SteamID, op.SlotID, playerFilePath(ctx, op.SteamID), slotFilePath(ctx, op.SteamID, op.SlotID)).details("batch")
+		response := restoreSlotFromFile(ctx, op.SteamID, op.SlotID)
+		audit.finish(response.Success, response.Error)
+		item.Result, item.Success, item.Error, item.ErrorCode = response, response.Success, response.Error, response.ErrorCode
+
+	case "empty-slot":
+		slotID := op.OldSlotID
+		if slotID == "" {
+			slotID = op.SlotID
+		}
+		audit := beginAuditAs(ctx, actor, "empty-slot", op.SteamID, slotID, slotFilePath(ctx, op.SteamID, slotID)).details("batch")
+		response := createEmptySlot(ctx, op.SteamID, slotID)
+		audit.finish(response.Success, response.Error)
+		item.Result, item.Success, item.Error, item.ErrorCode = response, response.Success, response.Error, response.ErrorCode
+
+	case "write-slot":
+		slotID := strings.TrimSuffix(op.FileName, ".json")
+		audit := beginAuditAs(ctx, actor, "write-slot", op.SteamID, slotID, slotFilePath(ctx, op.SteamID, slotID)).details("batch")
+		response := writeSlotFile(ctx, op.SteamID, op.FileName, op.Data)
+		audit.finish(response.Success, response.Error)
+		item.Result, item.Success, item.Error, item.ErrorCode = response, response.Success, response.Error, response.ErrorCode
+
+	case "delete":
+		var response DeleteFileResponse
+		if op.SlotID != "" {
+			audit := beginAuditAs(ctx, actor, "delete-slot-file", op.SteamID, op.SlotID, slotFilePath(ctx, op.SteamID, op.SlotID)).details("batch")
+			response = deleteSlotFile(ctx, op.SteamID, op.SlotID)
+			audit.finish(response.Success, response.Error)
+		} else {
+			audit := beginAuditAs(ctx, actor, "delete-player-file", op.SteamID, "", playerFilePath(ctx, op.SteamID)).details("batch")
+			response = deletePlayerFile(ctx, op.SteamID)
+			audit.finish(response.Success, response.Error)
+		}
+		item.Result, item.Success, item.Error, item.ErrorCode = response, response.Success, response.Error, response.ErrorCode
+	}
+
+	return item
+}
+
+func runBatch(ctx context.Context, req BatchRequest, progress func(done, total int)) BatchResponse {
+	total := len(req.Operations)
+	logInfo(ctx, "Running batch of %d operations, parallelism: %d, stop on error: %t", total, req.Parallelism, req.StopOnError)
+
+	if total == 0 {
+		result := BatchResponse{
+			Success:   false,
+			Results:   []BatchItemResult{},
+			Error:     "No operations provided",
+			ErrorCode: ErrInvalidRequest,
+		}
+		logWarn(ctx, "Batch is empty")
+		return result
+	}
+
+	if total > maxBatchOperations {
+		result := BatchResponse{
+			Success:   false,
+			Total:     total,
+			Results:   []BatchItemResult{},
+			Error:     fmt.Sprintf("Too many operations (max %d)", maxBatchOperations),
+			ErrorCode: ErrInvalidRequest,
+		}
+		logWarn(ctx, "Batch too large: %d operations", total)
+		return result
+	}
+
+	parallelism := req.Parallelism
+	if parallelism <= 0 {
+		parallelism = defaultBatchParallelism
+	}
+	if parallelism > maxBatchParallelism {
+		parallelism = maxBatchParallelism
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Операции одного игрока выполняются по порядку в одной горутине,
+	// разные игроки обрабатываются параллельно
+	var groups [][]int
+	groupIndex := make(map[string]int)
+	for i, op := range req.Operations {
+		g, exists := groupIndex[op.SteamID]
+		if !exists {
+			g = len(groups)
+			groupIndex[op.SteamID] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+
+	results := make([]BatchItemResult, total)
+	semaphore := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	var done atomic.Int64
+
+	for _, group := range groups {
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func(group []int) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			for _, i := range group {
+				op := req.Operations[i]
+				if ctx.Err() != nil {
+					results[i] = BatchItemResult{
+						Index:   i,
+						ID:      op.ID,
+						Op:      op.Op,
+						SteamID: op.SteamID,
+						Skipped: true,
+						Error:   "Skipped: batch stopped",
+					}
+					continue
+				}
+
+				results[i] = runBatchOperation(ctx, i, op)
+				if !results[i].Success {
+					logWarn(ctx, "Batch operation %d (%s for %s) failed: %s", i, op.Op, op.SteamID, results[i].Error)
+					if req.StopOnError {
+						cancel()
+					}
+				}
+
+				if progress != nil {
+					progress(int(done.Add(1)), total)
+				}
+			}
+		}(group)
+	}
+
+	wg.Wait()
+
+	result := BatchResponse{
+		Total:   total,
+		Results: results,
+	}
+	for _, item := range results {
+		switch {
+		case item.Skipped:
+			result.Skipped++
+		case item.Success:
+			result.Succeeded++
+		default:
+			result.Failed++
+		}
+	}
+	result.Success = result.Failed == 0 && result.Skipped == 0
+
+	logInfo(ctx, "Batch completed: total=%d, succeeded=%d, failed=%d, skipped=%d",
+		result.Total, result.Succeeded, result.Failed, result.Skipped)
+	return result
+}
+
+func batchHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		logWarn(r.Context(), "Batch handler: method not allowed: %s", r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logWarn(r.Context(), "Batch handler: invalid JSON in POST request: %v", err)
+		writeError(w, r, ErrInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	if len(req.Operations) == 0 {
+		logWarn(r.Context(), "Batch handler: operations are required")
+		writeError(w, r, ErrInvalidRequest, "operations are required")
+		return
+	}
+	if r = requestServer(w, r, req.Server, "Batch"); r == nil {
+		return
+	}
+
+	// Большие пакеты можно выполнить в фоне как задачу
+	if req.Async {
+		req.Async = false
+		params, _ := json.Marshal(req)
+		job, err := jobs.Submit("batch", serverFrom(r.Context()).Name, params, requestActor(r))
+		if err != nil {
+			logError(r.Context(), "Batch handler: failed to submit batch job: %v", err)
+			writeResponseStatus(w, r, http.StatusServiceUnavailable, JobResponse{Success: false, Error: err.Error(), ErrorCode: ErrUnavailable})
+			return
+		}
+
+		logInfo(r.Context(), "Batch handler submitted %d operations as job %s", len(req.Operations), job.ID)
+		writeResponseStatus(w, r, http.StatusAccepted, JobResponse{Success: true, Job: &job})
+		return
+	}
+
+	logInfo(r.Context(), "Batch handler processing %d operations", len(req.Operations))
+	response := runBatch(withAuditActor(r.Context(), requestActor(r)), req, nil)
+	logInfo(r.Context(), "Batch handler response: Success=%t, Succeeded=%d, Failed=%d, Skipped=%d",
+		response.Success, response.Succeeded, response.Failed, response.Skipped)
+	writeResponse(w, r, response)
+}
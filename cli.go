@@ -0,0 +1,705 @@
+package main
+
+import (
+	"DinoAgentApi/api"
+	"DinoAgentApi/client"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"os/user"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// Утилита администрирования: те же операции, что и в API, либо через работающий агент (--remote),
+// либо напрямую над каталогами теми же функциями, что использует сервер
+
+const cliUsage = `Usage: agent <command> [flags]
+
+Commands:
+  serve                                   Run the HTTP agent (default without arguments)
+  servers list                            List configured server profiles
+  players list                            List player files
+  slots list <steamid>                    List slots of a player
+  transfer <steamid> <slot> [--force]     Save the current dinosaur into a slot
+  restore <steamid> <slot> [--force]      Restore a slot into the player file
+  backup list [--prefix <name>]           List backup files, newest first
+  backup restore <backup> --steamid <id> [--slot <slot>] [--allow-cross-target] [--force]
+                                          Restore a backup into a player or slot file; a backup
+                                          of another file needs --allow-cross-target
+  migrate <steamid> --to <server> [--move] [--on-conflict skip|overwrite|rename] [--dry-run] [--force]
+                                          Copy or move a player and all slots from --server to another profile
+  snapshot [--label <label>]              Copy all player and slot files into a snapshot
+  tui                                     Browse players and slots interactively (local only)
+
+Common flags:
+  --remote <url>     Call a running agent instead of the local directories (env DINO_AGENT_URL)
+  --api-key <key>    API key for --remote (env DINO_AGENT_API_KEY)
+  --server <name>    Server profile to operate on (env DINO_AGENT_SERVER, default profile if empty)
+  --timeout <dur>    Request timeout for --remote (default 30s)
+  --json             Print JSON instead of a table
+  --verbose          Print agent log messages to stderr
+
+Without --remote, commands that change files refuse to run while an agent answers on
+port 8080: player locks live inside one process and would not protect against its requests.
+`
+
+// adminBackend - набор операций CLI; *client.Client реализует их через HTTP
+type adminBackend interface {
+	ListServers(ctx context.Context) (*api.ServerListResponse, error)
+	ListPlayers(ctx context.Context) (*api.PlayerListResponse, error)
+	ListSlots(ctx context.Context, steamid string) (*api.SlotListResponse, error)
+	Transfer(ctx context.Context, steamid, slotID string, force bool) (*api.TransferResponse, error)
+	RestoreSlot(ctx context.Context, steamid, slotID string, force bool) (*api.RestoreSlotResponse, error)
+	ListBackups(ctx context.Context, prefix string) (*api.BackupListResponse, error)
+	RestoreBackup(ctx context.Context, name string, req api.BackupRestoreRequest) (*api.BackupRestoreResponse, error)
+	MigratePlayer(ctx context.Context, steamid string, req api.MigrateRequest) (*api.MigrateResponse, error)
+	Snapshot(ctx context.Context, label string) (*api.SnapshotResult, error)
+}
+
+type cliOptions struct {
+	remote      string
+	apiKey      string
+	server      string
+	timeout     time.Duration
+	json        bool
+	verbose     bool
+	force       bool
+	prefix      string
+	label       string
+	steamid     string
+	slot        string
+	to          string
+	move        bool
+	dryRun      bool
+	onConflict  string
+	crossTarget bool
+}
+
+type cliUsageError struct {
+	message string
+}
+
+func (e *cliUsageError) Error() string {
+	return e.message
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return &cliUsageError{message: fmt.Sprintf(format, args...)}
+}
+
+// flag останавливается на первом позиционном аргументе, а флаги удобно писать и после них
+func parseCLIArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func runCLI(args []string) int {
+	var opts cliOptions
+	fs := flag.NewFlagSet("agent", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&opts.remote, "remote", os.Getenv("DINO_AGENT_URL"), "")
+	fs.StringVar(&opts.apiKey, "api-key", os.Getenv("DINO_AGENT_API_KEY"), "")
+	fs.StringVar(&opts.server, "server", os.Getenv("DINO_AGENT_SERVER"), "")
+	fs.DurationVar(&opts.timeout, "timeout", 30*time.Second, "")
+	fs.BoolVar(&opts.json, "json", false, "")
+	fs.BoolVar(&opts.verbose, "verbose", false, "")
+	fs.BoolVar(&opts.force, "force", false, "")
+	fs.StringVar(&opts.prefix, "prefix", "", "")
+	fs.StringVar(&opts.label, "label", "", "")
+	fs.StringVar(&opts.steamid, "steamid", "", "")
+	fs.StringVar(&opts.slot, "slot", "", "")
+	fs.StringVar(&opts.to, "to", "", "")
+	fs.BoolVar(&opts.move, "move", false, "")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "")
+	fs.StringVar(&opts.onConflict, "on-conflict", "", "")
+	fs.BoolVar(&opts.crossTarget, "allow-cross-target", false, "")
+
+	positional, err := parseCLIArgs(fs, args)
+	if errors.Is(err, flag.ErrHelp) || (err == nil && (len(positional) == 0 || positional[0] == "help")) {
+		fmt.Print(cliUsage)
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n%s", err, cliUsage)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Интерфейс терминала перерисовывает экран, поэтому предупреждения агента в нём только мешают
+	logLevel := slog.LevelWarn
+	if positional[0] == "tui" {
+		logLevel = slog.LevelError
+	}
+	if opts.verbose {
+		logLevel = slog.LevelDebug
+	}
+	setupCLILogging(logLevel)
+
+	if positional[0] == "tui" {
+		if opts.remote != "" {
+			fmt.Fprintf(os.Stderr, "Error: tui works on the local directories only\n")
+			return 2
+		}
+		local, err := newLocalBackend(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		defer local.Close()
+		if ctx, err = local.selectServer(ctx, opts.server); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		if err := runTUI(ctx, local, os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	var backend adminBackend
+	if opts.remote != "" {
+		c, err := client.New(opts.remote, client.WithAPIKey(opts.apiKey), client.WithTimeout(opts.timeout), client.WithServer(opts.server))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		backend = remoteBackend{Client: c}
+	} else {
+		local, err := newLocalBackend(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		defer local.Close()
+		if ctx, err = local.selectServer(ctx, opts.server); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		backend = local
+	}
+
+	err = runCLICommand(ctx, backend, opts, positional)
+	var usageErr *cliUsageError
+	switch {
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(os.Stderr, "Error: %v\n\n%s", err, cliUsage)
+		return 2
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runCLICommand(ctx context.Context, backend adminBackend, opts cliOptions, args []string) error {
+	command := args[0]
+	if len(args) > 1 && (command == "servers" || command == "players" || command == "slots" || command == "backup") {
+		command += " " + args[1]
+		args = args[1:]
+	}
+	args = args[1:]
+
+	expect := func(names ...string) error {
+		if len(args) != len(names) {
+			return usageErrorf("%s expects %d argument(s): %v", command, len(names), names)
+		}
+		return nil
+	}
+
+	switch command {
+	case "servers list":
+		if err := expect(); err != nil {
+			return err
+		}
+		resp, err := backend.ListServers(ctx)
+		if err != nil {
+			return err
+		}
+		return printCLIResult(opts, resp, func(w *tabwriter.Writer) {
+			fmt.Fprintln(w, "NAME\tDEFAULT\tRCON\tPLAYERS DIR\tSLOTS DIR")
+			for _, server := range resp.Servers {
+				fmt.Fprintf(w, "%s\t%t\t%t\t%s\t%s\n", server.Name, server.Default, server.RCON, server.PlayersDir, server.SlotsDir)
+			}
+		})
+
+	case "players list":
+		if err := expect(); err != nil {
+			return err
+		}
+		resp, err := backend.ListPlayers(ctx)
+		if err != nil {
+			return err
+		}
+		return printCLIResult(opts, resp, func(w *tabwriter.Writer) {
+			fmt.Fprintln(w, "STEAMID\tSIZE\tMODIFIED")
+			for _, player := range resp.Players {
+				fmt.Fprintf(w, "%s\t%d\t%s\n", player.SteamID, player.Size, formatCLITime(player.ModTime))
+			}
+		})
+
+	case "slots list":
+		if err := expect("steamid"); err != nil {
+			return err
+		}
+		resp, err := backend.ListSlots(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		return printCLIResult(opts, resp, func(w *tabwriter.Writer) {
+			fmt.Fprintln(w, "SLOT\tSIZE\tMODIFIED")
+			for _, slot := range resp.Slots {
+				fmt.Fprintf(w, "%s\t%d\t%s\n", slot.SlotID, slot.Size, formatCLITime(slot.ModTime))
+			}
+		})
+
+	case "transfer":
+		if err := expect("steamid", "slot"); err != nil {
+			return err
+		}
+		resp, err := backend.Transfer(ctx, args[0], args[1], opts.force)
+		if err != nil {
+			return err
+		}
+		return printCLIResult(opts, resp, func(w *tabwriter.Writer) {
+			fmt.Fprintf(w, "%s\nplayer file:\t%s\nslot file:\t%s\n", resp.Message, resp.PlayerFile, resp.SlotFile)
+		})
+
+	case "restore":
+		if err := expect("steamid", "slot"); err != nil {
+			return err
+		}
+		resp, err := backend.RestoreSlot(ctx, args[0], args[1], opts.force)
+		if err != nil {
+			return err
+		}
+		return printCLIResult(opts, resp, func(w *tabwriter.Writer) {
+			fmt.Fprintf(w, "%s\nplayer file:\t%s\nslot file:\t%s\n", resp.Message, resp.PlayerFile, resp.SlotFile)
+		})
+
+	case "backup list":
+		if err := expect(); err != nil {
+			return err
+		}
+		resp, err := backend.ListBackups(ctx, opts.prefix)
+		if err != nil {
+			return err
+		}
+		return printCLIResult(opts, resp, func(w *tabwriter.Writer) {
+			fmt.Fprintln(w, "NAME\tSIZE\tMODIFIED")
+			for _, backup := range resp.Backups {
+				fmt.Fprintf(w, "%s\t%d\t%s\n", backup.Name, backup.Size, formatCLITime(backup.ModTime))
+			}
+		})
+
+	case "backup restore":
+		if err := expect("backup"); err != nil {
+			return err
+		}
+		if opts.steamid == "" {
+			return usageErrorf("backup restore requires --steamid (and --slot to restore into a slot file)")
+		}
+		req := api.BackupRestoreRequest{SteamID: opts.steamid, SlotID: opts.slot, Force: opts.force, AllowCrossTarget: opts.crossTarget}
+		resp, err := backend.RestoreBackup(ctx, args[0], req)
+		if err != nil {
+			return err
+		}
+		return printCLIResult(opts, resp, func(w *tabwriter.Writer) {
+			fmt.Fprintf(w, "%s\nfile:\t%s\n", resp.Message, resp.FilePath)
+		})
+
+	case "migrate":
+		if err := expect("steamid"); err != nil {
+			return err
+		}
+		if opts.to == "" {
+			return usageErrorf("migrate requires --to <server>")
+		}
+		req := api.MigrateRequest{To: opts.to, Mode: migrateCopy, OnConflict: opts.onConflict, DryRun: opts.dryRun, Force: opts.force}
+		if opts.move {
+			req.Mode = migrateMove
+		}
+		resp, err := backend.MigratePlayer(ctx, args[0], req)
+		if err != nil {
+			return err
+		}
+		return printCLIResult(opts, resp, func(w *tabwriter.Writer) {
+			fmt.Fprintln(w, resp.Message)
+			fmt.Fprintln(w, "ACTION	SOURCE	TARGET	BACKUP")
+			for _, file := range resp.Files {
+				fmt.Fprintf(w, "%s	%s	%s	%s\n", file.Action, file.Source, file.Target, file.BackupPath)
+			}
+		})
+
+	case "snapshot":
+		if err := expect(); err != nil {
+			return err
+		}
+		resp, err := backend.Snapshot(ctx, opts.label)
+		if err != nil {
+			return err
+		}
+		return printCLIResult(opts, resp, func(w *tabwriter.Writer) {
+			fmt.Fprintln(w, "PATH\tPLAYERS\tSLOTS\tBYTES")
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", resp.Path, resp.Players, resp.Slots, resp.Bytes)
+		})
+	}
+
+	return usageErrorf("unknown command %q", command)
+}
+
+func printCLIResult(opts cliOptions, result interface{}, table func(w *tabwriter.Writer)) error {
+	if opts.json {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+func formatCLITime(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// Вывод команды идёт в stdout, поэтому журнал агента пишем в stderr
+func setupCLILogging(level slog.Level) {
+	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	slog.SetDefault(slog.New(contextHandler{handler}))
+}
+
+type remoteBackend struct {
+	*client.Client
+}
+
+// Снимок на удалённом агенте выполняется фоновой задачей, дожидаемся её завершения
+func (b remoteBackend) Snapshot(ctx context.Context, label string) (*api.SnapshotResult, error) {
+	resp, err := b.SubmitJob(ctx, "snapshot", SnapshotRequest{Label: label})
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := b.WaitJob(ctx, resp.Job.ID, 500*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != jobSucceeded {
+		return nil, fmt.Errorf("snapshot job %s %s: %s", job.ID, job.Status, job.Error)
+	}
+
+	var result api.SnapshotResult
+	if err := json.Unmarshal(job.Result, &result); err != nil {
+		return nil, fmt.Errorf("invalid snapshot job result: %v", err)
+	}
+	return &result, nil
+}
+
+type localBackend struct {
+	actor AuditActor
+}
+
+func newLocalBackend(ctx context.Context) (*localBackend, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	config = cfg
+
+	if err := setupServers(ctx); err != nil {
+		return nil, fmt.Errorf("invalid servers config: %v", err)
+	}
+	webhooks.Start()
+
+	caller := "cli"
+	if current, err := user.Current(); err == nil {
+		caller = "cli:" + current.Username
+	}
+	logInfo(ctx, "CLI: operating on local directories as %s", caller)
+	return &localBackend{actor: AuditActor{Caller: caller}}, nil
+}
+
+func (b *localBackend) Close() {
+	timeout := time.Duration(config.ShutdownTimeoutSeconds) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	webhooks.Shutdown(ctx)
+	closeServers()
+	auditLog.Close()
+}
+
+// Локальные операции идут на выбранный профиль так же, как запросы с параметром server
+func (b *localBackend) selectServer(ctx context.Context, name string) (context.Context, error) {
+	srv, ok := lookupServer(name)
+	if !ok {
+		return ctx, fmt.Errorf("unknown server %q", name)
+	}
+	return withServer(ctx, srv), nil
+}
+
+// Ошибки локальных операций оформляем так же, как ответы удалённого агента
+func localResult(result api.Result) error {
+	if failure := result.Failure(); failure != nil {
+		return &client.Error{StatusCode: statusForCode(failure.Code), Code: failure.Code, Message: failure.Message}
+	}
+	return nil
+}
+
+func localCheckIDs(ids ...string) error {
+	for _, id := range ids {
+		if !validID(id) {
+			return &client.Error{StatusCode: statusForCode(ErrInvalidID), Code: ErrInvalidID, Message: "Invalid identifier: " + id}
+		}
+	}
+	return nil
+}
+
+// Блокировки игроков живут внутри одного процесса: локальное изменение при запущенном агенте
+// могло бы пересечься с его запросами, поэтому такие команды идут через --remote
+func localAgentStopped() error {
+	addr := net.JoinHostPort("127.0.0.1", strings.TrimPrefix(agentPort, ":"))
+	conn, err := net.DialTimeout("tcp", addr, 500*time.Millisecond)
+	if err != nil {
+		return nil
+	}
+	conn.Close()
+	return &client.Error{StatusCode: statusForCode(ErrConflict), Code: ErrConflict,
+		Message: "An agent is running on " + addr + ", use --remote to change files through it"}
+}
+
+func localPresence(ctx context.Context, steamid string, force bool) error {
+	if err := ensurePlayerOffline(ctx, steamid, force); err != nil {
+		code := errorCodeFor(err)
+		return &client.Error{StatusCode: statusForCode(code), Code: code, Message: err.Error()}
+	}
+	return nil
+}
+
+func (b *localBackend) ListServers(ctx context.Context) (*api.ServerListResponse, error) {
+	return &api.ServerListResponse{Success: true, Servers: listServers()}, nil
+}
+
+func (b *localBackend) ListPlayers(ctx context.Context) (*api.PlayerListResponse, error) {
+	players, err := listPlayers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &api.PlayerListResponse{Success: true, Players: players}, nil
+}
+
+func (b *localBackend) ListSlots(ctx context.Context, steamid string) (*api.SlotListResponse, error) {
+	if err := localCheckIDs(steamid); err != nil {
+		return nil, err
+	}
+	slots, err := listPlayerSlots(ctx, steamid)
+	if err != nil {
+		return nil, err
+	}
+	return &api.SlotListResponse{Success: true, SteamID: steamid, Slots: slots}, nil
+}
+
+func (b *localBackend) Transfer(ctx context.Context, steamid, slotID string, force bool) (*api.TransferResponse, error) {
+	if err := localAgentStopped(); err != nil {
+		return nil, err
+	}
+	if err := localCheckIDs(steamid, slotID); err != nil {
+		return nil, err
+	}
+	if err := localPresence(ctx, steamid, force); err != nil {
+		return nil, err
+	}
+
+	unlock := lockPlayer(ctx, steamid)
+	defer unlock()
+	audit := beginAuditAs(ctx, b.actor, "transfer", steamid, slotID, playerFilePath(ctx, steamid), slotFilePath(ctx, steamid, slotID)).details("cli")
+	response := transferPlayerSlot(ctx, steamid, slotID)
+	audit.finish(response.Success, response.Error)
+	return &response, localResult(response)
+}
+
+func (b *localBackend) RestoreSlot(ctx context.Context, steamid, slotID string, force bool) (*api.RestoreSlotResponse, error) {
+	if err := localAgentStopped(); err != nil {
+		return nil, err
+	}
+	if err := localCheckIDs(steamid, slotID); err != nil {
+		return nil, err
+	}
+	if err := localPresence(ctx, steamid, force); err != nil {
+		return nil, err
+	}
+
+	unlock := lockPlayer(ctx, steamid)
+	defer unlock()
+	audit := beginAuditAs(ctx, b.actor, "restore-slot", steamid, slotID, playerFilePath(ctx, steamid), slotFilePath(ctx, steamid, slotID)).details("cli")
+	response := restoreSlotFromFile(ctx, steamid, slotID)
+	audit.finish(response.Success, response.Error)
+	return &response, localResult(response)
+}
+
+func (b *localBackend) EmptySlot(ctx context.Context, steamid, slotID string) (*api.EmptySlotResponse, error) {
+	if err := localAgentStopped(); err != nil {
+		return nil, err
+	}
+	if err := localCheckIDs(steamid, slotID); err != nil {
+		return nil, err
+	}
+
+	unlock := lockPlayer(ctx, steamid)
+	defer unlock()
+	audit := beginAuditAs(ctx, b.actor, "empty-slot", steamid, slotID, slotFilePath(ctx, steamid, slotID)).details("cli")
+	response := createEmptySlot(ctx, steamid, slotID)
+	audit.finish(response.Success, response.Error)
+	return &response, localResult(response)
+}
+
+func (b *localBackend) DeleteSlotFile(ctx context.Context, steamid, slotID string) (*api.DeleteFileResponse, error) {
+	if err := localAgentStopped(); err != nil {
+		return nil, err
+	}
+	if err := localCheckIDs(steamid, slotID); err != nil {
+		return nil, err
+	}
+
+	unlock := lockPlayer(ctx, steamid)
+	defer unlock()
+	audit := beginAuditAs(ctx, b.actor, "delete-slot-file", steamid, slotID, slotFilePath(ctx, steamid, slotID)).details("cli")
+	response := deleteSlotFile(ctx, steamid, slotID)
+	audit.finish(response.Success, response.Error)
+	return &response, localResult(response)
+}
+
+func (b *localBackend) DeletePlayerFile(ctx context.Context, steamid string, force bool) (*api.DeleteFileResponse, error) {
+	if err := localAgentStopped(); err != nil {
+		return nil, err
+	}
+	if err := localCheckIDs(steamid); err != nil {
+		return nil, err
+	}
+	if err := localPresence(ctx, steamid, force); err != nil {
+		return nil, err
+	}
+
+	unlock := lockPlayer(ctx, steamid)
+	defer unlock()
+	audit := beginAuditAs(ctx, b.actor, "delete-player-file", steamid, "", playerFilePath(ctx, steamid)).details("cli")
+	response := deletePlayerFile(ctx, steamid)
+	audit.finish(response.Success, response.Error)
+	return &response, localResult(response)
+}
+
+func (b *localBackend) ListBackups(ctx context.Context, prefix string) (*api.BackupListResponse, error) {
+	backups, err := listBackups(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return &api.BackupListResponse{Success: true, Backups: backups}, nil
+}
+
+func (b *localBackend) RestoreBackup(ctx context.Context, name string, req api.BackupRestoreRequest) (*api.BackupRestoreResponse, error) {
+	if err := localAgentStopped(); err != nil {
+		return nil, err
+	}
+	ids := []string{name, req.SteamID}
+	target := playerFilePath(ctx, req.SteamID)
+	if req.SlotID != "" {
+		ids = append(ids, req.SlotID)
+		target = slotFilePath(ctx, req.SteamID, req.SlotID)
+	}
+	if err := localCheckIDs(ids...); err != nil {
+		return nil, err
+	}
+	if err := localPresence(ctx, req.SteamID, req.Force); err != nil {
+		return nil, err
+	}
+
+	unlock := lockPlayer(ctx, req.SteamID)
+	defer unlock()
+	audit := beginAuditAs(ctx, b.actor, "restore-backup", req.SteamID, req.SlotID, target).details("cli backup=%s", name)
+	response := restoreBackup(ctx, name, req.SteamID, req.SlotID, req.AllowCrossTarget)
+	audit.finish(response.Success, response.Error)
+	return &response, localResult(response)
+}
+
+func (b *localBackend) MigratePlayer(ctx context.Context, steamid string, req api.MigrateRequest) (*api.MigrateResponse, error) {
+	if err := localCheckIDs(steamid); err != nil {
+		return nil, err
+	}
+	from := serverFrom(ctx)
+	if req.From != "" {
+		var ok bool
+		if from, ok = lookupServer(req.From); !ok {
+			return nil, &client.Error{StatusCode: statusForCode(ErrNotFound), Code: ErrNotFound, Message: "Unknown server: " + req.From}
+		}
+	}
+	to, ok := lookupServer(req.To)
+	if !ok {
+		return nil, &client.Error{StatusCode: statusForCode(ErrNotFound), Code: ErrNotFound, Message: "Unknown server: " + req.To}
+	}
+	if !req.DryRun {
+		if err := localAgentStopped(); err != nil {
+			return nil, err
+		}
+		if req.Mode == migrateMove {
+			if err := localPresence(withServer(ctx, from), steamid, req.Force); err != nil {
+				return nil, err
+			}
+		}
+		if err := localPresence(withServer(ctx, to), steamid, req.Force); err != nil {
+			return nil, err
+		}
+	}
+
+	unlock := lockPlayerOnServers(ctx, from, to, steamid)
+	defer unlock()
+	plan, response := planMigration(ctx, steamid, from, to, req.Mode, req.OnConflict)
+	if plan == nil {
+		return &response, localResult(response)
+	}
+	if req.DryRun {
+		response = plan.run(ctx, true)
+		return &response, nil
+	}
+
+	audit := beginAuditAs(withServer(ctx, to), b.actor, "migrate-player", steamid, "", plan.paths()...).
+		details("cli from=%s to=%s mode=%s on_conflict=%s", from.Name, to.Name, plan.mode, plan.onConflict)
+	response = plan.run(ctx, false)
+	audit.finish(response.Success, response.Error)
+	return &response, localResult(response)
+}
+
+func (b *localBackend) Snapshot(ctx context.Context, label string) (*api.SnapshotResult, error) {
+	result, err := createSnapshot(ctx, label, func(done, total int, message string) {
+		fmt.Fprintf(os.Stderr, "\r%d/%d files", done, total)
+		if done == total {
+			fmt.Fprintln(os.Stderr)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
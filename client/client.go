@@ -0,0 +1,370 @@
+// Package client - Go клиент агента поверх структур из пакета api.
+package client
+
+import (
+	"DinoAgentApi/api"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+	defaultRetries = 2
+	retryBaseDelay = 200 * time.Millisecond
+	retryMaxDelay  = 2 * time.Second
+)
+
+// Error - ошибка, которую вернул агент: HTTP статус, код и X-Request-ID для поиска в логах
+type Error struct {
+	StatusCode int
+	Code       api.ErrorCode
+	Message    string
+	RequestID  string
+}
+
+func (e *Error) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("agent: %s (%d %s, request %s)", e.Message, e.StatusCode, e.Code, e.RequestID)
+	}
+	return fmt.Sprintf("agent: %s (%d %s)", e.Message, e.StatusCode, e.Code)
+}
+
+// IsCode сообщает, что err - ошибка агента с данным кодом
+func IsCode(err error, code api.ErrorCode) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	apiKey     string
+	bearer     string
+	server     string
+	timeout    time.Duration
+	retries    int
+}
+
+type Option func(*Client)
+
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.apiKey = key }
+}
+
+func WithBearerToken(token string) Option {
+	return func(c *Client) { c.bearer = token }
+}
+
+// WithServer направляет все запросы на профиль сервера агента; пустое имя - профиль по умолчанию
+func WithServer(name string) Option {
+	return func(c *Client) { c.server = name }
+}
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithTimeout ограничивает одну попытку запроса; 0 - без ограничения, кроме контекста
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) { c.timeout = timeout }
+}
+
+func WithRetries(retries int) Option {
+	return func(c *Client) {
+		if retries < 0 {
+			retries = 0
+		}
+		c.retries = retries
+	}
+}
+
+func New(baseURL string, opts ...Option) (*Client, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		timeout:    defaultTimeout,
+		retries:    defaultRetries,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+func (c *Client) Check(ctx context.Context, steamID string) (*api.CheckResponse, error) {
+	var resp api.CheckResponse
+	err := c.do(ctx, "/check", api.CheckRequest{SteamID: steamID}, false, &resp)
+	return &resp, err
+}
+
+func (c *Client) PlayerFile(ctx context.Context, steamID string) (*api.FileContentResponse, error) {
+	var resp api.FileContentResponse
+	err := c.do(ctx, "/player-file", api.CheckRequest{SteamID: steamID}, false, &resp)
+	return &resp, err
+}
+
+func (c *Client) SlotFile(ctx context.Context, steamID, slotID string) (*api.FileContentResponse, error) {
+	var resp api.FileContentResponse
+	err := c.do(ctx, "/slot-file", api.CheckRequest{SteamID: steamID, SlotID: slotID}, false, &resp)
+	return &resp, err
+}
+
+func (c *Client) ListSlots(ctx context.Context, steamID string) (*api.SlotListResponse, error) {
+	var resp api.SlotListResponse
+	err := c.send(ctx, "GET", "/v2/players/"+url.PathEscape(steamID)+"/slots", nil, true, &resp)
+	return &resp, err
+}
+
+func (c *Client) Transfer(ctx context.Context, steamID, slotID string, force bool) (*api.TransferResponse, error) {
+	var resp api.TransferResponse
+	err := c.do(ctx, "/transfer", api.CheckRequest{SteamID: steamID, OldSlotID: slotID, Force: force}, true, &resp)
+	return &resp, err
+}
+
+func (c *Client) EmptySlot(ctx context.Context, steamID, slotID string) (*api.EmptySlotResponse, error) {
+	var resp api.EmptySlotResponse
+	err := c.do(ctx, "/empty-slot", api.CheckRequest{SteamID: steamID, OldSlotID: slotID}, true, &resp)
+	return &resp, err
+}
+
+func (c *Client) RestoreSlot(ctx context.Context, steamID, slotID string, force bool) (*api.RestoreSlotResponse, error) {
+	var resp api.RestoreSlotResponse
+	err := c.do(ctx, "/restore-slot", api.CheckRequest{SteamID: steamID, SlotID: slotID, Force: force}, true, &resp)
+	return &resp, err
+}
+
+func (c *Client) WriteSlot(ctx context.Context, req api.WriteSlotRequest) (*api.WriteSlotResponse, error) {
+	var resp api.WriteSlotResponse
+	err := c.do(ctx, "/write-slot", req, true, &resp)
+	return &resp, err
+}
+
+func (c *Client) FileInfo(ctx context.Context, filePath string) (*api.FileInfoResponse, error) {
+	var resp api.FileInfoResponse
+	err := c.do(ctx, "/file-info", api.FilePathRequest{FilePath: filePath}, false, &resp)
+	return &resp, err
+}
+
+func (c *Client) FileContent(ctx context.Context, filePath string) (*api.FileContentByPathResponse, error) {
+	var resp api.FileContentByPathResponse
+	err := c.do(ctx, "/file-content", api.FilePathRequest{FilePath: filePath}, false, &resp)
+	return &resp, err
+}
+
+func (c *Client) WriteFile(ctx context.Context, req api.WriteFileRequest) (*api.WriteFileResponse, error) {
+	var resp api.WriteFileResponse
+	err := c.do(ctx, "/write-file", req, true, &resp)
+	return &resp, err
+}
+
+func (c *Client) DeleteFile(ctx context.Context, req api.DeleteFileRequest) (*api.DeleteFileResponse, error) {
+	var resp api.DeleteFileResponse
+	err := c.do(ctx, "/delete-file", req, true, &resp)
+	return &resp, err
+}
+
+func (c *Client) DeletePlayerFile(ctx context.Context, steamID string, force bool) (*api.DeleteFileResponse, error) {
+	var resp api.DeleteFileResponse
+	err := c.do(ctx, "/delete-player-file", api.CheckRequest{SteamID: steamID, Force: force}, true, &resp)
+	return &resp, err
+}
+
+func (c *Client) DeleteSlotFile(ctx context.Context, steamID, slotID string) (*api.DeleteFileResponse, error) {
+	var resp api.DeleteFileResponse
+	err := c.do(ctx, "/delete-slot-file", api.CheckRequest{SteamID: steamID, SlotID: slotID}, true, &resp)
+	return &resp, err
+}
+
+func (c *Client) ListServers(ctx context.Context) (*api.ServerListResponse, error) {
+	var resp api.ServerListResponse
+	err := c.send(ctx, "GET", "/v2/servers", nil, true, &resp)
+	return &resp, err
+}
+
+func (c *Client) ListPlayers(ctx context.Context) (*api.PlayerListResponse, error) {
+	var resp api.PlayerListResponse
+	err := c.send(ctx, "GET", "/v2/players", nil, true, &resp)
+	return &resp, err
+}
+
+func (c *Client) ListBackups(ctx context.Context, prefix string) (*api.BackupListResponse, error) {
+	var resp api.BackupListResponse
+	err := c.send(ctx, "GET", "/v2/backups?prefix="+url.QueryEscape(prefix), nil, true, &resp)
+	return &resp, err
+}
+
+func (c *Client) RestoreBackup(ctx context.Context, name string, req api.BackupRestoreRequest) (*api.BackupRestoreResponse, error) {
+	var resp api.BackupRestoreResponse
+	err := c.do(ctx, "/v2/backups/"+url.PathEscape(name)+"/restore", req, true, &resp)
+	return &resp, err
+}
+
+func (c *Client) MigratePlayer(ctx context.Context, steamID string, req api.MigrateRequest) (*api.MigrateResponse, error) {
+	var resp api.MigrateResponse
+	err := c.do(ctx, "/v2/players/"+url.PathEscape(steamID)+"/migrate", req, true, &resp)
+	return &resp, err
+}
+
+func (c *Client) SubmitJob(ctx context.Context, jobType string, params interface{}) (*api.JobResponse, error) {
+	req := api.JobSubmitRequest{Type: jobType}
+	if params != nil {
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("encode job params: %w", err)
+		}
+		req.Params = encoded
+	}
+	var resp api.JobResponse
+	err := c.do(ctx, "/jobs", req, true, &resp)
+	return &resp, err
+}
+
+func (c *Client) Job(ctx context.Context, id string) (*api.JobResponse, error) {
+	var resp api.JobResponse
+	err := c.send(ctx, "GET", "/jobs/"+url.PathEscape(id), nil, true, &resp)
+	return &resp, err
+}
+
+// WaitJob опрашивает задачу, пока она не завершится; неудачная задача возвращается без ошибки
+func (c *Client) WaitJob(ctx context.Context, id string, interval time.Duration) (*api.Job, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		resp, err := c.Job(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Job == nil {
+			return nil, fmt.Errorf("job %s: empty response", id)
+		}
+		if resp.Job.FinishedAt != nil {
+			return resp.Job, nil
+		}
+		select {
+		case <-ctx.Done():
+			return resp.Job, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// POST с JSON телом; v1 маршруты вызываем без префикса /v1/, чтобы X-API-Version: 2 включил конверт ошибок
+func (c *Client) do(ctx context.Context, path string, request interface{}, mutation bool, response api.Result) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+	return c.send(ctx, "POST", path, body, !mutation, response)
+}
+
+func (c *Client) send(ctx context.Context, method, path string, body []byte, idempotent bool, response api.Result) error {
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		status, retry, err := c.attempt(ctx, method, path, body, response)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+
+		// 503 значит, что агент запрос не выполнял, поэтому его повторяем всегда;
+		// обрыв связи, 502 и 504 - только для чтения, мутация могла уже примениться
+		if !retry || (!idempotent && status != http.StatusServiceUnavailable) || attempt >= c.retries || ctx.Err() != nil {
+			return lastErr
+		}
+
+		delay := retryBaseDelay << attempt
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return lastErr
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, method, path string, body []byte, response api.Result) (int, bool, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	target := c.baseURL + path
+	if c.server != "" {
+		separator := "?"
+		if strings.Contains(path, "?") {
+			separator = "&"
+		}
+		target += separator + "server=" + url.QueryEscape(c.server)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-API-Version", "2")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	if c.bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+c.bearer)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, true, fmt.Errorf("read response: %w", err)
+	}
+
+	requestID := resp.Header.Get("X-Request-ID")
+	retry := resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusGatewayTimeout
+
+	if resp.StatusCode >= 400 {
+		var envelope api.ErrorEnvelope
+		if json.Unmarshal(data, &envelope) != nil || envelope.Error.Code == "" {
+			envelope.Error = api.APIError{Code: api.ErrInternal, Message: strings.TrimSpace(string(data))}
+			if envelope.Error.Message == "" {
+				envelope.Error.Message = http.StatusText(resp.StatusCode)
+			}
+		}
+		return resp.StatusCode, retry, &Error{StatusCode: resp.StatusCode, Code: envelope.Error.Code, Message: envelope.Error.Message, RequestID: requestID}
+	}
+
+	if err := json.Unmarshal(data, response); err != nil {
+		return resp.StatusCode, false, fmt.Errorf("decode response: %w", err)
+	}
+	// Ответ 2xx с ошибкой внутри (например, CheckResponse) тоже возвращаем как Error
+	if failure := response.Failure(); failure != nil {
+		return resp.StatusCode, false, &Error{StatusCode: resp.StatusCode, Code: failure.Code, Message: failure.Message, RequestID: requestID}
+	}
+	return resp.StatusCode, false, nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"DinoAgentApi/api"
+	"DinoAgentApi/client"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSteamID = "76561198000000001"
+
+// Агент с настоящими обработчиками и middleware на временных каталогах с двумя профилями серверов.
+// Каталоги бэкапов и истории заданы константами, поэтому тест работает из временного рабочего каталога.
+func newTestAgent(t *testing.T) *httptest.Server {
+	t.Helper()
+	registerTestRoutes()
+	t.Chdir(t.TempDir())
+
+	savedConfig, savedServers, savedDefault := config, gameServers, defaultServer
+	config = defaultConfig()
+	config.Audit.File = filepath.Join("audit", "audit.jsonl")
+	config.Servers = []ServerProfile{
+		{Name: "survival", PlayersDir: filepath.Join("survival", "Players"), SlotsDir: filepath.Join("survival", "Slots")},
+		{Name: "event", PlayersDir: filepath.Join("event", "Players"), SlotsDir: filepath.Join("event", "Slots")},
+	}
+	if err := setupServers(context.Background()); err != nil {
+		t.Fatalf("setupServers: %v", err)
+	}
+
+	server := httptest.NewServer(newAgentHandler())
+	t.Cleanup(func() {
+		server.Close()
+		closeServers()
+		auditLog.Close()
+		config, gameServers, defaultServer = savedConfig, savedServers, savedDefault
+	})
+	return server
+}
+
+func newTestClient(t *testing.T, server *httptest.Server, opts ...client.Option) *client.Client {
+	t.Helper()
+	c, err := client.New(server.URL, opts...)
+	if err != nil {
+		t.Fatalf("client.New: %v", err)
+	}
+	return c
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientListPlayersAndSlots(t *testing.T) {
+	server := newTestAgent(t)
+	c := newTestClient(t, server)
+	writeTestFile(t, filepath.Join("survival", "Players", testSteamID+".json"), `{"dino":"rex"}`)
+	writeTestFile(t, filepath.Join("survival", "Slots", testSteamID, "1.json"), `{"slot_id":"1"}`)
+	writeTestFile(t, filepath.Join("survival", "Slots", testSteamID, "2.json"), `{"slot_id":"2"}`)
+
+	players, err := c.ListPlayers(context.Background())
+	if err != nil {
+		t.Fatalf("ListPlayers: %v", err)
+	}
+	if len(players.Players) != 1 || players.Players[0].SteamID != testSteamID {
+		t.Fatalf("ListPlayers = %+v, want only %s", players.Players, testSteamID)
+	}
+
+	slots, err := c.ListSlots(context.Background(), testSteamID)
+	if err != nil {
+		t.Fatalf("ListSlots: %v", err)
+	}
+	if len(slots.Slots) != 2 || slots.Slots[0].SlotID != "1" || slots.Slots[1].SlotID != "2" {
+		t.Fatalf("ListSlots = %+v, want slots 1 and 2", slots.Slots)
+	}
+}
+
+func TestClientTransferAndRestore(t *testing.T) {
+	server := newTestAgent(t)
+	c := newTestClient(t, server)
+	playerFile := filepath.Join("survival", "Players", testSteamID+".json")
+	slotFile := filepath.Join("survival", "Slots", testSteamID, "3.json")
+	writeTestFile(t, playerFile, `{"dino":"rex"}`)
+
+	transfer, err := c.Transfer(context.Background(), testSteamID, "3", false)
+	if err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if !transfer.Success {
+		t.Fatalf("Transfer = %+v, want success", transfer)
+	}
+	if _, err := os.Stat(slotFile); err != nil {
+		t.Fatalf("slot file after transfer: %v", err)
+	}
+	if _, err := os.Stat(playerFile); !os.IsNotExist(err) {
+		t.Fatalf("player file after transfer: %v, want removed", err)
+	}
+
+	restore, err := c.RestoreSlot(context.Background(), testSteamID, "3", false)
+	if err != nil {
+		t.Fatalf("RestoreSlot: %v", err)
+	}
+	if !restore.Success {
+		t.Fatalf("RestoreSlot = %+v, want success", restore)
+	}
+	if _, err := os.Stat(playerFile); err != nil {
+		t.Fatalf("player file after restore: %v", err)
+	}
+}
+
+func TestClientErrorEnvelope(t *testing.T) {
+	server := newTestAgent(t)
+	c := newTestClient(t, server)
+
+	_, err := c.PlayerFile(context.Background(), testSteamID)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("PlayerFile error = %v, want *client.Error", err)
+	}
+	if apiErr.StatusCode != http.StatusNotFound || apiErr.Code != ErrNotFound || apiErr.RequestID == "" {
+		t.Fatalf("PlayerFile error = %+v, want 404 %s with request ID", apiErr, ErrNotFound)
+	}
+
+	_, err = c.ListSlots(context.Background(), "../..")
+	if !client.IsCode(err, ErrInvalidID) {
+		t.Fatalf("ListSlots error = %v, want %s", err, ErrInvalidID)
+	}
+}
+
+func TestClientServerParameter(t *testing.T) {
+	server := newTestAgent(t)
+	writeTestFile(t, filepath.Join("event", "Players", testSteamID+".json"), `{"dino":"rex"}`)
+
+	players, err := newTestClient(t, server).ListPlayers(context.Background())
+	if err != nil {
+		t.Fatalf("ListPlayers on default server: %v", err)
+	}
+	if len(players.Players) != 0 {
+		t.Fatalf("ListPlayers on default server = %+v, want none", players.Players)
+	}
+
+	event := newTestClient(t, server, client.WithServer("event"))
+	players, err = event.ListPlayers(context.Background())
+	if err != nil {
+		t.Fatalf("ListPlayers on event: %v", err)
+	}
+	if len(players.Players) != 1 || players.Players[0].SteamID != testSteamID {
+		t.Fatalf("ListPlayers on event = %+v, want only %s", players.Players, testSteamID)
+	}
+
+	// v1 запросы тоже идут на выбранный сервер
+	check, err := event.Check(context.Background(), testSteamID)
+	if err != nil {
+		t.Fatalf("Check on event: %v", err)
+	}
+	if !check.Exists {
+		t.Fatalf("Check on event = %+v, want exists", check)
+	}
+
+	_, err = newTestClient(t, server, client.WithServer("nope")).ListPlayers(context.Background())
+	if !client.IsCode(err, ErrNotFound) {
+		t.Fatalf("ListPlayers on unknown server error = %v, want %s", err, ErrNotFound)
+	}
+}
+
+func TestRouteMetricsWithServerParameter(t *testing.T) {
+	server := newTestAgent(t)
+	labels := labelKey([]string{"GET /v2/servers", "GET", "200"})
+	count := func() float64 {
+		httpRequestsTotal.mu.Lock()
+		defer httpRequestsTotal.mu.Unlock()
+		return httpRequestsTotal.values[labels]
+	}
+
+	before := count()
+	if _, err := newTestClient(t, server, client.WithServer("event")).ListServers(context.Background()); err != nil {
+		t.Fatalf("ListServers: %v", err)
+	}
+	if after := count(); after != before+1 {
+		t.Fatalf("requests for route GET /v2/servers = %v, want %v", after, before+1)
+	}
+}
+
+func TestClientBackupsPerServer(t *testing.T) {
+	server := newTestAgent(t)
+	clients := map[string]*client.Client{
+		"survival": newTestClient(t, server),
+		"event":    newTestClient(t, server, client.WithServer("event")),
+	}
+
+	// Один и тот же игрок на двух серверах удаляется в одну секунду: бэкапы не должны совпасть
+	for name, c := range clients {
+		writeTestFile(t, filepath.Join(name, "Players", testSteamID+".json"), `{"server":"`+name+`"}`)
+		if _, err := c.DeletePlayerFile(context.Background(), testSteamID, false); err != nil {
+			t.Fatalf("DeletePlayerFile on %s: %v", name, err)
+		}
+	}
+
+	for name, c := range clients {
+		backups, err := c.ListBackups(context.Background(), testSteamID)
+		if err != nil {
+			t.Fatalf("ListBackups on %s: %v", name, err)
+		}
+		if len(backups.Backups) != 1 || backups.Backups[0].Server != name {
+			t.Fatalf("ListBackups on %s = %+v, want one backup of %s", name, backups.Backups, name)
+		}
+
+		if _, err := c.RestoreBackup(context.Background(), backups.Backups[0].Name, api.BackupRestoreRequest{SteamID: testSteamID}); err != nil {
+			t.Fatalf("RestoreBackup on %s: %v", name, err)
+		}
+		content, err := os.ReadFile(filepath.Join(name, "Players", testSteamID+".json"))
+		if err != nil || !strings.Contains(string(content), `"`+name+`"`) {
+			t.Fatalf("restored player file on %s = %q, %v", name, content, err)
+		}
+	}
+}
+
+func TestClientRestoreBackupTarget(t *testing.T) {
+	server := newTestAgent(t)
+	c := newTestClient(t, server)
+	writeTestFile(t, filepath.Join("survival", "Slots", testSteamID, "2.json"), `{"slot_id":"2"}`)
+
+	if _, err := c.DeleteSlotFile(context.Background(), testSteamID, "2"); err != nil {
+		t.Fatalf("DeleteSlotFile: %v", err)
+	}
+	backups, err := c.ListBackups(context.Background(), testSteamID+"_2_")
+	if err != nil || len(backups.Backups) != 1 {
+		t.Fatalf("ListBackups = %+v, %v, want the slot backup", backups, err)
+	}
+	name := backups.Backups[0].Name
+
+	// Бэкап слота поверх файла игрока и в слот другого игрока не восстанавливается без allow_cross_target
+	for _, req := range []api.BackupRestoreRequest{
+		{SteamID: testSteamID},
+		{SteamID: "76561198000000002", SlotID: "2"},
+		{SteamID: testSteamID, SlotID: "3"},
+	} {
+		if _, err := c.RestoreBackup(context.Background(), name, req); !client.IsCode(err, ErrConflict) {
+			t.Fatalf("RestoreBackup %s to %+v error = %v, want %s", name, req, err, ErrConflict)
+		}
+	}
+
+	if _, err := c.RestoreBackup(context.Background(), name, api.BackupRestoreRequest{SteamID: testSteamID, SlotID: "2"}); err != nil {
+		t.Fatalf("RestoreBackup to its slot: %v", err)
+	}
+	if _, err := c.RestoreBackup(context.Background(), name, api.BackupRestoreRequest{SteamID: testSteamID, SlotID: "3", AllowCrossTarget: true}); err != nil {
+		t.Fatalf("RestoreBackup with allow_cross_target: %v", err)
+	}
+}
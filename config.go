@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type WebhookEndpoint struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"`
+	Events []string `json:"events,omitempty"`
+}
+
+type WebhooksConfig struct {
+	Endpoints             []WebhookEndpoint `json:"endpoints"`
+	MaxAttempts           int               `json:"max_attempts"`
+	InitialBackoffSeconds int               `json:"initial_backoff_seconds"`
+	TimeoutSeconds        int               `json:"timeout_seconds"`
+	DeadLetterFile        string            `json:"dead_letter_file"`
+}
+
+type RCONConfig struct {
+	Host           string `json:"host"`
+	Port           int    `json:"port"`
+	Password       string `json:"password"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+}
+
+// Профиль инстанса Evrima: свои каталоги сохранений и, при необходимости, свой RCON
+type ServerProfile struct {
+	Name       string     `json:"name"`
+	PlayersDir string     `json:"players_dir"`
+	SlotsDir   string     `json:"slots_dir"`
+	RCON       RCONConfig `json:"rcon"`
+}
+
+type PresenceConfig struct {
+	Provider             string `json:"provider"`
+	CacheSeconds         int    `json:"cache_seconds"`
+	OnlinePolicy         string `json:"online_policy"`
+	KickReason           string `json:"kick_reason"`
+	KickWaitSeconds      int    `json:"kick_wait_seconds"`
+	AllowWhenUnavailable bool   `json:"allow_when_unavailable"`
+}
+
+type AuditConfig struct {
+	File      string `json:"file"`
+	MaxSizeMB int    `json:"max_size_mb"`
+	MaxFiles  int    `json:"max_files"`
+}
+
+type APIKey struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+type HealthConfig struct {
+	MinFreeDiskMB int  `json:"min_free_disk_mb"`
+	RCONRequired  bool `json:"rcon_required"`
+}
+
+type SecurityConfig struct {
+	StrictMode     bool     `json:"strict_mode"`
+	TrustedOrigins []string `json:"trusted_origins"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins   []string `json:"allowed_origins"`
+	AllowedMethods   []string `json:"allowed_methods"`
+	AllowedHeaders   []string `json:"allowed_headers"`
+	ExposedHeaders   []string `json:"exposed_headers"`
+	AllowCredentials bool     `json:"allow_credentials"`
+	MaxAgeSeconds    int      `json:"max_age_seconds"`
+}
+
+type UIConfig struct {
+	Enabled bool   `json:"enabled"`
+	Path    string `json:"path"`
+}
+
+type LoggingConfig struct {
+	Level  string `json:"level"`
+	Format string `json:"format"`
+}
+
+type Config struct {
+	ShutdownTimeoutSeconds int `json:"shutdown_timeout_seconds"`
+
+	Servers       []ServerProfile `json:"servers"`
+	DefaultServer string          `json:"default_server"`
+
+	Logging  LoggingConfig  `json:"logging"`
+	Webhooks WebhooksConfig `json:"webhooks"`
+	RCON     RCONConfig     `json:"rcon"`
+	Presence PresenceConfig `json:"presence"`
+	Audit    AuditConfig    `json:"audit"`
+	Health   HealthConfig   `json:"health"`
+	Security SecurityConfig `json:"security"`
+	CORS     CORSConfig     `json:"cors"`
+	UI       UIConfig       `json:"ui"`
+	APIKeys  []APIKey       `json:"api_keys"`
+}
+
+const defaultConfigFile = "config.json"
+
+var config = defaultConfig()
+
+func defaultConfig() Config {
+	return Config{
+		ShutdownTimeoutSeconds: 30,
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		Webhooks: WebhooksConfig{
+			MaxAttempts:           5,
+			InitialBackoffSeconds: 2,
+			TimeoutSeconds:        10,
+			DeadLetterFile:        `C:\EVRIMA\surv_server\webhooks_dead_letter.jsonl`,
+		},
+		RCON: RCONConfig{
+			Port:           8888,
+			TimeoutSeconds: 5,
+		},
+		Presence: PresenceConfig{
+			CacheSeconds:         5,
+			OnlinePolicy:         "refuse",
+			KickReason:           "Save maintenance, please reconnect in a minute",
+			KickWaitSeconds:      10,
+			AllowWhenUnavailable: true,
+		},
+		Audit: AuditConfig{
+			File:      `C:\EVRIMA\surv_server\audit\audit.jsonl`,
+			MaxSizeMB: 10,
+			MaxFiles:  10,
+		},
+		Health: HealthConfig{
+			MinFreeDiskMB: 1024,
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: []string{"*"},
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+			AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key", requestIDHeader, apiVersionHeader},
+			ExposedHeaders: []string{requestIDHeader, "Link", "Deprecation", "Warning"},
+			MaxAgeSeconds:  600,
+		},
+		UI: UIConfig{
+			Enabled: true,
+			Path:    "/ui/",
+		},
+	}
+}
+
+func loadConfig() (Config, error) {
+	cfg := defaultConfig()
+
+	path := os.Getenv("DINO_AGENT_CONFIG")
+	if path == "" {
+		path = defaultConfigFile
+	}
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		// Конфиг не обязателен - работаем со значениями по умолчанию
+		logInfo(context.Background(), "Config file %s not found, using defaults", path)
+		return cfg, nil
+	} else if err != nil {
+		return cfg, fmt.Errorf("failed to read config file %s: %v", path, err)
+	}
+
+	// Поля, которых нет в файле, сохраняют значения по умолчанию
+	if err := json.Unmarshal(content, &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+
+	logInfo(context.Background(), "Config loaded from %s", path)
+	return cfg, nil
+}
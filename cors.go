@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CORS для всех маршрутов в одном месте; обработчики заголовки Access-Control-* не выставляют
+
+func corsOriginAllowed(origin string) bool {
+	for _, allowed := range config.CORS.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Явно перечисленные источники считаются доверенными и для CSRF, "*" - нет
+func corsOriginListed(origin string) bool {
+	for _, allowed := range config.CORS.AllowedOrigins {
+		if allowed != "*" && strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if origin != "" {
+			w.Header().Add("Vary", "Origin")
+		}
+
+		if origin != "" && corsOriginAllowed(origin) {
+			cfg := config.CORS
+			// Credentials только для явно перечисленных источников: "*" с ними браузер не примет,
+			// а отражение любого Origin открыло бы API всем сайтам
+			if corsOriginListed(origin) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				if cfg.AllowCredentials {
+					w.Header().Set("Access-Control-Allow-Credentials", "true")
+				}
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			}
+
+			if preflight {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+				w.Header().Set("Access-Control-Allow-Methods", strings.Join(cfg.AllowedMethods, ", "))
+				w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders(r))
+				if cfg.MaxAgeSeconds > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAgeSeconds))
+				}
+			} else if len(cfg.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(cfg.ExposedHeaders, ", "))
+			}
+		} else if preflight && origin != "" {
+			logWarn(r.Context(), "CORS: preflight from origin %q rejected", origin)
+			writeError(w, r, ErrForbidden, "Origin not allowed")
+			return
+		}
+
+		// На OPTIONS отвечаем здесь, до обработчиков
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func corsAllowedHeaders(r *http.Request) string {
+	for _, header := range config.CORS.AllowedHeaders {
+		if header == "*" {
+			return r.Header.Get("Access-Control-Request-Headers")
+		}
+	}
+	return strings.Join(config.CORS.AllowedHeaders, ", ")
+}
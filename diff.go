@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type DiffSource struct {
+	Type      string `json:"type"`
+	SteamID   string `json:"steamid,omitempty"`
+	SlotID    string `json:"slot_id,omitempty"`
+	Backup    string `json:"backup,omitempty"`
+	FilePath  string `json:"file_path,omitempty"`
+	VersionID int    `json:"version_id,omitempty"`
+	Server    string `json:"server,omitempty"`
+}
+
+type DiffRequest struct {
+	Left  DiffSource `json:"left"`
+	Right DiffSource `json:"right"`
+}
+
+type DiffChange struct {
+	Path     string          `json:"path"`
+	Type     string          `json:"type"`
+	OldValue json.RawMessage `json:"old_value,omitempty"`
+	NewValue json.RawMessage `json:"new_value,omitempty"`
+}
+
+type DiffSummary struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+	Changed int `json:"changed"`
+}
+
+type DiffResponse struct {
+	Success   bool         `json:"success"`
+	Left      string       `json:"left,omitempty"`
+	Right     string       `json:"right,omitempty"`
+	Identical bool         `json:"identical"`
+	Summary   DiffSummary  `json:"summary"`
+	Changes   []DiffChange `json:"changes"`
+	Text      string       `json:"text,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	ErrorCode ErrorCode    `json:"error_code,omitempty"`
+}
+
+const (
+	diffAdded   = "added"
+	diffRemoved = "removed"
+	diffChanged = "changed"
+)
+
+var simpleDiffKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func loadDiffSource(ctx context.Context, src DiffSource) ([]byte, string, error) {
+	// Стороны могут относиться к разным серверам, например survival против event
+	if src.Server != "" {
+		srv, ok := lookupServer(src.Server)
+		if !ok {
+			return nil, "", fmt.Errorf("unknown server %s", src.Server)
+		}
+		ctx = withServer(ctx, srv)
+	}
+
+	switch src.Type {
+	case "player":
+		if src.SteamID == "" {
+			return nil, "", fmt.Errorf("steamid is required for player source")
+		}
+		filePath := playerFilePath(ctx, src.SteamID)
+		content, err := os.ReadFile(filePath)
+		return content, fmt.Sprintf("player %s (%s)", src.SteamID, filePath), err
+
+	case "slot":
+		if src.SteamID == "" || src.SlotID == "" {
+			return nil, "", fmt.Errorf("steamid and slot_id are required for slot source")
+		}
+		filePath := slotFilePath(ctx, src.SteamID, src.SlotID)
+		content, err := os.ReadFile(filePath)
+		return content, fmt.Sprintf("slot %s/%s (%s)", src.SteamID, src.SlotID, filePath), err
+
+	case "backup":
+		// Разрешаем только имя файла внутри каталога бэкапов сервера
+		if src.Backup == "" || filepath.Base(src.Backup) != src.Backup {
+			return nil, "", fmt.Errorf("backup must be a file name inside the server backup directory")
+		}
+		filePath := filepath.Join(serverBackupDir(serverFrom(ctx)), src.Backup)
+		content, err := os.ReadFile(filePath)
+		return content, fmt.Sprintf("backup %s (%s)", src.Backup, filePath), err
+
+	case "path":
+		if src.FilePath == "" {
+			return nil, "", fmt.Errorf("file_path is required for path source")
+		}
+		content, err := os.ReadFile(src.FilePath)
+		return content, src.FilePath, err
+
+	case "version":
+		filePath := resolveHistoryPath(ctx, FileHistoryRequest{
+			SteamID:  src.SteamID,
+			SlotID:   src.SlotID,
+			FilePath: src.FilePath,
+		})
+		if filePath == "" || src.VersionID <= 0 {
+			return nil, "", fmt.Errorf("version_id and file_path or steamid are required for version source")
+		}
+		version := getFileVersion(ctx, filePath, src.VersionID)
+		if !version.Success {
+			return nil, "", fmt.Errorf("%s", version.Error)
+		}
+		label := fmt.Sprintf("version %d of %s", src.VersionID, filePath)
+		if version.Content == nil {
+			return []byte(version.RawContent), label, nil
+		}
+		return version.Content, label, nil
+
+	default:
+		return nil, "", fmt.Errorf("unknown source type %q (expected player, slot, backup, path or version)", src.Type)
+	}
+}
+
+func decodeDiffJSON(content []byte) (interface{}, error) {
+	// UseNumber сохраняет числа в исходном виде, без потери точности float64
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func diffKeyPath(parent, key string) string {
+	if simpleDiffKey.MatchString(key) {
+		return parent + "." + key
+	}
+	return parent + "[" + strconv.Quote(key) + "]"
+}
+
+func diffRawValue(value interface{}) json.RawMessage {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return json.RawMessage(strconv.Quote(fmt.Sprint(value)))
+	}
+	return content
+}
+
+func diffValues(path string, oldValue, newValue interface{}, changes []DiffChange) []DiffChange {
+	oldMap, oldIsMap := oldValue.(map[string]interface{})
+	newMap, newIsMap := newValue.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		keys := make([]string, 0, len(oldMap)+len(newMap))
+		for key := range oldMap {
+			keys = append(keys, key)
+		}
+		for key := range newMap {
+			if _, exists := oldMap[key]; !exists {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			oldChild, inOld := oldMap[key]
+			newChild, inNew := newMap[key]
+			childPath := diffKeyPath(path, key)
+
+			switch {
+			case !inOld:
+				changes = append(changes, DiffChange{Path: childPath, Type: diffAdded, NewValue: diffRawValue(newChild)})
+			case !inNew:
+				changes = append(changes, DiffChange{Path: childPath, Type: diffRemoved, OldValue: diffRawValue(oldChild)})
+			default:
+				changes = diffValues(childPath, oldChild, newChild, changes)
+			}
+		}
+		return changes
+	}
+
+	oldSlice, oldIsSlice := oldValue.([]interface{})
+	newSlice, newIsSlice := newValue.([]interface{})
+	if oldIsSlice && newIsSlice {
+		for i := 0; i < len(oldSlice) || i < len(newSlice); i++ {
+			childPath := fmt.Sprintf("%s[%d]", path, i)
+
+			switch {
+			case i >= len(oldSlice):
+				changes = append(changes, DiffChange{Path: childPath, Type: diffAdded, NewValue: diffRawValue(newSlice[i])})
+			case i >= len(newSlice):
+				changes = append(changes, DiffChange{Path: childPath, Type: diffRemoved, OldValue: diffRawValue(oldSlice[i])})
+			default:
+				changes = diffValues(childPath, oldSlice[i], newSlice[i], changes)
+			}
+		}
+		return changes
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		changes = append(changes, DiffChange{
+			Path:     path,
+			Type:     diffChanged,
+			OldValue: diffRawValue(oldValue),
+			NewValue: diffRawValue(newValue),
+		})
+	}
+	return changes
+}
+
+func renderDiffText(leftLabel, rightLabel string, changes []DiffChange) string {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "--- %s\n", leftLabel)
+	fmt.Fprintf(&builder, "+++ %s\n", rightLabel)
+
+	if len(changes) == 0 {
+		builder.WriteString("(no differences)\n")
+		return builder.String()
+	}
+
+	for _, change := range changes {
+		switch change.Type {
+		case diffAdded:
+			fmt.Fprintf(&builder, "+ %s: %s\n", change.Path, change.NewValue)
+		case diffRemoved:
+			fmt.Fprintf(&builder, "- %s: %s\n", change.Path, change.OldValue)
+		case diffChanged:
+			fmt.Fprintf(&builder, "~ %s: %s -> %s\n", change.Path, change.OldValue, change.NewValue)
+		}
+	}
+	return builder.String()
+}
+
+// Отсутствующий файл - NOT_FOUND, ошибка чтения - IO_ERROR, остальное - некорректный источник
+func diffSourceErrorCode(err error) ErrorCode {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return ErrIO
+	}
+	return ErrInvalidRequest
+}
+
+func diffFiles(ctx context.Context, left, right DiffSource) DiffResponse {
+	logInfo(ctx, "Diffing %s source against %s source", left.Type, right.Type)
+
+	leftContent, leftLabel, err := loadDiffSource(ctx, left)
+	if err != nil {
+		result := DiffResponse{
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to load left source: %v", err),
+			ErrorCode: diffSourceErrorCode(err),
+		}
+		logError(ctx, "Failed to load left diff source: %v", err)
+		return result
+	}
+
+	rightContent, rightLabel, err := loadDiffSource(ctx, right)
+	if err != nil {
+		result := DiffResponse{
+			Success:   false,
+			Left:      leftLabel,
+			Error:     fmt.Sprintf("Failed to load right source: %v", err),
+			ErrorCode: diffSourceErrorCode(err),
+		}
+		logError(ctx, "Failed to load right diff source: %v", err)
+		return result
+	}
+
+	leftValue, err := decodeDiffJSON(leftContent)
+	if err != nil {
+		result := DiffResponse{
+			Success:   false,
+			Left:      leftLabel,
+			Right:     rightLabel,
+			Error:     fmt.Sprintf("Invalid JSON in left source: %v", err),
+			ErrorCode: ErrInvalidJSON,
+		}
+		logWarn(ctx, "Invalid JSON in left diff source %s: %v", leftLabel, err)
+		return result
+	}
+
+	rightValue, err := decodeDiffJSON(rightContent)
+	if err != nil {
+		result := DiffResponse{
+			Success:   false,
+			Left:      leftLabel,
+			Right:     rightLabel,
+			Error:     fmt.Sprintf("Invalid JSON in right source: %v", err),
+			ErrorCode: ErrInvalidJSON,
+		}
+		logWarn(ctx, "Invalid JSON in right diff source %s: %v", rightLabel, err)
+		return result
+	}
+
+	changes := diffValues("$", leftValue, rightValue, []DiffChange{})
+
+	var summary DiffSummary
+	for _, change := range changes {
+		switch change.Type {
+		case diffAdded:
+			summary.Added++
+		case diffRemoved:
+			summary.Removed++
+		case diffChanged:
+			summary.Changed++
+		}
+	}
+
+	result := DiffResponse{
+		Success:   true,
+		Left:      leftLabel,
+		Right:     rightLabel,
+		Identical: len(changes) == 0,
+		Summary:   summary,
+		Changes:   changes,
+		Text:      renderDiffText(leftLabel, rightLabel, changes),
+	}
+	logInfo(ctx, "Diff completed: added=%d, removed=%d, changed=%d", summary.Added, summary.Removed, summary.Changed)
+	return result
+}
+
+func diffSourceFromQuery(r *http.Request, prefix string) (DiffSource, error) {
+	query := r.URL.Query()
+	src := DiffSource{
+		Type:     query.Get(prefix + "_type"),
+		SteamID:  query.Get(prefix + "_steamid"),
+		SlotID:   query.Get(prefix + "_slot_id"),
+		Backup:   query.Get(prefix + "_backup"),
+		FilePath: query.Get(prefix + "_file_path"),
+		Server:   query.Get(prefix + "_server"),
+	}
+
+	if versionStr := query.Get(prefix + "_version_id"); versionStr != "" {
+		versionID, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return src, fmt.Errorf("%s_version_id must be an integer", prefix)
+		}
+		src.VersionID = versionID
+	}
+	return src, nil
+}
+
+func diffHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req DiffRequest
+
+	switch r.Method {
+	case "GET":
+		left, err := diffSourceFromQuery(r, "left")
+		if err == nil {
+			req.Right, err = diffSourceFromQuery(r, "right")
+		}
+		if err != nil {
+			logWarn(r.Context(), "Diff handler: invalid parameters in GET request: %v", err)
+			writeError(w, r, ErrInvalidRequest, err.Error())
+			return
+		}
+		req.Left = left
+
+	case "POST":
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			logWarn(r.Context(), "Diff handler: invalid JSON in POST request: %v", err)
+			writeError(w, r, ErrInvalidJSON, "Invalid JSON")
+			return
+		}
+
+	default:
+		logWarn(r.Context(), "Diff handler: method not allowed: %s", r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if req.Left.Type == "" || req.Right.Type == "" {
+		logWarn(r.Context(), "Diff handler: left and right source types are required")
+		writeError(w, r, ErrInvalidRequest, "left and right source types are required")
+		return
+	}
+
+	logInfo(r.Context(), "Diff handler processing request: %s vs %s", req.Left.Type, req.Right.Type)
+	response := diffFiles(r.Context(), req.Left, req.Right)
+	logInfo(r.Context(), "Diff handler response: Success=%t, Changes=%d, Error=%s", response.Success, len(response.Changes), response.Error)
+
+	// Человекочитаемый вариант для консоли и тикетов
+	if r.URL.Query().Get("format") == "text" && response.Success {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(response.Text))
+		return
+	}
+
+	writeResponse(w, r, response)
+}
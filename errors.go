@@ -0,0 +1,180 @@
+package main
+
+import (
+	"DinoAgentApi/api"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+type (
+	ErrorCode     = api.ErrorCode
+	APIError      = api.APIError
+	ErrorEnvelope = api.ErrorEnvelope
+	apiResult     = api.Result
+)
+
+const (
+	ErrNotFound             = api.ErrNotFound
+	ErrInvalidID            = api.ErrInvalidID
+	ErrInvalidJSON          = api.ErrInvalidJSON
+	ErrInvalidRequest       = api.ErrInvalidRequest
+	ErrMethodNotAllowed     = api.ErrMethodNotAllowed
+	ErrUnsupportedMediaType = api.ErrUnsupportedMediaType
+	ErrLocked               = api.ErrLocked
+	ErrConflict             = api.ErrConflict
+	ErrForbidden            = api.ErrForbidden
+	ErrIO                   = api.ErrIO
+	ErrUnavailable          = api.ErrUnavailable
+	ErrUpstream             = api.ErrUpstream
+	ErrInternal             = api.ErrInternal
+)
+
+var errorStatuses = map[ErrorCode]int{
+	ErrNotFound:             http.StatusNotFound,
+	ErrInvalidID:            http.StatusBadRequest,
+	ErrInvalidJSON:          http.StatusBadRequest,
+	ErrInvalidRequest:       http.StatusBadRequest,
+	ErrMethodNotAllowed:     http.StatusMethodNotAllowed,
+	ErrUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	ErrLocked:               http.StatusConflict,
+	ErrConflict:             http.StatusConflict,
+	ErrForbidden:            http.StatusForbidden,
+	ErrIO:                   http.StatusInternalServerError,
+	ErrUnavailable:          http.StatusServiceUnavailable,
+	ErrUpstream:             http.StatusBadGateway,
+	ErrInternal:             http.StatusInternalServerError,
+}
+
+const apiVersionHeader = "X-API-Version"
+
+func statusForCode(code ErrorCode) int {
+	if status, exists := errorStatuses[code]; exists {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Версия API выбирается префиксом пути (/v1, /v2) или заголовком X-API-Version: 2, по умолчанию v1
+func apiVersion(r *http.Request) int {
+	if strings.HasPrefix(r.URL.Path, "/v1/") {
+		return 1
+	}
+	if strings.HasPrefix(r.URL.Path, "/v2/") || strings.TrimSpace(r.Header.Get(apiVersionHeader)) == "2" {
+		return 2
+	}
+	return 1
+}
+
+func errorCodeFor(err error) ErrorCode {
+	switch err.(type) {
+	case *PlayerOnlineError:
+		return ErrLocked
+	case *PresenceUnavailableError:
+		return ErrUnavailable
+	}
+	return ErrInternal
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, code ErrorCode, message string) {
+	writeErrorDetails(w, r, code, message, nil)
+}
+
+// В отличие от http.Error сохраняет application/json, тело зависит от версии API
+func writeErrorDetails(w http.ResponseWriter, r *http.Request, code ErrorCode, message string, details map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(statusForCode(code))
+
+	if apiVersion(r) >= 2 {
+		json.NewEncoder(w).Encode(ErrorEnvelope{Error: APIError{Code: code, Message: message, Details: details}})
+		return
+	}
+
+	// v1 остается плоским {"error": "..."}, код ошибки добавляется отдельным полем
+	body := map[string]interface{}{"error": message, "error_code": code}
+	for key, value := range details {
+		body[key] = value
+	}
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeResponse(w http.ResponseWriter, r *http.Request, response apiResult) {
+	writeResponseStatus(w, r, http.StatusOK, response)
+}
+
+// status используется для успешных ответов и для ошибок v1, где клиенты смотрят на поле success
+func writeResponseStatus(w http.ResponseWriter, r *http.Request, status int, response apiResult) {
+	if apiErr := response.Failure(); apiErr != nil && apiVersion(r) >= 2 {
+		writeErrorDetails(w, r, apiErr.Code, apiErr.Message, apiErr.Details)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// Идентификаторы попадают в пути файлов, поэтому разрешаем только безопасные символы
+func validID(id string) bool {
+	if id == "" || len(id) > 64 || strings.Contains(id, "..") {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func checkIDs(w http.ResponseWriter, r *http.Request, name string, ids ...string) bool {
+	for _, id := range ids {
+		if !validID(id) {
+			logWarn(r.Context(), "%s handler: invalid identifier %q", name, id)
+			writeError(w, r, ErrInvalidID, "Invalid identifier: "+id)
+			return false
+		}
+	}
+	return true
+}
+
+func (r FileVersionsResponse) Failure() *APIError {
+	return api.NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+func (r FileVersionContentResponse) Failure() *APIError {
+	return api.NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+func (r RollbackResponse) Failure() *APIError {
+	return api.NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+func (r DiffResponse) Failure() *APIError {
+	return api.NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+// Частично неудачный пакет - не ошибка запроса, результаты по операциям лежат в results
+func (r BatchResponse) Failure() *APIError {
+	return api.NewFailure(r.ErrorCode != "", r.ErrorCode, r.Error)
+}
+
+func (r RCONResponse) Failure() *APIError {
+	return api.NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+func (r RCONPlayersResponse) Failure() *APIError {
+	return api.NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+func (r AuditQueryResponse) Failure() *APIError {
+	return api.NewFailure(!r.Success, r.ErrorCode, r.Error)
+}
+
+// Неудачные доставки возвращаются в deliveries, сам тестовый запрос при этом выполнен
+func (r WebhookTestResponse) Failure() *APIError {
+	return api.NewFailure(r.ErrorCode != "", r.ErrorCode, r.Error)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type HealthCheck struct {
+	Name           string `json:"name"`
+	Status         string `json:"status"`
+	Message        string `json:"message,omitempty"`
+	Path           string `json:"path,omitempty"`
+	Server         string `json:"server,omitempty"`
+	FreeBytes      uint64 `json:"free_bytes,omitempty"`
+	TotalBytes     uint64 `json:"total_bytes,omitempty"`
+	ThresholdBytes uint64 `json:"threshold_bytes,omitempty"`
+	DurationMS     int64  `json:"duration_ms"`
+}
+
+type HealthResponse struct {
+	Status string        `json:"status"`
+	Checks []HealthCheck `json:"checks,omitempty"`
+	Time   time.Time     `json:"time"`
+}
+
+const (
+	healthOK   = "ok"
+	healthWarn = "warn"
+	healthFail = "fail"
+)
+
+// Ближайший существующий каталог пути: каталог бэкапов создаётся только при первом бэкапе
+func existingDir(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+// Проба не меняет диск: доступ проверяется через os.Stat, запись - по правам из Stat
+// (на Windows они отражают атрибут "только чтение")
+func checkDirectory(name, path string, optional bool) HealthCheck {
+	check := HealthCheck{Name: name, Status: healthOK, Path: path}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) && optional {
+		// Каталог бэкапов агент создаёт сам, его отсутствие не ошибка, если можно создать его в родительском
+		parent := existingDir(path)
+		check.Message = "Directory does not exist yet and is created on the first backup"
+		path = parent
+		info, err = os.Stat(path)
+	}
+	if err != nil {
+		check.Status = healthFail
+		check.Message = fmt.Sprintf("Directory is not accessible: %v", err)
+		return check
+	}
+	if !info.IsDir() {
+		check.Status = healthFail
+		check.Message = "Path is not a directory"
+		return check
+	}
+	if info.Mode().Perm()&0200 == 0 {
+		check.Status = healthFail
+		check.Message = fmt.Sprintf("Directory %s is read-only", path)
+		return check
+	}
+
+	return check
+}
+
+func checkDiskSpace(name, path string) HealthCheck {
+	threshold := uint64(config.Health.MinFreeDiskMB) * 1024 * 1024
+	check := HealthCheck{Name: name, Status: healthOK, Path: path, ThresholdBytes: threshold}
+
+	free, total, err := diskFree(existingDir(path))
+	if err != nil {
+		check.Status = healthFail
+		check.Message = fmt.Sprintf("Failed to get free disk space: %v", err)
+		return check
+	}
+
+	check.FreeBytes = free
+	check.TotalBytes = total
+	if free < threshold {
+		check.Status = healthFail
+		check.Message = fmt.Sprintf("Free disk space %d MB is below threshold %d MB", free/1024/1024, config.Health.MinFreeDiskMB)
+	}
+	return check
+}
+
+const rconHealthTTL = 10 * time.Second
+
+// Результат проверки RCON кэшируется, чтобы частые пробы не занимали игровой сервер командами
+type rconHealthCache struct {
+	mu      sync.Mutex
+	err     error
+	checked time.Time
+}
+
+func (c *rconHealthCache) check(client *RCONClient) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.checked.IsZero() || time.Since(c.checked) > rconHealthTTL {
+		_, c.err = client.Execute(rconServerDetails, "")
+		c.checked = time.Now()
+	}
+	return c.err
+}
+
+func checkRCON(srv *gameServer) HealthCheck {
+	check := HealthCheck{Name: "rcon", Status: healthOK}
+
+	if srv.rcon == nil {
+		check.Message = "RCON is not configured"
+		return check
+	}
+
+	check.Path = srv.rcon.addr
+	if err := srv.rconHealth.check(srv.rcon); err != nil {
+		// Остановленный игровой сервер не мешает работе с файлами, если RCON не обязателен
+		check.Status = healthWarn
+		if config.Health.RCONRequired {
+			check.Status = healthFail
+		}
+		check.Message = fmt.Sprintf("RCON is unreachable: %v", err)
+	}
+	return check
+}
+
+func runReadinessChecks(servers []*gameServer) HealthResponse {
+	response := HealthResponse{Status: "ready", Time: time.Now()}
+	record := func(server string, run func() HealthCheck) {
+		start := time.Now()
+		check := run()
+		check.DurationMS = time.Since(start).Milliseconds()
+		check.Server = server
+		if check.Status == healthFail {
+			response.Status = "not_ready"
+		}
+		response.Checks = append(response.Checks, check)
+	}
+
+	// Каталоги сохранений и RCON проверяются у каждого профиля, бэкапы общие
+	for _, srv := range servers {
+		record(srv.Name, func() HealthCheck { return checkDirectory("players_dir", srv.PlayersDir, false) })
+		record(srv.Name, func() HealthCheck { return checkDirectory("slots_dir", srv.SlotsDir, false) })
+		record(srv.Name, func() HealthCheck { return checkDiskSpace("disk_saves", srv.PlayersDir) })
+		record(srv.Name, func() HealthCheck { return checkRCON(srv) })
+	}
+	record("", func() HealthCheck { return checkDirectory("backup_dir", backupDir, true) })
+	record("", func() HealthCheck { return checkDiskSpace("disk_backups", backupDir) })
+	return response
+}
+
+func healthLiveHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	logDebug(r.Context(), "Health check requested from %s", r.RemoteAddr)
+	w.Write([]byte(`{"status": "ok"}`))
+}
+
+func healthReadyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// С параметром server проверяется только выбранный профиль
+	servers := gameServers
+	if r.URL.Query().Get("server") != "" {
+		servers = []*gameServer{serverFrom(r.Context())}
+	}
+	response := runReadinessChecks(servers)
+	if response.Status != "ready" {
+		for _, check := range response.Checks {
+			if check.Status == healthFail {
+				logWarn(r.Context(), "Readiness check %s failed (server %q): %s", check.Name, check.Server, check.Message)
+			}
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		logDebug(r.Context(), "Readiness check passed")
+	}
+	json.NewEncoder(w).Encode(response)
+}
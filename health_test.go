@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestReadinessHasNoSideEffects(t *testing.T) {
+	server := newTestAgent(t)
+	for _, dir := range []string{"survival/Players", "survival/Slots", "event/Players", "event/Slots"} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp, err := http.Get(server.URL + "/health/ready")
+	if err != nil {
+		t.Fatalf("GET /health/ready: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /health/ready status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if _, err := os.Stat(backupDir); !os.IsNotExist(err) {
+		t.Fatalf("backup directory after readiness probe: %v, want not created", err)
+	}
+}
+
+func TestReadinessCachesRCON(t *testing.T) {
+	rcon := newFakeRCONServer(t, func(conn net.Conn, payload string) {
+		conn.Write([]byte("ServerDetails\x00"))
+	})
+	srv := &gameServer{ServerProfile: ServerProfile{Name: "test"}, rcon: rcon.client(t, testRCONPassword)}
+
+	for i := 0; i < 3; i++ {
+		if check := checkRCON(srv); check.Status != healthOK {
+			t.Fatalf("checkRCON = %+v, want ok", check)
+		}
+	}
+	if _, commands := rcon.counts(); commands != 1 {
+		t.Fatalf("RCON commands for 3 probes = %d, want 1", commands)
+	}
+}
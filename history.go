@@ -0,0 +1,474 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type FileVersion struct {
+	ID        int       `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Operation string    `json:"operation"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+}
+
+type fileHistoryIndex struct {
+	FilePath string        `json:"file_path"`
+	Versions []FileVersion `json:"versions"`
+}
+
+type FileHistoryRequest struct {
+	SteamID   string `json:"steamid,omitempty"`
+	SlotID    string `json:"slot_id,omitempty"`
+	FilePath  string `json:"file_path,omitempty"`
+	VersionID int    `json:"version_id,omitempty"`
+	Force     bool   `json:"force,omitempty"`
+}
+
+type FileVersionsResponse struct {
+	Success   bool          `json:"success"`
+	FilePath  string        `json:"file_path,omitempty"`
+	Versions  []FileVersion `json:"versions"`
+	Error     string        `json:"error,omitempty"`
+	ErrorCode ErrorCode     `json:"error_code,omitempty"`
+}
+
+type FileVersionContentResponse struct {
+	Success    bool            `json:"success"`
+	FilePath   string          `json:"file_path,omitempty"`
+	Version    *FileVersion    `json:"version,omitempty"`
+	Content    json.RawMessage `json:"content,omitempty"`
+	RawContent string          `json:"raw_content,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	ErrorCode  ErrorCode       `json:"error_code,omitempty"`
+}
+
+type RollbackResponse struct {
+	Success   bool      `json:"success"`
+	Message   string    `json:"message"`
+	FilePath  string    `json:"file_path,omitempty"`
+	VersionID int       `json:"version_id,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	ErrorCode ErrorCode `json:"error_code,omitempty"`
+}
+
+const maxHistoryVersions = 50
+
+// Один мьютекс на всё хранилище: записи редкие, а индекс и файлы версий
+// должны меняться согласованно
+var historyMu sync.Mutex
+
+func historyStoreDir(filePath string) string {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		absPath = filePath
+	}
+	sum := sha256.Sum256([]byte(filepath.Clean(absPath)))
+	return filepath.Join(historyDir, hex.EncodeToString(sum[:])[:16])
+}
+
+func loadHistoryIndex(storeDir string) (fileHistoryIndex, error) {
+	var index fileHistoryIndex
+
+	content, err := os.ReadFile(filepath.Join(storeDir, "index.json"))
+	if os.IsNotExist(err) {
+		return index, nil
+	} else if err != nil {
+		return index, err
+	}
+
+	if err := json.Unmarshal(content, &index); err != nil {
+		return index, fmt.Errorf("invalid history index: %v", err)
+	}
+	return index, nil
+}
+
+func saveHistoryIndex(storeDir string, index fileHistoryIndex) error {
+	content, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(storeDir, "index.json"), content, 0644)
+}
+
+func historyVersionFile(storeDir string, versionID int) string {
+	return filepath.Join(storeDir, fmt.Sprintf("v%d.json", versionID))
+}
+
+func recordFileVersion(ctx context.Context, filePath, operation string) {
+	content, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		// Нечего сохранять - файл создаётся впервые
+		return
+	} else if err != nil {
+		logError(ctx, "History: failed to read %s for versioning: %v", filePath, err)
+		return
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	storeDir := historyStoreDir(filePath)
+	if err := os.MkdirAll(storeDir, 0755); err != nil {
+		logError(ctx, "History: failed to create store directory %s: %v", storeDir, err)
+		return
+	}
+
+	index, err := loadHistoryIndex(storeDir)
+	if err != nil {
+		logError(ctx, "History: failed to load index for %s: %v", filePath, err)
+		return
+	}
+
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+
+	// Не дублируем версию, если содержимое не изменилось с прошлого раза
+	if n := len(index.Versions); n > 0 && index.Versions[n-1].SHA256 == hash {
+		logDebug(ctx, "History: content of %s unchanged since version %d, skipping", filePath, index.Versions[n-1].ID)
+		return
+	}
+
+	nextID := 1
+	if n := len(index.Versions); n > 0 {
+		nextID = index.Versions[n-1].ID + 1
+	}
+
+	if err := os.WriteFile(historyVersionFile(storeDir, nextID), content, 0644); err != nil {
+		logError(ctx, "History: failed to write version %d of %s: %v", nextID, filePath, err)
+		return
+	}
+
+	index.FilePath = filePath
+	index.Versions = append(index.Versions, FileVersion{
+		ID:        nextID,
+		Timestamp: time.Now(),
+		Operation: operation,
+		Size:      int64(len(content)),
+		SHA256:    hash,
+	})
+
+	// Удаляем самые старые версии сверх лимита
+	for len(index.Versions) > maxHistoryVersions {
+		oldest := index.Versions[0]
+		if err := os.Remove(historyVersionFile(storeDir, oldest.ID)); err != nil && !os.IsNotExist(err) {
+			logError(ctx, "History: failed to prune version %d of %s: %v", oldest.ID, filePath, err)
+		}
+		index.Versions = index.Versions[1:]
+	}
+
+	if err := saveHistoryIndex(storeDir, index); err != nil {
+		logError(ctx, "History: failed to save index for %s: %v", filePath, err)
+		return
+	}
+
+	logInfo(ctx, "History: recorded version %d of %s (operation: %s, size: %d bytes)", nextID, filePath, operation, len(content))
+}
+
+func resolveHistoryPath(ctx context.Context, req FileHistoryRequest) string {
+	if req.FilePath != "" {
+		return req.FilePath
+	}
+	if req.SteamID != "" && req.SlotID != "" {
+		return slotFilePath(ctx, req.SteamID, req.SlotID)
+	}
+	if req.SteamID != "" {
+		return playerFilePath(ctx, req.SteamID)
+	}
+	return ""
+}
+
+func listFileVersions(ctx context.Context, filePath string) FileVersionsResponse {
+	logInfo(ctx, "Listing versions for file: %s", filePath)
+
+	historyMu.Lock()
+	index, err := loadHistoryIndex(historyStoreDir(filePath))
+	historyMu.Unlock()
+
+	if err != nil {
+		result := FileVersionsResponse{
+			Success:   false,
+			FilePath:  filePath,
+			Error:     fmt.Sprintf("Failed to load history: %v", err),
+			ErrorCode: ErrIO,
+		}
+		logError(ctx, "Failed to load history for %s: %v", filePath, err)
+		return result
+	}
+
+	// Новые версии первыми
+	versions := make([]FileVersion, 0, len(index.Versions))
+	for i := len(index.Versions) - 1; i >= 0; i-- {
+		versions = append(versions, index.Versions[i])
+	}
+
+	result := FileVersionsResponse{
+		Success:  true,
+		FilePath: filePath,
+		Versions: versions,
+	}
+	logInfo(ctx, "Found %d versions for %s", len(versions), filePath)
+	return result
+}
+
+func getFileVersion(ctx context.Context, filePath string, versionID int) FileVersionContentResponse {
+	logInfo(ctx, "Getting version %d of file: %s", versionID, filePath)
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	storeDir := historyStoreDir(filePath)
+	index, err := loadHistoryIndex(storeDir)
+	if err != nil {
+		result := FileVersionContentResponse{
+			Success:   false,
+			FilePath:  filePath,
+			Error:     fmt.Sprintf("Failed to load history: %v", err),
+			ErrorCode: ErrIO,
+		}
+		logError(ctx, "Failed to load history for %s: %v", filePath, err)
+		return result
+	}
+
+	var version *FileVersion
+	for i := range index.Versions {
+		if index.Versions[i].ID == versionID {
+			version = &index.Versions[i]
+			break
+		}
+	}
+	if version == nil {
+		result := FileVersionContentResponse{
+			Success:   false,
+			FilePath:  filePath,
+			Error:     fmt.Sprintf("Version %d not found", versionID),
+			ErrorCode: ErrNotFound,
+		}
+		logWarn(ctx, "Version %d of %s not found", versionID, filePath)
+		return result
+	}
+
+	content, err := os.ReadFile(historyVersionFile(storeDir, versionID))
+	if err != nil {
+		result := FileVersionContentResponse{
+			Success:   false,
+			FilePath:  filePath,
+			Version:   version,
+			Error:     fmt.Sprintf("Failed to read version: %v", err),
+			ErrorCode: ErrIO,
+		}
+		logError(ctx, "Failed to read version %d of %s: %v", versionID, filePath, err)
+		return result
+	}
+
+	result := FileVersionContentResponse{
+		Success:  true,
+		FilePath: filePath,
+		Version:  version,
+	}
+	// Старые версии могли быть повреждены - отдаём их как текст
+	if json.Valid(content) {
+		result.Content = content
+	} else {
+		result.RawContent = string(content)
+	}
+	logInfo(ctx, "Successfully read version %d of %s, size: %d bytes", versionID, filePath, len(content))
+	return result
+}
+
+func rollbackFileVersion(ctx context.Context, filePath string, versionID int) RollbackResponse {
+	logInfo(ctx, "Rolling back file %s to version %d", filePath, versionID)
+
+	version := getFileVersion(ctx, filePath, versionID)
+	if !version.Success {
+		result := RollbackResponse{
+			Success:   false,
+			FilePath:  filePath,
+			Error:     version.Error,
+			ErrorCode: version.ErrorCode,
+		}
+		logWarn(ctx, "Rollback aborted: %s", version.Error)
+		return result
+	}
+
+	content := []byte(version.Content)
+	if version.Content == nil {
+		content = []byte(version.RawContent)
+	}
+
+	// Создаем директорию если не существует
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		result := RollbackResponse{
+			Success:   false,
+			FilePath:  filePath,
+			Error:     fmt.Sprintf("Failed to create directory: %v", err),
+			ErrorCode: ErrIO,
+		}
+		logError(ctx, "Failed to create directory for %s: %v", filePath, err)
+		return result
+	}
+
+	// Текущее содержимое тоже попадает в историю, чтобы откат можно было отменить
+	recordFileVersion(ctx, filePath, "rollback")
+
+	if err := os.WriteFile(filePath, content, 0644); err != nil {
+		result := RollbackResponse{
+			Success:   false,
+			FilePath:  filePath,
+			Error:     fmt.Sprintf("Failed to write file: %v", err),
+			ErrorCode: ErrIO,
+		}
+		logError(ctx, "Failed to write file %s: %v", filePath, err)
+		return result
+	}
+	fileBytesWritten.Add(float64(len(content)))
+
+	logInfo(ctx, "File %s rolled back to version %d", filePath, versionID)
+
+	result := RollbackResponse{
+		Success:   true,
+		Message:   fmt.Sprintf("File %s rolled back to version %d", filepath.Base(filePath), versionID),
+		FilePath:  filePath,
+		VersionID: versionID,
+	}
+	logInfo(ctx, "Rollback completed successfully")
+	return result
+}
+
+func parseFileHistoryRequest(w http.ResponseWriter, r *http.Request, name string) (FileHistoryRequest, bool) {
+	var req FileHistoryRequest
+
+	switch r.Method {
+	case "GET":
+		query := r.URL.Query()
+		req.SteamID = query.Get("steamid")
+		req.SlotID = query.Get("slot_id")
+		req.FilePath = query.Get("file_path")
+		req.Force = query.Get("force") == "true"
+		if versionStr := query.Get("version_id"); versionStr != "" {
+			versionID, err := strconv.Atoi(versionStr)
+			if err != nil {
+				logWarn(r.Context(), "%s handler: invalid version_id parameter: %s", name, versionStr)
+				writeError(w, r, ErrInvalidRequest, "version_id must be an integer")
+				return req, false
+			}
+			req.VersionID = versionID
+		}
+
+	case "POST":
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			logWarn(r.Context(), "%s handler: invalid JSON in POST request: %v", name, err)
+			writeError(w, r, ErrInvalidJSON, "Invalid JSON")
+			return req, false
+		}
+
+	default:
+		logWarn(r.Context(), "%s handler: method not allowed: %s", name, r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
+		return req, false
+	}
+
+	// steamid и slot_id попадают в путь файла
+	var ids []string
+	for _, id := range []string{req.SteamID, req.SlotID} {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if !checkIDs(w, r, name, ids...) {
+		return req, false
+	}
+
+	if resolveHistoryPath(r.Context(), req) == "" {
+		logWarn(r.Context(), "%s handler: file_path or steamid is required", name)
+		writeError(w, r, ErrInvalidRequest, "file_path or steamid is required")
+		return req, false
+	}
+
+	return req, true
+}
+
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	req, ok := parseFileHistoryRequest(w, r, "History")
+	if !ok {
+		return
+	}
+
+	filePath := resolveHistoryPath(r.Context(), req)
+	logInfo(r.Context(), "History handler processing request for path: %s", filePath)
+	response := listFileVersions(r.Context(), filePath)
+	logInfo(r.Context(), "History handler response: Success=%t, Versions=%d, Error=%s", response.Success, len(response.Versions), response.Error)
+	writeResponse(w, r, response)
+}
+
+func historyVersionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	req, ok := parseFileHistoryRequest(w, r, "History version")
+	if !ok {
+		return
+	}
+
+	if req.VersionID <= 0 {
+		logWarn(r.Context(), "History version handler: version_id is required")
+		writeError(w, r, ErrInvalidRequest, "version_id is required")
+		return
+	}
+
+	filePath := resolveHistoryPath(r.Context(), req)
+	logInfo(r.Context(), "History version handler processing request for path: %s, version: %d", filePath, req.VersionID)
+	response := getFileVersion(r.Context(), filePath, req.VersionID)
+	logInfo(r.Context(), "History version handler response: Success=%t, Error=%s", response.Success, response.Error)
+	writeResponse(w, r, response)
+}
+
+func historyRollbackHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	req, ok := parseFileHistoryRequest(w, r, "History rollback")
+	if !ok {
+		return
+	}
+
+	if req.VersionID <= 0 {
+		logWarn(r.Context(), "History rollback handler: version_id is required")
+		writeError(w, r, ErrInvalidRequest, "version_id is required")
+		return
+	}
+
+	// Откат файла игрока или слота меняет его так же, как восстановление бэкапа
+	if req.FilePath == "" {
+		if !checkPlayerPresence(w, r, req.SteamID, req.Force, "History rollback") {
+			return
+		}
+		unlock := lockPlayer(r.Context(), req.SteamID)
+		defer unlock()
+	} else {
+		guarded, _, unlock, ok := guardFilePath(w, r, req.FilePath, req.Force, "History rollback")
+		if !ok {
+			return
+		}
+		defer unlock()
+		r = guarded
+	}
+
+	filePath := resolveHistoryPath(r.Context(), req)
+	logInfo(r.Context(), "History rollback handler processing request for path: %s, version: %d", filePath, req.VersionID)
+	audit := beginAudit(r, "history-rollback", req.SteamID, req.SlotID, filePath).details("version=%d", req.VersionID)
+	response := rollbackFileVersion(r.Context(), filePath, req.VersionID)
+	audit.finish(response.Success, response.Error)
+	logInfo(r.Context(), "History rollback handler response: Success=%t, Error=%s", response.Success, response.Error)
+	writeResponse(w, r, response)
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"DinoAgentApi/api"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	JobProgress      = api.JobProgress
+	Job              = api.Job
+	JobSubmitRequest = api.JobSubmitRequest
+	JobResponse      = api.JobResponse
+	JobListResponse  = api.JobListResponse
+)
+
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+	jobCanceled  = "canceled"
+)
+
+const (
+	jobWorkers   = 2
+	maxQueueSize = 100
+	jobRetention = 7 * 24 * time.Hour
+)
+
+type jobProgressFunc func(done, total int, message string)
+
+type jobRunner func(ctx context.Context, params json.RawMessage, progress jobProgressFunc) (interface{}, error)
+
+var jobRunners = map[string]jobRunner{
+	"batch": func(ctx context.Context, params json.RawMessage, progress jobProgressFunc) (interface{}, error) {
+		var req BatchRequest
+		if err := json.Unmarshal(params, &req); err != nil {
+			return nil, fmt.Errorf("invalid batch params: %v", err)
+		}
+		response := runBatch(ctx, req, func(done, total int) {
+			progress(done, total, "")
+		})
+		if response.Error != "" {
+			return response, fmt.Errorf("%s", response.Error)
+		}
+		return response, nil
+	},
+	"snapshot": func(ctx context.Context, params json.RawMessage, progress jobProgressFunc) (interface{}, error) {
+		var req SnapshotRequest
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &req); err != nil {
+				return nil, fmt.Errorf("invalid snapshot params: %v", err)
+			}
+		}
+		return createSnapshot(ctx, req.Label, progress)
+	},
+	"scan": func(ctx context.Context, params json.RawMessage, progress jobProgressFunc) (interface{}, error) {
+		return scanSaveFiles(ctx, progress)
+	},
+}
+
+type jobManager struct {
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	cancels map[string]context.CancelFunc
+	queue   chan string
+	ctx     context.Context
+	stop    context.CancelFunc
+	quit    chan struct{}
+	closing bool
+	wg      sync.WaitGroup
+}
+
+var jobs = newJobManager()
+
+func newJobManager() *jobManager {
+	ctx, stop := context.WithCancel(context.Background())
+	return &jobManager{
+		jobs:    make(map[string]*Job),
+		cancels: make(map[string]context.CancelFunc),
+		queue:   make(chan string, maxQueueSize),
+		ctx:     ctx,
+		stop:    stop,
+		quit:    make(chan struct{}),
+	}
+}
+
+func newRandomID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func (m *jobManager) Start() {
+	m.load()
+	for i := 0; i < jobWorkers; i++ {
+		m.wg.Add(1)
+		go m.worker()
+	}
+	logInfo(m.ctx, "Job manager started with %d workers", jobWorkers)
+}
+
+func (m *jobManager) load() {
+	entries, err := os.ReadDir(jobsDir)
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		logError(m.ctx, "Jobs: failed to read jobs directory %s: %v", jobsDir, err)
+		return
+	}
+
+	var requeue []*Job
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(jobsDir, entry.Name()))
+		if err != nil {
+			logError(m.ctx, "Jobs: failed to read job record %s: %v", entry.Name(), err)
+			continue
+		}
+
+		var job Job
+		if err := json.Unmarshal(content, &job); err != nil {
+			logWarn(m.ctx, "Jobs: invalid job record %s: %v", entry.Name(), err)
+			continue
+		}
+
+		switch job.Status {
+		case jobRunning:
+			// Агент остановился посреди выполнения - результат неизвестен
+			now := time.Now()
+			job.Status = jobFailed
+			job.Error = "Interrupted by agent restart"
+			job.FinishedAt = &now
+			m.save(&job)
+		case jobQueued:
+			requeue = append(requeue, &job)
+		}
+
+		m.jobs[job.ID] = &job
+	}
+
+	// Не поместившиеся в очередь задания никто не заберёт позже, поэтому они завершаются ошибкой
+	sort.Slice(requeue, func(i, j int) bool { return requeue[i].CreatedAt.Before(requeue[j].CreatedAt) })
+	requeued := 0
+	for _, job := range requeue {
+		select {
+		case m.queue <- job.ID:
+			requeued++
+		default:
+			logWarn(m.ctx, "Jobs: queue full, job %s marked failed", job.ID)
+			now := time.Now()
+			job.Status = jobFailed
+			job.Error = fmt.Sprintf("Job queue was full after agent restart (max %d)", maxQueueSize)
+			job.FinishedAt = &now
+			m.save(job)
+		}
+	}
+
+	m.prune()
+	logInfo(m.ctx, "Jobs: loaded %d job records, %d re-queued", len(m.jobs), requeued)
+}
+
+func (m *jobManager) save(job *Job) {
+	if err := os.MkdirAll(jobsDir, 0755); err != nil {
+		logError(m.ctx, "Jobs: failed to create jobs directory %s: %v", jobsDir, err)
+		return
+	}
+
+	content, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		logError(m.ctx, "Jobs: failed to marshal job %s: %v", job.ID, err)
+		return
+	}
+
+	if err := os.WriteFile(filepath.Join(jobsDir, job.ID+".json"), content, 0644); err != nil {
+		logError(m.ctx, "Jobs: failed to save job %s: %v", job.ID, err)
+	}
+}
+
+func (m *jobManager) prune() {
+	cutoff := time.Now().Add(-jobRetention)
+	for id, job := range m.jobs {
+		if job.FinishedAt == nil || job.FinishedAt.After(cutoff) {
+			continue
+		}
+		delete(m.jobs, id)
+		if err := os.Remove(filepath.Join(jobsDir, id+".json")); err != nil && !os.IsNotExist(err) {
+			logError(m.ctx, "Jobs: failed to remove expired job %s: %v", id, err)
+		}
+	}
+}
+
+func (m *jobManager) Submit(jobType, server string, params json.RawMessage, actor AuditActor) (Job, error) {
+	if _, exists := jobRunners[jobType]; !exists {
+		return Job{}, fmt.Errorf("unknown job type %q", jobType)
+	}
+
+	job := &Job{
+		ID:        newRandomID(),
+		Type:      jobType,
+		Status:    jobQueued,
+		Params:    params,
+		Server:    server,
+		CreatedBy: &actor,
+		CreatedAt: time.Now(),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closing {
+		return Job{}, fmt.Errorf("agent is shutting down")
+	}
+
+	select {
+	case m.queue <- job.ID:
+	default:
+		return Job{}, fmt.Errorf("job queue is full (max %d)", maxQueueSize)
+	}
+
+	m.jobs[job.ID] = job
+	m.save(job)
+	logInfo(m.ctx, "Jobs: submitted job %s of type %s", job.ID, job.Type)
+	return *job, nil
+}
+
+func (m *jobManager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, exists := m.jobs[id]
+	if !exists {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+func (m *jobManager) List(status string) []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := make([]Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		if status == "" || job.Status == status {
+			list = append(list, *job)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+func (m *jobManager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, exists := m.jobs[id]
+	if !exists {
+		return Job{}, fmt.Errorf("job %s not found", id)
+	}
+
+	switch job.Status {
+	case jobQueued:
+		// Воркер увидит статус и пропустит задачу
+		now := time.Now()
+		job.Status = jobCanceled
+		job.FinishedAt = &now
+		m.save(job)
+	case jobRunning:
+		if cancel, exists := m.cancels[id]; exists {
+			cancel()
+		}
+	default:
+		return *job, fmt.Errorf("job %s is already %s", id, job.Status)
+	}
+
+	logInfo(m.ctx, "Jobs: cancellation requested for job %s", id)
+	return *job, nil
+}
+
+func (m *jobManager) worker() {
+	defer m.wg.Done()
+
+	for {
+		select {
+		case <-m.quit:
+			return
+		case <-m.ctx.Done():
+			return
+		case id := <-m.queue:
+			// Задача, взятая во время остановки, останется в очереди на диске
+			// и будет запущена после рестарта
+			select {
+			case <-m.quit:
+				return
+			default:
+			}
+			m.run(id)
+		}
+	}
+}
+
+func (m *jobManager) Shutdown(ctx context.Context) {
+	m.mu.Lock()
+	m.closing = true
+	m.mu.Unlock()
+	close(m.quit)
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logInfo(m.ctx, "Jobs: all workers stopped")
+	case <-ctx.Done():
+		// Не успевшие задачи отменяем, чтобы их статус был сохранён
+		logWarn(m.ctx, "Jobs: shutdown timeout reached, canceling running jobs")
+		m.stop()
+		<-done
+	}
+}
+
+func (m *jobManager) run(id string) {
+	m.mu.Lock()
+	job, exists := m.jobs[id]
+	if !exists || job.Status != jobQueued {
+		m.mu.Unlock()
+		return
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	defer cancel()
+	ctx = withLogAttrs(ctx, slog.String("job_id", id))
+
+	now := time.Now()
+	job.Status = jobRunning
+	job.StartedAt = &now
+	m.cancels[id] = cancel
+	m.save(job)
+	params := job.Params
+	runner := jobRunners[job.Type]
+	if job.CreatedBy != nil {
+		// Операции задачи попадают в аудит от имени того, кто её создал
+		ctx = withAuditActor(ctx, *job.CreatedBy)
+	}
+	// Профиль мог пропасть из конфига, пока задача ждала в очереди после перезапуска
+	srv, known := lookupServer(job.Server)
+	if known {
+		ctx = withServer(ctx, srv)
+	}
+	m.mu.Unlock()
+
+	logInfo(ctx, "Jobs: running job %s of type %s", id, job.Type)
+
+	progress := func(done, total int, message string) {
+		m.mu.Lock()
+		job.Progress = JobProgress{Done: done, Total: total, Message: message}
+		m.mu.Unlock()
+	}
+
+	var result interface{}
+	var err error
+	if known {
+		result, err = runner(ctx, params, progress)
+	} else {
+		err = fmt.Errorf("unknown server %s", job.Server)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	finished := time.Now()
+	job.FinishedAt = &finished
+	delete(m.cancels, id)
+
+	if result != nil {
+		if content, marshalErr := json.Marshal(result); marshalErr == nil {
+			job.Result = content
+		} else {
+			logError(ctx, "Jobs: failed to marshal result of job %s: %v", id, marshalErr)
+		}
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		job.Status = jobCanceled
+		job.Error = "Job canceled"
+	case err != nil:
+		job.Status = jobFailed
+		job.Error = err.Error()
+	default:
+		job.Status = jobSucceeded
+	}
+
+	m.save(job)
+	m.prune()
+	logInfo(ctx, "Jobs: job %s finished with status %s in %s", id, job.Status, finished.Sub(*job.StartedAt))
+}
+
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case "GET":
+		status := r.URL.Query().Get("status")
+		list := jobs.List(status)
+		logInfo(r.Context(), "Jobs handler: listing %d jobs (status filter: %q)", len(list), status)
+		writeResponse(w, r, JobListResponse{Success: true, Jobs: list})
+
+	case "POST":
+		var req JobSubmitRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			logWarn(r.Context(), "Jobs handler: invalid JSON in POST request: %v", err)
+			writeError(w, r, ErrInvalidJSON, "Invalid JSON")
+			return
+		}
+
+		if req.Type == "" {
+			logWarn(r.Context(), "Jobs handler: type is required")
+			writeError(w, r, ErrInvalidRequest, "type is required")
+			return
+		}
+
+		if r = requestServer(w, r, req.Server, "Jobs"); r == nil {
+			return
+		}
+
+		job, err := jobs.Submit(req.Type, serverFrom(r.Context()).Name, req.Params, requestActor(r))
+		beginAudit(r, "job-submit", "", "").details("type=%s id=%s", req.Type, job.ID).finish(err == nil, errString(err))
+		if err != nil {
+			logError(r.Context(), "Jobs handler: failed to submit job: %v", err)
+			writeResponseStatus(w, r, http.StatusBadRequest, JobResponse{Success: false, Error: err.Error(), ErrorCode: ErrInvalidRequest})
+			return
+		}
+
+		writeResponseStatus(w, r, http.StatusAccepted, JobResponse{Success: true, Job: &job})
+
+	default:
+		logWarn(r.Context(), "Jobs handler: method not allowed: %s", r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func jobHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case "GET":
+		job, exists := jobs.Get(id)
+		if !exists {
+			logWarn(r.Context(), "Job handler: job %s not found", id)
+			writeResponseStatus(w, r, http.StatusNotFound, JobResponse{Success: false, Error: "Job not found", ErrorCode: ErrNotFound})
+			return
+		}
+		writeResponse(w, r, JobResponse{Success: true, Job: &job})
+
+	case "DELETE":
+		cancelJob(w, r, id)
+
+	default:
+		logWarn(r.Context(), "Job handler: method not allowed: %s", r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func jobCancelHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		logWarn(r.Context(), "Job cancel handler: method not allowed: %s", r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	cancelJob(w, r, r.PathValue("id"))
+}
+
+func cancelJob(w http.ResponseWriter, r *http.Request, id string) {
+	logInfo(r.Context(), "Cancel job requested for %s", id)
+
+	job, err := jobs.Cancel(id)
+	beginAudit(r, "job-cancel", "", "").details("id=%s", id).finish(err == nil, errString(err))
+	if err != nil {
+		logWarn(r.Context(), "Failed to cancel job %s: %v", id, err)
+		code := ErrConflict
+		if job.ID == "" {
+			code = ErrNotFound
+		}
+		writeResponseStatus(w, r, statusForCode(code), JobResponse{Success: false, Job: nilIfEmpty(job), Error: err.Error(), ErrorCode: code})
+		return
+	}
+
+	writeResponse(w, r, JobResponse{Success: true, Job: &job})
+}
+
+func nilIfEmpty(job Job) *Job {
+	if job.ID == "" {
+		return nil
+	}
+	return &job
+}
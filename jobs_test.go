@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJobsReloadOverflowFails(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(jobsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	created := time.Now().Add(-time.Minute)
+	total := maxQueueSize + 2
+	for i := 0; i < total; i++ {
+		job := Job{ID: fmt.Sprintf("job%03d", i), Type: "snapshot", Status: jobQueued, CreatedAt: created.Add(time.Duration(i) * time.Millisecond)}
+		content, err := json.Marshal(job)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(jobsDir, job.ID+".json"), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Без воркеров: очередь заполняется только заданиями после перезапуска
+	m := newJobManager()
+	m.load()
+
+	if queued := len(m.queue); queued != maxQueueSize {
+		t.Fatalf("re-queued jobs = %d, want %d", queued, maxQueueSize)
+	}
+	for i := maxQueueSize; i < total; i++ {
+		job, ok := m.Get(fmt.Sprintf("job%03d", i))
+		if !ok || job.Status != jobFailed || job.FinishedAt == nil {
+			t.Fatalf("overflowed job %d = %+v, want failed", i, job)
+		}
+	}
+	if job, _ := m.Get("job000"); job.Status != jobQueued {
+		t.Fatalf("oldest job status = %s, want %s", job.Status, jobQueued)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type keyedLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+// Блокировки игрока на сервере: операции над одним игроком (файл игрока и его слоты)
+// выполняются строго последовательно, над разными игроками и на разных серверах - параллельно
+var playerLocks = newKeyedMutex()
+
+func lockPlayer(ctx context.Context, steamid string) func() {
+	return playerLocks.Lock(serverFrom(ctx).Name + "/" + steamid)
+}
+
+// Перенос между серверами блокирует игрока на обоих в одном порядке, чтобы встречные переносы не ждали друг друга вечно
+func lockPlayerOnServers(ctx context.Context, from, to *gameServer, steamid string) func() {
+	if from.Name == to.Name {
+		return lockPlayer(withServer(ctx, from), steamid)
+	}
+	if to.Name < from.Name {
+		from, to = to, from
+	}
+	unlockFrom := lockPlayer(withServer(ctx, from), steamid)
+	unlockTo := lockPlayer(withServer(ctx, to), steamid)
+	return func() {
+		unlockTo()
+		unlockFrom()
+	}
+}
+
+func newKeyedMutex() *keyedMutex {
+	return &keyedMutex{locks: make(map[string]*keyedLock)}
+}
+
+func (k *keyedMutex) Lock(key string) func() {
+	k.mu.Lock()
+	lock, exists := k.locks[key]
+	if !exists {
+		lock = &keyedLock{}
+		k.locks[key] = lock
+	}
+	lock.refs++
+	k.mu.Unlock()
+
+	start := time.Now()
+	lock.mu.Lock()
+	lockWaitSeconds.Observe(time.Since(start).Seconds())
+
+	return func() {
+		lock.mu.Unlock()
+
+		k.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
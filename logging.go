@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+type logAttrsKey struct{}
+
+type requestIDKey struct{}
+
+// contextHandler дописывает к каждой записи атрибуты из контекста (request_id, job_id и т.п.)
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		if attrs, ok := ctx.Value(logAttrsKey{}).([]slog.Attr); ok {
+			record.AddAttrs(attrs...)
+		}
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+func withLogAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	merged := make([]slog.Attr, 0, len(existing)+len(attrs))
+	merged = append(append(merged, existing...), attrs...)
+	return context.WithValue(ctx, logAttrsKey{}, merged)
+}
+
+func withRequestID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	return withLogAttrs(ctx, slog.String("request_id", id))
+}
+
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func parseLogLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q", level)
+}
+
+func setupLogging(cfg LoggingConfig) error {
+	level, err := parseLogLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stdout, options)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stdout, options)
+	default:
+		return fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	// Стандартный log тоже уходит в slog, поэтому сторонние сообщения не теряются
+	slog.SetDefault(slog.New(contextHandler{handler}))
+	return nil
+}
+
+func logAt(ctx context.Context, level slog.Level, format string, args ...interface{}) {
+	logger := slog.Default()
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	logger.Log(ctx, level, fmt.Sprintf(format, args...))
+}
+
+func logDebug(ctx context.Context, format string, args ...interface{}) {
+	logAt(ctx, slog.LevelDebug, format, args...)
+}
+
+func logInfo(ctx context.Context, format string, args ...interface{}) {
+	logAt(ctx, slog.LevelInfo, format, args...)
+}
+
+func logWarn(ctx context.Context, format string, args ...interface{}) {
+	logAt(ctx, slog.LevelWarn, format, args...)
+}
+
+func logError(ctx context.Context, format string, args ...interface{}) {
+	logAt(ctx, slog.LevelError, format, args...)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(data []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(data)
+	s.bytes += int64(n)
+	return n, err
+}
+
+// SSE и WebSocket обработчикам нужны Flush и Hijack исходного ResponseWriter
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijacking is not supported")
+	}
+	if s.status == 0 {
+		s.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+type routeKey struct{}
+
+// ServeMux выставляет шаблон маршрута на переданном ему запросе, а middleware между ним и requestLogging
+// могут подменить запрос (serverSelection меняет контекст), поэтому шаблон возвращается через контекст
+func recordRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if route, ok := r.Context().Value(routeKey{}).(*string); ok {
+			*route = r.Pattern
+		}
+	})
+}
+
+func requestLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		// ID от клиента или прокси сохраняем, чтобы запрос можно было проследить через всю цепочку
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRandomID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		var route string
+		ctx := withRequestID(r.Context(), id)
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(ctx, routeKey{}, &route)))
+		elapsed := time.Since(start)
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+
+		slog.LogAttrs(ctx, level, "Request completed",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int64("bytes", recorder.bytes),
+			slog.Duration("duration", elapsed),
+			slog.String("remote_addr", r.RemoteAddr),
+		)
+
+		// У ненайденных путей шаблон пустой
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequestsTotal.Inc(route, r.Method, strconv.Itoa(status))
+		httpRequestDuration.Observe(elapsed.Seconds(), route)
+	})
+}
@@ -1,145 +1,76 @@
 package main
 
 import (
+	"DinoAgentApi/api"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 )
 
-type CheckRequest struct {
-	SteamID   string `json:"steamid"`
-	OldSlotID string `json:"old_slot_id,omitempty"`
-	SlotID    string `json:"slot_id,omitempty"`
-}
-
-type CheckResponse struct {
-	Exists   bool   `json:"exists"`
-	FilePath string `json:"file_path"`
-	Error    string `json:"error,omitempty"`
-}
-
-type FileContentResponse struct {
-	Success bool            `json:"success"`
-	Content json.RawMessage `json:"content,omitempty"`
-	Error   string          `json:"error,omitempty"`
-}
-
-type TransferResponse struct {
-	Success    bool   `json:"success"`
-	Message    string `json:"message"`
-	PlayerFile string `json:"player_file"`
-	SlotFile   string `json:"slot_file"`
-	Error      string `json:"error,omitempty"`
-}
-
-type EmptySlotResponse struct {
-	Success  bool   `json:"success"`
-	Message  string `json:"message"`
-	SlotFile string `json:"slot_file"`
-	Error    string `json:"error,omitempty"`
-}
-
-type RestoreSlotResponse struct {
-	Success    bool   `json:"success"`
-	Message    string `json:"message"`
-	PlayerFile string `json:"player_file"`
-	SlotFile   string `json:"slot_file"`
-	Error      string `json:"error,omitempty"`
-}
-
-type WriteSlotRequest struct {
-	SteamID  string          `json:"steamid"`
-	FileName string          `json:"file_name"`
-	Data     json.RawMessage `json:"data"`
-}
-
-type WriteSlotResponse struct {
-	Success  bool   `json:"success"`
-	Message  string `json:"message"`
-	FilePath string `json:"file_path,omitempty"`
-	Error    string `json:"error,omitempty"`
-}
-
-type FilePathRequest struct {
-	FilePath string `json:"file_path"`
-}
-
-type FileContentByPathResponse struct {
-	Success bool   `json:"success"`
-	Content string `json:"content,omitempty"`
-	Error   string `json:"error,omitempty"`
-	Size    int64  `json:"size,omitempty"`
-}
-
-type WriteFileRequest struct {
-	FilePath string          `json:"file_path"`
-	Data     json.RawMessage `json:"data"`
-}
-
-type WriteFileResponse struct {
-	Success  bool   `json:"success"`
-	Message  string `json:"message"`
-	FilePath string `json:"file_path,omitempty"`
-	Size     int64  `json:"size,omitempty"`
-	Error    string `json:"error,omitempty"`
-}
-
-type FileInfoResponse struct {
-	Success              bool      `json:"success"`
-	FilePath             string    `json:"file_path,omitempty"`
-	Exists               bool      `json:"exists"`
-	IsDirectory          bool      `json:"is_directory,omitempty"`
-	Size                 int64     `json:"size,omitempty"`
-	ModTime              time.Time `json:"mod_time,omitempty"`
-	ModTimeUnix          int64     `json:"mod_time_unix,omitempty"`
-	ModTimeFormatted     string    `json:"mod_time_formatted,omitempty"`
-	CreatedTime          time.Time `json:"created_time,omitempty"`
-	CreatedTimeUnix      int64     `json:"created_time_unix,omitempty"`
-	CreatedTimeFormatted string    `json:"created_time_formatted,omitempty"`
-	Error                string    `json:"error,omitempty"`
-}
-
-type DeleteFileResponse struct {
-	Success    bool   `json:"success"`
-	Message    string `json:"message"`
-	FilePath   string `json:"file_path,omitempty"`
-	Deleted    bool   `json:"deleted"`
-	BackupPath string `json:"backup_path,omitempty"`
-	Error      string `json:"error,omitempty"`
-}
+type (
+	CheckRequest              = api.CheckRequest
+	CheckResponse             = api.CheckResponse
+	FileContentResponse       = api.FileContentResponse
+	TransferResponse          = api.TransferResponse
+	EmptySlotResponse         = api.EmptySlotResponse
+	RestoreSlotResponse       = api.RestoreSlotResponse
+	WriteSlotRequest          = api.WriteSlotRequest
+	WriteSlotResponse         = api.WriteSlotResponse
+	FilePathRequest           = api.FilePathRequest
+	FileContentByPathResponse = api.FileContentByPathResponse
+	WriteFileRequest          = api.WriteFileRequest
+	WriteFileResponse         = api.WriteFileResponse
+	FileInfoResponse          = api.FileInfoResponse
+	DeleteFileResponse        = api.DeleteFileResponse
+	DeleteFileRequest         = api.DeleteFileRequest
+)
 
 const (
-	playersDir = `C:\EVRIMA\surv_server\TheIsle\Saved\Databases\Survival\Players`
-	slotsDir   = `C:\EVRIMA\surv_server\TheIsle\Saved\Slots`
+	// Каталоги сервера по умолчанию, если профили в конфиге не заданы (см. servers.go)
+	defaultPlayersDir = `C:\EVRIMA\surv_server\TheIsle\Saved\Databases\Survival\Players`
+	defaultSlotsDir   = `C:\EVRIMA\surv_server\TheIsle\Saved\Slots`
+
 	backupDir  = `C:\EVRIMA\surv_server\backups`
+	historyDir = `C:\EVRIMA\surv_server\history`
+	jobsDir    = `C:\EVRIMA\surv_server\jobs`
+
+	agentPort = ":8080"
 )
 
-func writeFileByPath(filePath string, data json.RawMessage) WriteFileResponse {
-	log.Printf("Writing file by path: %s", filePath)
+func writeFileByPath(ctx context.Context, filePath string, data json.RawMessage) (result WriteFileResponse) {
+	logInfo(ctx, "Writing file by path: %s", filePath)
+	defer func() {
+		emitWebhook(ctx, WebhookEvent{Operation: "write-file", Success: result.Success, FilePath: filePath, Error: result.Error, Data: result})
+	}()
 
 	// Проверяем, что путь не пустой
 	if filePath == "" {
 		result := WriteFileResponse{
-			Success: false,
-			Error:   "File path is required",
+			Success:   false,
+			Error:     "File path is required",
+			ErrorCode: ErrInvalidRequest,
 		}
-		log.Printf("File path is empty")
+		logWarn(ctx, "File path is empty")
 		return result
 	}
 
 	// Проверяем, что данные не пустые
 	if len(data) == 0 {
 		result := WriteFileResponse{
-			Success: false,
-			Error:   "Data is required",
+			Success:   false,
+			Error:     "Data is required",
+			ErrorCode: ErrInvalidRequest,
 		}
-		log.Printf("Data is empty")
+		logWarn(ctx, "Data is empty")
 		return result
 	}
 
@@ -147,10 +78,11 @@ func writeFileByPath(filePath string, data json.RawMessage) WriteFileResponse {
 	var jsonData interface{}
 	if err := json.Unmarshal(data, &jsonData); err != nil {
 		result := WriteFileResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Invalid JSON data: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Invalid JSON data: %v", err),
+			ErrorCode: ErrInvalidJSON,
 		}
-		log.Printf("Invalid JSON data: %v", err)
+		logWarn(ctx, "Invalid JSON data: %v", err)
 		return result
 	}
 
@@ -158,10 +90,11 @@ func writeFileByPath(filePath string, data json.RawMessage) WriteFileResponse {
 	formattedData, err := json.MarshalIndent(jsonData, "", "  ")
 	if err != nil {
 		result := WriteFileResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to format JSON: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to format JSON: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to format JSON: %v", err)
+		logError(ctx, "Failed to format JSON: %v", err)
 		return result
 	}
 
@@ -169,22 +102,28 @@ func writeFileByPath(filePath string, data json.RawMessage) WriteFileResponse {
 	dir := filepath.Dir(filePath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		result := WriteFileResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to create directory: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to create directory: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to create directory %s: %v", dir, err)
+		logError(ctx, "Failed to create directory %s: %v", dir, err)
 		return result
 	}
 
+	// Сохраняем предыдущее содержимое в историю версий
+	recordFileVersion(ctx, filePath, "write-file")
+
 	// Записываем файл
 	if err := os.WriteFile(filePath, formattedData, 0644); err != nil {
 		result := WriteFileResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to write file: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to write file: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to write file %s: %v", filePath, err)
+		logError(ctx, "Failed to write file %s: %v", filePath, err)
 		return result
 	}
+	fileBytesWritten.Add(float64(len(formattedData)))
 
 	// Получаем информацию о файле для логирования
 	fileInfo, err := os.Stat(filePath)
@@ -193,28 +132,29 @@ func writeFileByPath(filePath string, data json.RawMessage) WriteFileResponse {
 		fileSize = fileInfo.Size()
 	}
 
-	log.Printf("Successfully wrote file: %s, size: %d bytes", filePath, fileSize)
+	logInfo(ctx, "Successfully wrote file: %s, size: %d bytes", filePath, fileSize)
 
-	result := WriteFileResponse{
+	result = WriteFileResponse{
 		Success:  true,
 		Message:  fmt.Sprintf("File %s successfully written", filepath.Base(filePath)),
 		FilePath: filePath,
 		Size:     fileSize,
 	}
-	log.Printf("File write completed successfully")
+	logInfo(ctx, "File write completed successfully")
 	return result
 }
 
-func getFileContentByPath(filePath string) FileContentByPathResponse {
-	log.Printf("Getting file content by path: %s", filePath)
+func getFileContentByPath(ctx context.Context, filePath string) FileContentByPathResponse {
+	logInfo(ctx, "Getting file content by path: %s", filePath)
 
 	// Проверяем, что путь не пустой
 	if filePath == "" {
 		result := FileContentByPathResponse{
-			Success: false,
-			Error:   "File path is required",
+			Success:   false,
+			Error:     "File path is required",
+			ErrorCode: ErrInvalidRequest,
 		}
-		log.Printf("File path is empty")
+		logWarn(ctx, "File path is empty")
 		return result
 	}
 
@@ -222,37 +162,41 @@ func getFileContentByPath(filePath string) FileContentByPathResponse {
 	fileInfo, err := os.Stat(filePath)
 	if os.IsNotExist(err) {
 		result := FileContentByPathResponse{
-			Success: false,
-			Error:   "File not found",
+			Success:   false,
+			Error:     "File not found",
+			ErrorCode: ErrNotFound,
 		}
-		log.Printf("File not found: %s", filePath)
+		logWarn(ctx, "File not found: %s", filePath)
 		return result
 	} else if err != nil {
 		result := FileContentByPathResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Error checking file: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Error checking file: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Error checking file: %v", err)
+		logError(ctx, "Error checking file: %v", err)
 		return result
 	}
 
 	// Проверяем, что это файл, а не директория
 	if fileInfo.IsDir() {
 		result := FileContentByPathResponse{
-			Success: false,
-			Error:   "Path points to a directory, not a file",
+			Success:   false,
+			Error:     "Path points to a directory, not a file",
+			ErrorCode: ErrInvalidRequest,
 		}
-		log.Printf("Path is a directory: %s", filePath)
+		logWarn(ctx, "Path is a directory: %s", filePath)
 		return result
 	}
 
 	// Проверяем размер файла (ограничим очень большие файлы)
 	if fileInfo.Size() > 10*1024*1024 { // 10MB limit
 		result := FileContentByPathResponse{
-			Success: false,
-			Error:   "File too large (max 10MB)",
+			Success:   false,
+			Error:     "File too large (max 10MB)",
+			ErrorCode: ErrInvalidRequest,
 		}
-		log.Printf("File too large: %d bytes", fileInfo.Size())
+		logWarn(ctx, "File too large: %d bytes", fileInfo.Size())
 		return result
 	}
 
@@ -260,10 +204,11 @@ func getFileContentByPath(filePath string) FileContentByPathResponse {
 	file, err := os.Open(filePath)
 	if err != nil {
 		result := FileContentByPathResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to open file: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to open file: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to open file: %v", err)
+		logError(ctx, "Failed to open file: %v", err)
 		return result
 	}
 	defer file.Close()
@@ -272,42 +217,45 @@ func getFileContentByPath(filePath string) FileContentByPathResponse {
 	content, err := io.ReadAll(file)
 	if err != nil {
 		result := FileContentByPathResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to read file: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to read file: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to read file: %v", err)
+		logError(ctx, "Failed to read file: %v", err)
 		return result
 	}
+	fileBytesRead.Add(float64(len(content)))
 
-	log.Printf("Successfully read file content, size: %d bytes", len(content))
+	logInfo(ctx, "Successfully read file content, size: %d bytes", len(content))
 
 	result := FileContentByPathResponse{
 		Success: true,
 		Content: string(content),
 		Size:    int64(len(content)),
 	}
-	log.Printf("File content retrieved successfully")
+	logInfo(ctx, "File content retrieved successfully")
 	return result
 }
 
-func checkPlayerFile(steamid string) CheckResponse {
-	log.Printf("Checking player file for SteamID: %s", steamid)
-	playerFile := filepath.Join(playersDir, steamid+".json")
+func checkPlayerFile(ctx context.Context, steamid string) CheckResponse {
+	logInfo(ctx, "Checking player file for SteamID: %s", steamid)
+	playerFile := playerFilePath(ctx, steamid)
 
 	if _, err := os.Stat(playerFile); os.IsNotExist(err) {
 		result := CheckResponse{
 			Exists:   false,
 			FilePath: playerFile,
 		}
-		log.Printf("Player file not found: %s", playerFile)
+		logWarn(ctx, "Player file not found: %s", playerFile)
 		return result
 	} else if err != nil {
 		result := CheckResponse{
-			Exists:   false,
-			FilePath: playerFile,
-			Error:    err.Error(),
+			Exists:    false,
+			FilePath:  playerFile,
+			Error:     err.Error(),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Error checking player file: %v", err)
+		logError(ctx, "Error checking player file: %v", err)
 		return result
 	}
 
@@ -315,28 +263,30 @@ func checkPlayerFile(steamid string) CheckResponse {
 		Exists:   true,
 		FilePath: playerFile,
 	}
-	log.Printf("Player file exists: %s", playerFile)
+	logInfo(ctx, "Player file exists: %s", playerFile)
 	return result
 }
 
-func getPlayerFileContent(steamid string) FileContentResponse {
-	log.Printf("Getting player file content for SteamID: %s", steamid)
-	playerFile := filepath.Join(playersDir, steamid+".json")
+func getPlayerFileContent(ctx context.Context, steamid string) FileContentResponse {
+	logInfo(ctx, "Getting player file content for SteamID: %s", steamid)
+	playerFile := playerFilePath(ctx, steamid)
 
 	// Проверяем существование файла
 	if _, err := os.Stat(playerFile); os.IsNotExist(err) {
 		result := FileContentResponse{
-			Success: false,
-			Error:   "File not found",
+			Success:   false,
+			Error:     "File not found",
+			ErrorCode: ErrNotFound,
 		}
-		log.Printf("Player file not found: %s", playerFile)
+		logWarn(ctx, "Player file not found: %s", playerFile)
 		return result
 	} else if err != nil {
 		result := FileContentResponse{
-			Success: false,
-			Error:   err.Error(),
+			Success:   false,
+			Error:     err.Error(),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Error checking player file: %v", err)
+		logError(ctx, "Error checking player file: %v", err)
 		return result
 	}
 
@@ -344,10 +294,11 @@ func getPlayerFileContent(steamid string) FileContentResponse {
 	file, err := os.Open(playerFile)
 	if err != nil {
 		result := FileContentResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to open file: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to open file: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to open player file: %v", err)
+		logError(ctx, "Failed to open player file: %v", err)
 		return result
 	}
 	defer file.Close()
@@ -356,21 +307,24 @@ func getPlayerFileContent(steamid string) FileContentResponse {
 	content, err := io.ReadAll(file)
 	if err != nil {
 		result := FileContentResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to read file: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to read file: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to read player file: %v", err)
+		logError(ctx, "Failed to read player file: %v", err)
 		return result
 	}
+	fileBytesRead.Add(float64(len(content)))
 
 	// Валидируем JSON (опционально, но рекомендуется)
 	var jsonData json.RawMessage
 	if err := json.Unmarshal(content, &jsonData); err != nil {
 		result := FileContentResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Invalid JSON in file: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Invalid JSON in file: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Invalid JSON in player file: %v", err)
+		logWarn(ctx, "Invalid JSON in player file: %v", err)
 		return result
 	}
 
@@ -378,28 +332,30 @@ func getPlayerFileContent(steamid string) FileContentResponse {
 		Success: true,
 		Content: jsonData,
 	}
-	log.Printf("Successfully read player file content, length: %d bytes", len(content))
+	logInfo(ctx, "Successfully read player file content, length: %d bytes", len(content))
 	return result
 }
 
-func getSlotFileContent(steamid, slotID string) FileContentResponse {
-	log.Printf("Getting slot file content for SteamID: %s, SlotID: %s", steamid, slotID)
-	slotFile := filepath.Join(slotsDir, steamid, slotID+".json")
+func getSlotFileContent(ctx context.Context, steamid, slotID string) FileContentResponse {
+	logInfo(ctx, "Getting slot file content for SteamID: %s, SlotID: %s", steamid, slotID)
+	slotFile := slotFilePath(ctx, steamid, slotID)
 
 	// Проверяем существование файла
 	if _, err := os.Stat(slotFile); os.IsNotExist(err) {
 		result := FileContentResponse{
-			Success: false,
-			Error:   "Slot file not found",
+			Success:   false,
+			Error:     "Slot file not found",
+			ErrorCode: ErrNotFound,
 		}
-		log.Printf("Slot file not found: %s", slotFile)
+		logWarn(ctx, "Slot file not found: %s", slotFile)
 		return result
 	} else if err != nil {
 		result := FileContentResponse{
-			Success: false,
-			Error:   err.Error(),
+			Success:   false,
+			Error:     err.Error(),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Error checking slot file: %v", err)
+		logError(ctx, "Error checking slot file: %v", err)
 		return result
 	}
 
@@ -407,10 +363,11 @@ func getSlotFileContent(steamid, slotID string) FileContentResponse {
 	file, err := os.Open(slotFile)
 	if err != nil {
 		result := FileContentResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to open slot file: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to open slot file: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to open slot file: %v", err)
+		logError(ctx, "Failed to open slot file: %v", err)
 		return result
 	}
 	defer file.Close()
@@ -419,21 +376,24 @@ func getSlotFileContent(steamid, slotID string) FileContentResponse {
 	content, err := io.ReadAll(file)
 	if err != nil {
 		result := FileContentResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to read slot file: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to read slot file: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to read slot file: %v", err)
+		logError(ctx, "Failed to read slot file: %v", err)
 		return result
 	}
+	fileBytesRead.Add(float64(len(content)))
 
 	// Валидируем JSON (опционально, но рекомендуется)
 	var jsonData json.RawMessage
 	if err := json.Unmarshal(content, &jsonData); err != nil {
 		result := FileContentResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Invalid JSON in slot file: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Invalid JSON in slot file: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Invalid JSON in slot file: %v", err)
+		logWarn(ctx, "Invalid JSON in slot file: %v", err)
 		return result
 	}
 
@@ -441,30 +401,36 @@ func getSlotFileContent(steamid, slotID string) FileContentResponse {
 		Success: true,
 		Content: jsonData,
 	}
-	log.Printf("Successfully read slot file content, length: %d bytes", len(content))
+	logInfo(ctx, "Successfully read slot file content, length: %d bytes", len(content))
 	return result
 }
 
-func transferPlayerSlot(steamid, oldSlotID string) TransferResponse {
-	log.Printf("Transferring player slot for SteamID: %s, OldSlotID: %s", steamid, oldSlotID)
-	playerFile := filepath.Join(playersDir, steamid+".json")
-	remoteDir := filepath.Join(`C:\EVRIMA\surv_server\TheIsle\Saved\Slots`, steamid)
+func transferPlayerSlot(ctx context.Context, steamid, oldSlotID string) (result TransferResponse) {
+	ctx = withLogAttrs(ctx, slog.String("steamid", steamid), slog.String("slot_id", oldSlotID))
+	logInfo(ctx, "Transferring player slot for SteamID: %s, OldSlotID: %s", steamid, oldSlotID)
+	defer func() {
+		emitWebhook(ctx, WebhookEvent{Operation: "transfer", Success: result.Success, SteamID: steamid, SlotID: oldSlotID, Error: result.Error, Data: result})
+	}()
+	playerFile := playerFilePath(ctx, steamid)
+	remoteDir := playerSlotsDir(ctx, steamid)
 	oldSlotFile := filepath.Join(remoteDir, oldSlotID+".json")
 
 	// Проверяем существование исходного файла
 	if _, err := os.Stat(playerFile); os.IsNotExist(err) {
 		result := TransferResponse{
-			Success: false,
-			Error:   "Player file not found",
+			Success:   false,
+			Error:     "Player file not found",
+			ErrorCode: ErrNotFound,
 		}
-		log.Printf("Player file not found: %s", playerFile)
+		logWarn(ctx, "Player file not found: %s", playerFile)
 		return result
 	} else if err != nil {
 		result := TransferResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Error checking player file: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Error checking player file: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Error checking player file: %v", err)
+		logError(ctx, "Error checking player file: %v", err)
 		return result
 	}
 
@@ -472,12 +438,14 @@ func transferPlayerSlot(steamid, oldSlotID string) TransferResponse {
 	content, err := os.ReadFile(playerFile)
 	if err != nil {
 		result := TransferResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to read player file: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to read player file: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to read player file: %v", err)
+		logError(ctx, "Failed to read player file: %v", err)
 		return result
 	}
+	fileBytesRead.Add(float64(len(content)))
 
 	// Проверяем, не является ли файл пустым или невалидным
 	var decoded map[string]interface{}
@@ -490,69 +458,79 @@ func transferPlayerSlot(steamid, oldSlotID string) TransferResponse {
 		content, err = json.MarshalIndent(newData, "", "  ")
 		if err != nil {
 			result := TransferResponse{
-				Success: false,
-				Error:   fmt.Sprintf("Failed to create new JSON: %v", err),
+				Success:   false,
+				Error:     fmt.Sprintf("Failed to create new JSON: %v", err),
+				ErrorCode: ErrIO,
 			}
-			log.Printf("Failed to create new JSON: %v", err)
+			logError(ctx, "Failed to create new JSON: %v", err)
 			return result
 		}
-		log.Printf("Created new JSON structure for invalid file")
+		logDebug(ctx, "Created new JSON structure for invalid file")
 	} else if _, exists := decoded["slot_id"]; !exists {
 		// Добавляем slot_id если его нет
 		decoded["slot_id"] = oldSlotID
 		content, err = json.MarshalIndent(decoded, "", "  ")
 		if err != nil {
 			result := TransferResponse{
-				Success: false,
-				Error:   fmt.Sprintf("Failed to add slot_id to JSON: %v", err),
+				Success:   false,
+				Error:     fmt.Sprintf("Failed to add slot_id to JSON: %v", err),
+				ErrorCode: ErrIO,
 			}
-			log.Printf("Failed to add slot_id to JSON: %v", err)
+			logError(ctx, "Failed to add slot_id to JSON: %v", err)
 			return result
 		}
-		log.Printf("Added slot_id to existing JSON")
+		logDebug(ctx, "Added slot_id to existing JSON")
 	}
 
 	// Создаем директорию для слотов если не существует
 	if err := os.MkdirAll(remoteDir, 0755); err != nil {
 		result := TransferResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to create directory: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to create directory: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to create directory: %v", err)
+		logError(ctx, "Failed to create directory: %v", err)
 		return result
 	}
 
+	// Сохраняем предыдущие версии слота и файла игрока в историю
+	recordFileVersion(ctx, oldSlotFile, "transfer")
+	recordFileVersion(ctx, playerFile, "transfer")
+
 	// Сохраняем в слот
 	if err := os.WriteFile(oldSlotFile, content, 0644); err != nil {
 		result := TransferResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to write slot file: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to write slot file: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to write slot file: %v", err)
+		logError(ctx, "Failed to write slot file: %v", err)
 		return result
 	}
+	fileBytesWritten.Add(float64(len(content)))
 
 	// Очищаем старый файл игрока после сохранения
 	if err := os.Remove(playerFile); err != nil {
 		// Логируем ошибку, но не прерываем выполнение
-		log.Printf("Warning: Failed to delete player file: %v", err)
+		logWarn(ctx, "Failed to delete player file: %v", err)
 	}
 
-	log.Printf("Old slot %s transferred from %s to %s", oldSlotID, playerFile, oldSlotFile)
+	logInfo(ctx, "Old slot %s transferred from %s to %s", oldSlotID, playerFile, oldSlotFile)
 
-	result := TransferResponse{
+	result = TransferResponse{
 		Success:    true,
 		Message:    fmt.Sprintf("Slot %s successfully transferred", oldSlotID),
 		PlayerFile: playerFile,
 		SlotFile:   oldSlotFile,
 	}
-	log.Printf("Transfer completed successfully")
+	logInfo(ctx, "Transfer completed successfully")
 	return result
 }
 
-func createEmptySlot(steamid, oldSlotID string) EmptySlotResponse {
-	log.Printf("Creating empty slot for SteamID: %s, SlotID: %s", steamid, oldSlotID)
-	remoteDir := filepath.Join(`C:\EVRIMA\surv_server\TheIsle\Saved\Slots`, steamid)
+func createEmptySlot(ctx context.Context, steamid, oldSlotID string) EmptySlotResponse {
+	ctx = withLogAttrs(ctx, slog.String("steamid", steamid), slog.String("slot_id", oldSlotID))
+	logInfo(ctx, "Creating empty slot for SteamID: %s, SlotID: %s", steamid, oldSlotID)
+	remoteDir := playerSlotsDir(ctx, steamid)
 	oldSlotFile := filepath.Join(remoteDir, oldSlotID+".json")
 
 	// Создаем структуру для пустого слота
@@ -565,67 +543,77 @@ func createEmptySlot(steamid, oldSlotID string) EmptySlotResponse {
 	emptySlotJSON, err := json.MarshalIndent(emptySlot, "", "  ")
 	if err != nil {
 		result := EmptySlotResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to marshal JSON: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to marshal JSON: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to marshal JSON for empty slot: %v", err)
+		logError(ctx, "Failed to marshal JSON for empty slot: %v", err)
 		return result
 	}
 
 	// Создаем директорию для слотов если не существует
 	if err := os.MkdirAll(remoteDir, 0755); err != nil {
 		result := EmptySlotResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to create directory: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to create directory: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to create directory: %v", err)
+		logError(ctx, "Failed to create directory: %v", err)
 		return result
 	}
 
 	// Сохраняем пустой слот
 	if err := os.WriteFile(oldSlotFile, emptySlotJSON, 0644); err != nil {
 		result := EmptySlotResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to write empty slot file: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to write empty slot file: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to write empty slot file: %v", err)
+		logError(ctx, "Failed to write empty slot file: %v", err)
 		return result
 	}
+	fileBytesWritten.Add(float64(len(emptySlotJSON)))
 
-	log.Printf("Empty slot created for steamid %s, slot %s at %s", steamid, oldSlotID, oldSlotFile)
+	logInfo(ctx, "Empty slot created for steamid %s, slot %s at %s", steamid, oldSlotID, oldSlotFile)
 
 	result := EmptySlotResponse{
 		Success:  true,
 		Message:  fmt.Sprintf("Empty slot %s created successfully", oldSlotID),
 		SlotFile: oldSlotFile,
 	}
-	log.Printf("Empty slot creation completed successfully")
+	logInfo(ctx, "Empty slot creation completed successfully")
 	return result
 }
 
-func restoreSlotFromFile(steamid, slotID string) RestoreSlotResponse {
-	log.Printf("Restoring slot from file for SteamID: %s, SlotID: %s", steamid, slotID)
-	remoteDir := filepath.Join(slotsDir, steamid)
-	playersDirPath := playersDir
+func restoreSlotFromFile(ctx context.Context, steamid, slotID string) (result RestoreSlotResponse) {
+	ctx = withLogAttrs(ctx, slog.String("steamid", steamid), slog.String("slot_id", slotID))
+	logInfo(ctx, "Restoring slot from file for SteamID: %s, SlotID: %s", steamid, slotID)
+	defer func() {
+		emitWebhook(ctx, WebhookEvent{Operation: "restore-slot", Success: result.Success, SteamID: steamid, SlotID: slotID, Error: result.Error, Data: result})
+	}()
+	remoteDir := playerSlotsDir(ctx, steamid)
+	playersDirPath := serverFrom(ctx).PlayersDir
 	slotFile := filepath.Join(remoteDir, slotID+".json")
 	playerFile := filepath.Join(playersDirPath, steamid+".json")
 
 	// Создаем директории если не существуют
 	if err := os.MkdirAll(remoteDir, 0755); err != nil {
 		result := RestoreSlotResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to create remote directory: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to create remote directory: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to create remote directory: %v", err)
+		logError(ctx, "Failed to create remote directory: %v", err)
 		return result
 	}
 
 	if err := os.MkdirAll(playersDirPath, 0755); err != nil {
 		result := RestoreSlotResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to create players directory: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to create players directory: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to create players directory: %v", err)
+		logError(ctx, "Failed to create players directory: %v", err)
 		return result
 	}
 
@@ -641,33 +629,34 @@ func restoreSlotFromFile(steamid, slotID string) RestoreSlotResponse {
 		jsonData, err := json.MarshalIndent(emptySlot, "", "  ")
 		if err != nil {
 			result := RestoreSlotResponse{
-				Success: false,
-				Error:   fmt.Sprintf("Failed to marshal empty slot JSON: %v", err),
+				Success:   false,
+				Error:     fmt.Sprintf("Failed to marshal empty slot JSON: %v", err),
+				ErrorCode: ErrIO,
 			}
-			log.Printf("Failed to marshal empty slot JSON: %v", err)
+			logError(ctx, "Failed to marshal empty slot JSON: %v", err)
 			return result
 		}
 
 		// Сохраняем пустой слот
 		if err := os.WriteFile(slotFile, jsonData, 0644); err != nil {
 			result := RestoreSlotResponse{
-				Success: false,
-				Error:   fmt.Sprintf("Failed to create empty slot file: %v", err),
+				Success:   false,
+				Error:     fmt.Sprintf("Failed to create empty slot file: %v", err),
+				ErrorCode: ErrIO,
 			}
-			log.Printf("Failed to create empty slot file: %v", err)
+			logError(ctx, "Failed to create empty slot file: %v", err)
 			return result
 		}
+		fileBytesWritten.Add(float64(len(jsonData)))
 
-		log.Printf("Created empty slot: %s", slotFile)
-
-		// Используем созданный пустой слот для восстановления
-		jsonData = jsonData
+		logInfo(ctx, "Created empty slot: %s", slotFile)
 	} else if err != nil {
 		result := RestoreSlotResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Error checking slot file: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Error checking slot file: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Error checking slot file: %v", err)
+		logError(ctx, "Error checking slot file: %v", err)
 		return result
 	}
 
@@ -675,21 +664,24 @@ func restoreSlotFromFile(steamid, slotID string) RestoreSlotResponse {
 	slotContent, err := os.ReadFile(slotFile)
 	if err != nil {
 		result := RestoreSlotResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to read slot file: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to read slot file: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to read slot file: %v", err)
+		logError(ctx, "Failed to read slot file: %v", err)
 		return result
 	}
+	fileBytesRead.Add(float64(len(slotContent)))
 
 	// Валидируем JSON из слота
 	var slotData map[string]interface{}
 	if err := json.Unmarshal(slotContent, &slotData); err != nil {
 		result := RestoreSlotResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Invalid JSON in slot file: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Invalid JSON in slot file: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Invalid JSON in slot file: %v", err)
+		logWarn(ctx, "Invalid JSON in slot file: %v", err)
 		return result
 	}
 
@@ -700,53 +692,64 @@ func restoreSlotFromFile(steamid, slotID string) RestoreSlotResponse {
 	jsonData, err := json.MarshalIndent(slotData, "", "  ")
 	if err != nil {
 		result := RestoreSlotResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to marshal JSON for player file: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to marshal JSON for player file: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to marshal JSON for player file: %v", err)
+		logError(ctx, "Failed to marshal JSON for player file: %v", err)
 		return result
 	}
 
+	// Сохраняем предыдущее содержимое файла игрока в историю версий
+	recordFileVersion(ctx, playerFile, "restore-slot")
+
 	// Записываем данные в файл игрока
 	if err := os.WriteFile(playerFile, jsonData, 0644); err != nil {
 		result := RestoreSlotResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to write player file: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to write player file: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to write player file: %v", err)
+		logError(ctx, "Failed to write player file: %v", err)
 		return result
 	}
+	fileBytesWritten.Add(float64(len(jsonData)))
 
-	log.Printf("Slot restored from %s to %s", slotFile, playerFile)
+	logInfo(ctx, "Slot restored from %s to %s", slotFile, playerFile)
 
-	result := RestoreSlotResponse{
+	result = RestoreSlotResponse{
 		Success:    true,
 		Message:    fmt.Sprintf("Slot %s successfully restored to player file", slotID),
 		PlayerFile: playerFile,
 		SlotFile:   slotFile,
 	}
-	log.Printf("Slot restoration completed successfully")
+	logInfo(ctx, "Slot restoration completed successfully")
 	return result
 }
 
-func writeSlotFile(steamid, fileName string, data json.RawMessage) WriteSlotResponse {
-	log.Printf("Writing slot file for SteamID: %s, FileName: %s", steamid, fileName)
+func writeSlotFile(ctx context.Context, steamid, fileName string, data json.RawMessage) (result WriteSlotResponse) {
+	ctx = withLogAttrs(ctx, slog.String("steamid", steamid), slog.String("file_name", fileName))
+	logInfo(ctx, "Writing slot file for SteamID: %s, FileName: %s", steamid, fileName)
+	defer func() {
+		emitWebhook(ctx, WebhookEvent{Operation: "write-slot", Success: result.Success, SteamID: steamid, SlotID: strings.TrimSuffix(fileName, ".json"), FilePath: result.FilePath, Error: result.Error, Data: result})
+	}()
 
 	// Проверяем, что fileName имеет расширение .json
 	if filepath.Ext(fileName) != ".json" {
 		fileName = fileName + ".json"
 	}
 
-	remoteDir := filepath.Join(slotsDir, steamid)
+	remoteDir := playerSlotsDir(ctx, steamid)
 	filePath := filepath.Join(remoteDir, fileName)
 
 	// Создаем директорию если не существует
 	if err := os.MkdirAll(remoteDir, 0755); err != nil {
 		result := WriteSlotResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to create directory: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to create directory: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to create directory: %v", err)
+		logError(ctx, "Failed to create directory: %v", err)
 		return result
 	}
 
@@ -761,23 +764,25 @@ func writeSlotFile(steamid, fileName string, data json.RawMessage) WriteSlotResp
 		jsonData, err := json.MarshalIndent(defaultData, "", "  ")
 		if err != nil {
 			result := WriteSlotResponse{
-				Success: false,
-				Error:   fmt.Sprintf("Failed to marshal default JSON: %v", err),
+				Success:   false,
+				Error:     fmt.Sprintf("Failed to marshal default JSON: %v", err),
+				ErrorCode: ErrIO,
 			}
-			log.Printf("Failed to marshal default JSON: %v", err)
+			logError(ctx, "Failed to marshal default JSON: %v", err)
 			return result
 		}
 		data = jsonData
-		log.Printf("Using default data structure for slot file")
+		logDebug(ctx, "Using default data structure for slot file")
 	} else {
 		// Валидируем предоставленные JSON данные
 		var jsonData interface{}
 		if err := json.Unmarshal(data, &jsonData); err != nil {
 			result := WriteSlotResponse{
-				Success: false,
-				Error:   fmt.Sprintf("Invalid JSON data: %v", err),
+				Success:   false,
+				Error:     fmt.Sprintf("Invalid JSON data: %v", err),
+				ErrorCode: ErrInvalidJSON,
 			}
-			log.Printf("Invalid JSON data: %v", err)
+			logWarn(ctx, "Invalid JSON data: %v", err)
 			return result
 		}
 
@@ -785,45 +790,45 @@ func writeSlotFile(steamid, fileName string, data json.RawMessage) WriteSlotResp
 		formattedData, err := json.MarshalIndent(jsonData, "", "  ")
 		if err != nil {
 			result := WriteSlotResponse{
-				Success: false,
-				Error:   fmt.Sprintf("Failed to format JSON: %v", err),
+				Success:   false,
+				Error:     fmt.Sprintf("Failed to format JSON: %v", err),
+				ErrorCode: ErrIO,
 			}
-			log.Printf("Failed to format JSON: %v", err)
+			logError(ctx, "Failed to format JSON: %v", err)
 			return result
 		}
 		data = formattedData
-		log.Printf("Using provided data for slot file, length: %d bytes", len(data))
+		logDebug(ctx, "Using provided data for slot file, length: %d bytes", len(data))
 	}
 
+	// Сохраняем предыдущее содержимое в историю версий
+	recordFileVersion(ctx, filePath, "write-slot")
+
 	// Записываем файл
 	if err := os.WriteFile(filePath, data, 0644); err != nil {
 		result := WriteSlotResponse{
-			Success: false,
-			Error:   fmt.Sprintf("Failed to write file: %v", err),
+			Success:   false,
+			Error:     fmt.Sprintf("Failed to write file: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to write file: %v", err)
+		logError(ctx, "Failed to write file: %v", err)
 		return result
 	}
+	fileBytesWritten.Add(float64(len(data)))
 
-	log.Printf("Data written to slot file for steamid %s, file %s at %s", steamid, fileName, filePath)
+	logInfo(ctx, "Data written to slot file for steamid %s, file %s at %s", steamid, fileName, filePath)
 
-	result := WriteSlotResponse{
+	result = WriteSlotResponse{
 		Success:  true,
 		Message:  fmt.Sprintf("Data successfully written to %s", fileName),
 		FilePath: filePath,
 	}
-	log.Printf("Write slot file completed successfully")
+	logInfo(ctx, "Write slot file completed successfully")
 	return result
 }
 
 func writeFileHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
 
 	var req WriteFileRequest
 
@@ -833,55 +838,58 @@ func writeFileHandler(w http.ResponseWriter, r *http.Request) {
 		dataStr := r.URL.Query().Get("data")
 
 		if filePath == "" {
-			log.Printf("Write file handler: missing file_path parameter in GET request")
-			http.Error(w, `{"error": "file_path parameter is required"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "Write file handler: missing file_path parameter in GET request")
+			writeError(w, r, ErrInvalidRequest, "file_path parameter is required")
 			return
 		}
 
 		req.FilePath = filePath
+		req.Force = r.URL.Query().Get("force") == "true"
 		if dataStr != "" {
 			req.Data = json.RawMessage(dataStr)
 		}
 
 	case "POST":
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			log.Printf("Write file handler: invalid JSON in POST request: %v", err)
-			http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "Write file handler: invalid JSON in POST request: %v", err)
+			writeError(w, r, ErrInvalidJSON, "Invalid JSON")
 			return
 		}
 
 	default:
-		log.Printf("Write file handler: method not allowed: %s", r.Method)
-		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		logWarn(r.Context(), "Write file handler: method not allowed: %s", r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	if req.FilePath == "" {
-		log.Printf("Write file handler: file_path is required")
-		http.Error(w, `{"error": "file_path is required"}`, http.StatusBadRequest)
+		logWarn(r.Context(), "Write file handler: file_path is required")
+		writeError(w, r, ErrInvalidRequest, "file_path is required")
 		return
 	}
 
 	if len(req.Data) == 0 {
-		log.Printf("Write file handler: data is required")
-		http.Error(w, `{"error": "data is required"}`, http.StatusBadRequest)
+		logWarn(r.Context(), "Write file handler: data is required")
+		writeError(w, r, ErrInvalidRequest, "data is required")
 		return
 	}
 
-	log.Printf("Write file handler processing request for path: %s", req.FilePath)
-	response := writeFileByPath(req.FilePath, req.Data)
-	log.Printf("Write file handler response: Success=%t, Error=%s, Size=%d", response.Success, response.Error, response.Size)
-	json.NewEncoder(w).Encode(response)
+	r, steamid, unlock, ok := guardFilePath(w, r, req.FilePath, req.Force, "Write file")
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	logInfo(r.Context(), "Write file handler processing request for path: %s", req.FilePath)
+	audit := beginAudit(r, "write-file", steamid, "", req.FilePath)
+	response := writeFileByPath(r.Context(), req.FilePath, req.Data)
+	audit.finish(response.Success, response.Error)
+	logInfo(r.Context(), "Write file handler response: Success=%t, Error=%s, Size=%d", response.Success, response.Error, response.Size)
+	writeResponse(w, r, response)
 }
 
 func fileContentByPathHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
 
 	var req FilePathRequest
 
@@ -889,45 +897,39 @@ func fileContentByPathHandler(w http.ResponseWriter, r *http.Request) {
 	case "GET":
 		filePath := r.URL.Query().Get("file_path")
 		if filePath == "" {
-			log.Printf("File content by path handler: missing file_path parameter in GET request")
-			http.Error(w, `{"error": "file_path parameter is required"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "File content by path handler: missing file_path parameter in GET request")
+			writeError(w, r, ErrInvalidRequest, "file_path parameter is required")
 			return
 		}
 		req.FilePath = filePath
 
 	case "POST":
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			log.Printf("File content by path handler: invalid JSON in POST request: %v", err)
-			http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "File content by path handler: invalid JSON in POST request: %v", err)
+			writeError(w, r, ErrInvalidJSON, "Invalid JSON")
 			return
 		}
 
 	default:
-		log.Printf("File content by path handler: method not allowed: %s", r.Method)
-		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		logWarn(r.Context(), "File content by path handler: method not allowed: %s", r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	if req.FilePath == "" {
-		log.Printf("File content by path handler: file_path is required")
-		http.Error(w, `{"error": "file_path is required"}`, http.StatusBadRequest)
+		logWarn(r.Context(), "File content by path handler: file_path is required")
+		writeError(w, r, ErrInvalidRequest, "file_path is required")
 		return
 	}
 
-	log.Printf("File content by path handler processing request for path: %s", req.FilePath)
-	response := getFileContentByPath(req.FilePath)
-	log.Printf("File content by path handler response: Success=%t, Error=%s, Size=%d", response.Success, response.Error, response.Size)
-	json.NewEncoder(w).Encode(response)
+	logInfo(r.Context(), "File content by path handler processing request for path: %s", req.FilePath)
+	response := getFileContentByPath(r.Context(), req.FilePath)
+	logInfo(r.Context(), "File content by path handler response: Success=%t, Error=%s, Size=%d", response.Success, response.Error, response.Size)
+	writeResponse(w, r, response)
 }
 
 func checkHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
 
 	var req CheckRequest
 
@@ -935,45 +937,45 @@ func checkHandler(w http.ResponseWriter, r *http.Request) {
 	case "GET":
 		steamid := r.URL.Query().Get("steamid")
 		if steamid == "" {
-			log.Printf("Check handler: missing steamid parameter in GET request")
-			http.Error(w, `{"error": "steamid parameter is required"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "Check handler: missing steamid parameter in GET request")
+			writeError(w, r, ErrInvalidRequest, "steamid parameter is required")
 			return
 		}
 		req.SteamID = steamid
 
 	case "POST":
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			log.Printf("Check handler: invalid JSON in POST request: %v", err)
-			http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "Check handler: invalid JSON in POST request: %v", err)
+			writeError(w, r, ErrInvalidJSON, "Invalid JSON")
 			return
 		}
 
 	default:
-		log.Printf("Check handler: method not allowed: %s", r.Method)
-		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		logWarn(r.Context(), "Check handler: method not allowed: %s", r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	if req.SteamID == "" {
-		log.Printf("Check handler: steamid is required")
-		http.Error(w, `{"error": "steamid is required"}`, http.StatusBadRequest)
+		logWarn(r.Context(), "Check handler: steamid is required")
+		writeError(w, r, ErrInvalidRequest, "steamid is required")
+		return
+	}
+	if !checkIDs(w, r, "Check", req.SteamID) {
+		return
+	}
+	if r = requestServer(w, r, req.Server, "Check"); r == nil {
 		return
 	}
 
-	log.Printf("Check handler processing request for SteamID: %s", req.SteamID)
-	response := checkPlayerFile(req.SteamID)
-	log.Printf("Check handler response: Exists=%t, Error=%s", response.Exists, response.Error)
-	json.NewEncoder(w).Encode(response)
+	logInfo(r.Context(), "Check handler processing request for SteamID: %s", req.SteamID)
+	response := checkPlayerFile(r.Context(), req.SteamID)
+	logInfo(r.Context(), "Check handler response: Exists=%t, Error=%s", response.Exists, response.Error)
+	writeResponse(w, r, response)
 }
 
 func playerFileContentHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
 
 	var req CheckRequest
 
@@ -981,45 +983,45 @@ func playerFileContentHandler(w http.ResponseWriter, r *http.Request) {
 	case "GET":
 		steamid := r.URL.Query().Get("steamid")
 		if steamid == "" {
-			log.Printf("Player file content handler: missing steamid parameter in GET request")
-			http.Error(w, `{"error": "steamid parameter is required"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "Player file content handler: missing steamid parameter in GET request")
+			writeError(w, r, ErrInvalidRequest, "steamid parameter is required")
 			return
 		}
 		req.SteamID = steamid
 
 	case "POST":
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			log.Printf("Player file content handler: invalid JSON in POST request: %v", err)
-			http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "Player file content handler: invalid JSON in POST request: %v", err)
+			writeError(w, r, ErrInvalidJSON, "Invalid JSON")
 			return
 		}
 
 	default:
-		log.Printf("Player file content handler: method not allowed: %s", r.Method)
-		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		logWarn(r.Context(), "Player file content handler: method not allowed: %s", r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	if req.SteamID == "" {
-		log.Printf("Player file content handler: steamid is required")
-		http.Error(w, `{"error": "steamid is required"}`, http.StatusBadRequest)
+		logWarn(r.Context(), "Player file content handler: steamid is required")
+		writeError(w, r, ErrInvalidRequest, "steamid is required")
+		return
+	}
+	if !checkIDs(w, r, "Player file content", req.SteamID) {
+		return
+	}
+	if r = requestServer(w, r, req.Server, "Player file content"); r == nil {
 		return
 	}
 
-	log.Printf("Player file content handler processing request for SteamID: %s", req.SteamID)
-	response := getPlayerFileContent(req.SteamID)
-	log.Printf("Player file content handler response: Success=%t, Error=%s", response.Success, response.Error)
-	json.NewEncoder(w).Encode(response)
+	logInfo(r.Context(), "Player file content handler processing request for SteamID: %s", req.SteamID)
+	response := getPlayerFileContent(r.Context(), req.SteamID)
+	logInfo(r.Context(), "Player file content handler response: Success=%t, Error=%s", response.Success, response.Error)
+	writeResponse(w, r, response)
 }
 
 func slotFileContentHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
 
 	var req CheckRequest
 
@@ -1028,8 +1030,8 @@ func slotFileContentHandler(w http.ResponseWriter, r *http.Request) {
 		steamid := r.URL.Query().Get("steamid")
 		slotID := r.URL.Query().Get("slot_id")
 		if steamid == "" || slotID == "" {
-			log.Printf("Slot file content handler: missing parameters in GET request - steamid: %s, slot_id: %s", steamid, slotID)
-			http.Error(w, `{"error": "steamid and slot_id parameters are required"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "Slot file content handler: missing parameters in GET request - steamid: %s, slot_id: %s", steamid, slotID)
+			writeError(w, r, ErrInvalidRequest, "steamid and slot_id parameters are required")
 			return
 		}
 		req.SteamID = steamid
@@ -1037,37 +1039,37 @@ func slotFileContentHandler(w http.ResponseWriter, r *http.Request) {
 
 	case "POST":
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			log.Printf("Slot file content handler: invalid JSON in POST request: %v", err)
-			http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "Slot file content handler: invalid JSON in POST request: %v", err)
+			writeError(w, r, ErrInvalidJSON, "Invalid JSON")
 			return
 		}
 
 	default:
-		log.Printf("Slot file content handler: method not allowed: %s", r.Method)
-		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		logWarn(r.Context(), "Slot file content handler: method not allowed: %s", r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	if req.SteamID == "" || req.SlotID == "" {
-		log.Printf("Slot file content handler: steamid and slot_id are required")
-		http.Error(w, `{"error": "steamid and slot_id are required"}`, http.StatusBadRequest)
+		logWarn(r.Context(), "Slot file content handler: steamid and slot_id are required")
+		writeError(w, r, ErrInvalidRequest, "steamid and slot_id are required")
+		return
+	}
+	if !checkIDs(w, r, "Slot file content", req.SteamID, req.SlotID) {
+		return
+	}
+	if r = requestServer(w, r, req.Server, "Slot file content"); r == nil {
 		return
 	}
 
-	log.Printf("Slot file content handler processing request for SteamID: %s, SlotID: %s", req.SteamID, req.SlotID)
-	response := getSlotFileContent(req.SteamID, req.SlotID)
-	log.Printf("Slot file content handler response: Success=%t, Error=%s", response.Success, response.Error)
-	json.NewEncoder(w).Encode(response)
+	logInfo(r.Context(), "Slot file content handler processing request for SteamID: %s, SlotID: %s", req.SteamID, req.SlotID)
+	response := getSlotFileContent(r.Context(), req.SteamID, req.SlotID)
+	logInfo(r.Context(), "Slot file content handler response: Success=%t, Error=%s", response.Success, response.Error)
+	writeResponse(w, r, response)
 }
 
 func transferHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
 
 	var req CheckRequest
 
@@ -1076,46 +1078,55 @@ func transferHandler(w http.ResponseWriter, r *http.Request) {
 		steamid := r.URL.Query().Get("steamid")
 		oldSlotID := r.URL.Query().Get("old_slot_id")
 		if steamid == "" || oldSlotID == "" {
-			log.Printf("Transfer handler: missing parameters in GET request - steamid: %s, old_slot_id: %s", steamid, oldSlotID)
-			http.Error(w, `{"error": "steamid and old_slot_id parameters are required"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "Transfer handler: missing parameters in GET request - steamid: %s, old_slot_id: %s", steamid, oldSlotID)
+			writeError(w, r, ErrInvalidRequest, "steamid and old_slot_id parameters are required")
 			return
 		}
 		req.SteamID = steamid
 		req.OldSlotID = oldSlotID
+		req.Force = r.URL.Query().Get("force") == "true"
 
 	case "POST":
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			log.Printf("Transfer handler: invalid JSON in POST request: %v", err)
-			http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "Transfer handler: invalid JSON in POST request: %v", err)
+			writeError(w, r, ErrInvalidJSON, "Invalid JSON")
 			return
 		}
 
 	default:
-		log.Printf("Transfer handler: method not allowed: %s", r.Method)
-		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		logWarn(r.Context(), "Transfer handler: method not allowed: %s", r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	if req.SteamID == "" || req.OldSlotID == "" {
-		log.Printf("Transfer handler: steamid and old_slot_id are required")
-		http.Error(w, `{"error": "steamid and old_slot_id are required"}`, http.StatusBadRequest)
+		logWarn(r.Context(), "Transfer handler: steamid and old_slot_id are required")
+		writeError(w, r, ErrInvalidRequest, "steamid and old_slot_id are required")
+		return
+	}
+	if !checkIDs(w, r, "Transfer", req.SteamID, req.OldSlotID) {
+		return
+	}
+	if r = requestServer(w, r, req.Server, "Transfer"); r == nil {
+		return
+	}
+
+	logInfo(r.Context(), "Transfer handler processing request for SteamID: %s, OldSlotID: %s", req.SteamID, req.OldSlotID)
+	if !checkPlayerPresence(w, r, req.SteamID, req.Force, "Transfer") {
 		return
 	}
 
-	log.Printf("Transfer handler processing request for SteamID: %s, OldSlotID: %s", req.SteamID, req.OldSlotID)
-	response := transferPlayerSlot(req.SteamID, req.OldSlotID)
-	log.Printf("Transfer handler response: Success=%t, Error=%s", response.Success, response.Error)
-	json.NewEncoder(w).Encode(response)
+	unlock := lockPlayer(r.Context(), req.SteamID)
+	defer unlock()
+	audit := beginAudit(r, "transfer", req.SteamID, req.OldSlotID, playerFilePath(r.Context(), req.SteamID), slotFilePath(r.Context(), req.SteamID, req.OldSlotID))
+	response := transferPlayerSlot(r.Context(), req.SteamID, req.OldSlotID)
+	audit.finish(response.Success, response.Error)
+	logInfo(r.Context(), "Transfer handler response: Success=%t, Error=%s", response.Success, response.Error)
+	writeResponse(w, r, response)
 }
 
 func emptySlotHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
 
 	var req CheckRequest
 
@@ -1124,8 +1135,8 @@ func emptySlotHandler(w http.ResponseWriter, r *http.Request) {
 		steamid := r.URL.Query().Get("steamid")
 		oldSlotID := r.URL.Query().Get("old_slot_id")
 		if steamid == "" || oldSlotID == "" {
-			log.Printf("Empty slot handler: missing parameters in GET request - steamid: %s, old_slot_id: %s", steamid, oldSlotID)
-			http.Error(w, `{"error": "steamid and old_slot_id parameters are required"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "Empty slot handler: missing parameters in GET request - steamid: %s, old_slot_id: %s", steamid, oldSlotID)
+			writeError(w, r, ErrInvalidRequest, "steamid and old_slot_id parameters are required")
 			return
 		}
 		req.SteamID = steamid
@@ -1133,37 +1144,41 @@ func emptySlotHandler(w http.ResponseWriter, r *http.Request) {
 
 	case "POST":
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			log.Printf("Empty slot handler: invalid JSON in POST request: %v", err)
-			http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "Empty slot handler: invalid JSON in POST request: %v", err)
+			writeError(w, r, ErrInvalidJSON, "Invalid JSON")
 			return
 		}
 
 	default:
-		log.Printf("Empty slot handler: method not allowed: %s", r.Method)
-		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		logWarn(r.Context(), "Empty slot handler: method not allowed: %s", r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	if req.SteamID == "" || req.OldSlotID == "" {
-		log.Printf("Empty slot handler: steamid and old_slot_id are required")
-		http.Error(w, `{"error": "steamid and old_slot_id are required"}`, http.StatusBadRequest)
+		logWarn(r.Context(), "Empty slot handler: steamid and old_slot_id are required")
+		writeError(w, r, ErrInvalidRequest, "steamid and old_slot_id are required")
+		return
+	}
+	if !checkIDs(w, r, "Empty slot", req.SteamID, req.OldSlotID) {
+		return
+	}
+	if r = requestServer(w, r, req.Server, "Empty slot"); r == nil {
 		return
 	}
 
-	log.Printf("Empty slot handler processing request for SteamID: %s, OldSlotID: %s", req.SteamID, req.OldSlotID)
-	response := createEmptySlot(req.SteamID, req.OldSlotID)
-	log.Printf("Empty slot handler response: Success=%t, Error=%s", response.Success, response.Error)
-	json.NewEncoder(w).Encode(response)
+	logInfo(r.Context(), "Empty slot handler processing request for SteamID: %s, OldSlotID: %s", req.SteamID, req.OldSlotID)
+	unlock := lockPlayer(r.Context(), req.SteamID)
+	defer unlock()
+	audit := beginAudit(r, "empty-slot", req.SteamID, req.OldSlotID, slotFilePath(r.Context(), req.SteamID, req.OldSlotID))
+	response := createEmptySlot(r.Context(), req.SteamID, req.OldSlotID)
+	audit.finish(response.Success, response.Error)
+	logInfo(r.Context(), "Empty slot handler response: Success=%t, Error=%s", response.Success, response.Error)
+	writeResponse(w, r, response)
 }
 
 func restoreSlotHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
 
 	var req CheckRequest
 
@@ -1172,46 +1187,55 @@ func restoreSlotHandler(w http.ResponseWriter, r *http.Request) {
 		steamid := r.URL.Query().Get("steamid")
 		slotID := r.URL.Query().Get("slot_id")
 		if steamid == "" || slotID == "" {
-			log.Printf("Restore slot handler: missing parameters in GET request - steamid: %s, slot_id: %s", steamid, slotID)
-			http.Error(w, `{"error": "steamid and slot_id parameters are required"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "Restore slot handler: missing parameters in GET request - steamid: %s, slot_id: %s", steamid, slotID)
+			writeError(w, r, ErrInvalidRequest, "steamid and slot_id parameters are required")
 			return
 		}
 		req.SteamID = steamid
 		req.SlotID = slotID
+		req.Force = r.URL.Query().Get("force") == "true"
 
 	case "POST":
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			log.Printf("Restore slot handler: invalid JSON in POST request: %v", err)
-			http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "Restore slot handler: invalid JSON in POST request: %v", err)
+			writeError(w, r, ErrInvalidJSON, "Invalid JSON")
 			return
 		}
 
 	default:
-		log.Printf("Restore slot handler: method not allowed: %s", r.Method)
-		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		logWarn(r.Context(), "Restore slot handler: method not allowed: %s", r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	if req.SteamID == "" || req.SlotID == "" {
-		log.Printf("Restore slot handler: steamid and slot_id are required")
-		http.Error(w, `{"error": "steamid and slot_id are required"}`, http.StatusBadRequest)
+		logWarn(r.Context(), "Restore slot handler: steamid and slot_id are required")
+		writeError(w, r, ErrInvalidRequest, "steamid and slot_id are required")
+		return
+	}
+	if !checkIDs(w, r, "Restore slot", req.SteamID, req.SlotID) {
+		return
+	}
+	if r = requestServer(w, r, req.Server, "Restore slot"); r == nil {
 		return
 	}
 
-	log.Printf("Restore slot handler processing request for SteamID: %s, SlotID: %s", req.SteamID, req.SlotID)
-	response := restoreSlotFromFile(req.SteamID, req.SlotID)
-	log.Printf("Restore slot handler response: Success=%t, Error=%s", response.Success, response.Error)
-	json.NewEncoder(w).Encode(response)
+	logInfo(r.Context(), "Restore slot handler processing request for SteamID: %s, SlotID: %s", req.SteamID, req.SlotID)
+	if !checkPlayerPresence(w, r, req.SteamID, req.Force, "Restore slot") {
+		return
+	}
+
+	unlock := lockPlayer(r.Context(), req.SteamID)
+	defer unlock()
+	audit := beginAudit(r, "restore-slot", req.SteamID, req.SlotID, playerFilePath(r.Context(), req.SteamID), slotFilePath(r.Context(), req.SteamID, req.SlotID))
+	response := restoreSlotFromFile(r.Context(), req.SteamID, req.SlotID)
+	audit.finish(response.Success, response.Error)
+	logInfo(r.Context(), "Restore slot handler response: Success=%t, Error=%s", response.Success, response.Error)
+	writeResponse(w, r, response)
 }
 
 func writeSlotHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
 
 	var req WriteSlotRequest
 
@@ -1222,52 +1246,69 @@ func writeSlotHandler(w http.ResponseWriter, r *http.Request) {
 		dataStr := r.URL.Query().Get("data")
 
 		if steamid == "" || fileName == "" {
-			log.Printf("Write slot handler: missing parameters in GET request - steamid: %s, file_name: %s", steamid, fileName)
-			http.Error(w, `{"error": "steamid and file_name parameters are required"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "Write slot handler: missing parameters in GET request - steamid: %s, file_name: %s", steamid, fileName)
+			writeError(w, r, ErrInvalidRequest, "steamid and file_name parameters are required")
 			return
 		}
 
 		req.SteamID = steamid
 		req.FileName = fileName
+		req.Force = r.URL.Query().Get("force") == "true"
 		if dataStr != "" {
 			req.Data = json.RawMessage(dataStr)
 		}
 
 	case "POST":
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			log.Printf("Write slot handler: invalid JSON in POST request: %v", err)
-			http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "Write slot handler: invalid JSON in POST request: %v", err)
+			writeError(w, r, ErrInvalidJSON, "Invalid JSON")
 			return
 		}
 
 	default:
-		log.Printf("Write slot handler: method not allowed: %s", r.Method)
-		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		logWarn(r.Context(), "Write slot handler: method not allowed: %s", r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	if req.SteamID == "" || req.FileName == "" {
-		log.Printf("Write slot handler: steamid and file_name are required")
-		http.Error(w, `{"error": "steamid and file_name are required"}`, http.StatusBadRequest)
+		logWarn(r.Context(), "Write slot handler: steamid and file_name are required")
+		writeError(w, r, ErrInvalidRequest, "steamid and file_name are required")
+		return
+	}
+	if !checkIDs(w, r, "Write slot", req.SteamID, req.FileName) {
+		return
+	}
+	if r = requestServer(w, r, req.Server, "Write slot"); r == nil {
 		return
 	}
 
-	log.Printf("Write slot handler processing request for SteamID: %s, FileName: %s", req.SteamID, req.FileName)
-	response := writeSlotFile(req.SteamID, req.FileName, req.Data)
-	log.Printf("Write slot handler response: Success=%t, Error=%s", response.Success, response.Error)
-	json.NewEncoder(w).Encode(response)
+	logInfo(r.Context(), "Write slot handler processing request for SteamID: %s, FileName: %s", req.SteamID, req.FileName)
+	if !checkPlayerPresence(w, r, req.SteamID, req.Force, "Write slot") {
+		return
+	}
+
+	unlock := lockPlayer(r.Context(), req.SteamID)
+	defer unlock()
+	slotID := strings.TrimSuffix(req.FileName, ".json")
+	audit := beginAudit(r, "write-slot", req.SteamID, slotID, slotFilePath(r.Context(), req.SteamID, slotID))
+	response := writeSlotFile(r.Context(), req.SteamID, req.FileName, req.Data)
+	audit.finish(response.Success, response.Error)
+	logInfo(r.Context(), "Write slot handler response: Success=%t, Error=%s", response.Success, response.Error)
+	writeResponse(w, r, response)
 }
 
-func getFileInfo(filePath string) FileInfoResponse {
-	log.Printf("Getting file info for: %s", filePath)
+func getFileInfo(ctx context.Context, filePath string) FileInfoResponse {
+	logInfo(ctx, "Getting file info for: %s", filePath)
 
 	// Проверяем, что путь не пустой
 	if filePath == "" {
 		result := FileInfoResponse{
-			Success: false,
-			Error:   "File path is required",
+			Success:   false,
+			Error:     "File path is required",
+			ErrorCode: ErrInvalidRequest,
 		}
-		log.Printf("File path is empty")
+		logWarn(ctx, "File path is empty")
 		return result
 	}
 
@@ -1279,15 +1320,16 @@ func getFileInfo(filePath string) FileInfoResponse {
 			FilePath: filePath,
 			Exists:   false,
 		}
-		log.Printf("File not found: %s", filePath)
+		logWarn(ctx, "File not found: %s", filePath)
 		return result
 	} else if err != nil {
 		result := FileInfoResponse{
-			Success:  false,
-			FilePath: filePath,
-			Error:    fmt.Sprintf("Error getting file info: %v", err),
+			Success:   false,
+			FilePath:  filePath,
+			Error:     fmt.Sprintf("Error getting file info: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Error getting file info for %s: %v", filePath, err)
+		logError(ctx, "Error getting file info for %s: %v", filePath, err)
 		return result
 	}
 
@@ -1315,7 +1357,7 @@ func getFileInfo(filePath string) FileInfoResponse {
 		CreatedTimeFormatted: createdTimeFormatted,
 	}
 
-	log.Printf("File info retrieved successfully: exists=%t, size=%d, mod_time=%s",
+	logInfo(ctx, "File info retrieved successfully: exists=%t, size=%d, mod_time=%s",
 		result.Exists, result.Size, result.ModTimeFormatted)
 
 	return result
@@ -1338,12 +1380,6 @@ func getFileCreationTime(filePath string) time.Time {
 
 func fileInfoHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
 
 	var req FilePathRequest
 
@@ -1351,48 +1387,52 @@ func fileInfoHandler(w http.ResponseWriter, r *http.Request) {
 	case "GET":
 		filePath := r.URL.Query().Get("file_path")
 		if filePath == "" {
-			log.Printf("File info handler: missing file_path parameter in GET request")
-			http.Error(w, `{"error": "file_path parameter is required"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "File info handler: missing file_path parameter in GET request")
+			writeError(w, r, ErrInvalidRequest, "file_path parameter is required")
 			return
 		}
 		req.FilePath = filePath
 
 	case "POST":
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			log.Printf("File info handler: invalid JSON in POST request: %v", err)
-			http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "File info handler: invalid JSON in POST request: %v", err)
+			writeError(w, r, ErrInvalidJSON, "Invalid JSON")
 			return
 		}
 
 	default:
-		log.Printf("File info handler: method not allowed: %s", r.Method)
-		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		logWarn(r.Context(), "File info handler: method not allowed: %s", r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	if req.FilePath == "" {
-		log.Printf("File info handler: file_path is required")
-		http.Error(w, `{"error": "file_path is required"}`, http.StatusBadRequest)
+		logWarn(r.Context(), "File info handler: file_path is required")
+		writeError(w, r, ErrInvalidRequest, "file_path is required")
 		return
 	}
 
-	log.Printf("File info handler processing request for path: %s", req.FilePath)
-	response := getFileInfo(req.FilePath)
-	log.Printf("File info handler response: Success=%t, Exists=%t, Error=%s",
+	logInfo(r.Context(), "File info handler processing request for path: %s", req.FilePath)
+	response := getFileInfo(r.Context(), req.FilePath)
+	logInfo(r.Context(), "File info handler response: Success=%t, Exists=%t, Error=%s",
 		response.Success, response.Exists, response.Error)
-	json.NewEncoder(w).Encode(response)
+	writeResponse(w, r, response)
 }
 
-func deleteFileByPath(filePath string, backup bool) DeleteFileResponse {
-	log.Printf("Deleting file by path: %s, backup: %t", filePath, backup)
+func deleteFileByPath(ctx context.Context, filePath string, backup bool) (result DeleteFileResponse) {
+	logInfo(ctx, "Deleting file by path: %s, backup: %t", filePath, backup)
+	defer func() {
+		emitWebhook(ctx, WebhookEvent{Operation: "delete-file", Success: result.Success, FilePath: filePath, Error: result.Error, Data: result})
+	}()
 
 	// Проверяем, что путь не пустой
 	if filePath == "" {
 		result := DeleteFileResponse{
-			Success: false,
-			Error:   "File path is required",
+			Success:   false,
+			Error:     "File path is required",
+			ErrorCode: ErrInvalidRequest,
 		}
-		log.Printf("File path is empty")
+		logWarn(ctx, "File path is empty")
 		return result
 	}
 
@@ -1404,15 +1444,16 @@ func deleteFileByPath(filePath string, backup bool) DeleteFileResponse {
 			Deleted:  false,
 			Message:  "File does not exist, nothing to delete",
 		}
-		log.Printf("File not found, nothing to delete: %s", filePath)
+		logWarn(ctx, "File not found, nothing to delete: %s", filePath)
 		return result
 	} else if err != nil {
 		result := DeleteFileResponse{
-			Success:  false,
-			FilePath: filePath,
-			Error:    fmt.Sprintf("Error checking file: %v", err),
+			Success:   false,
+			FilePath:  filePath,
+			Error:     fmt.Sprintf("Error checking file: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Error checking file %s: %v", filePath, err)
+		logError(ctx, "Error checking file %s: %v", filePath, err)
 		return result
 	}
 
@@ -1420,11 +1461,11 @@ func deleteFileByPath(filePath string, backup bool) DeleteFileResponse {
 
 	// Создаем бэкап если требуется
 	if backup {
-		backupPath = createBackup(filePath)
+		backupPath = createBackup(ctx, filePath)
 		if backupPath != "" {
-			log.Printf("Backup created: %s", backupPath)
+			logInfo(ctx, "Backup created: %s", backupPath)
 		} else {
-			log.Printf("Failed to create backup for: %s", filePath)
+			logError(ctx, "Failed to create backup for: %s", filePath)
 			// Продолжаем удаление даже если бэкап не удался
 		}
 	}
@@ -1436,8 +1477,9 @@ func deleteFileByPath(filePath string, backup bool) DeleteFileResponse {
 			FilePath:   filePath,
 			BackupPath: backupPath,
 			Error:      fmt.Sprintf("Failed to delete file: %v", err),
+			ErrorCode:  ErrIO,
 		}
-		log.Printf("Failed to delete file %s: %v", filePath, err)
+		logError(ctx, "Failed to delete file %s: %v", filePath, err)
 		return result
 	}
 
@@ -1450,7 +1492,7 @@ func deleteFileByPath(filePath string, backup bool) DeleteFileResponse {
 			Deleted:    true,
 			BackupPath: backupPath,
 		}
-		log.Printf("File successfully deleted: %s", filePath)
+		logInfo(ctx, "File successfully deleted: %s", filePath)
 		return result
 	} else {
 		result := DeleteFileResponse{
@@ -1458,72 +1500,91 @@ func deleteFileByPath(filePath string, backup bool) DeleteFileResponse {
 			FilePath:   filePath,
 			BackupPath: backupPath,
 			Error:      "File still exists after deletion attempt",
+			ErrorCode:  ErrIO,
 		}
-		log.Printf("File still exists after deletion: %s", filePath)
+		logWarn(ctx, "File still exists after deletion: %s", filePath)
 		return result
 	}
 }
 
-func createBackup(filePath string) string {
+// Бэкапы каждого сервера в своём подкаталоге: один и тот же игрок на двух серверах
+// не перезаписывает чужой бэкап, а восстановление берёт бэкап только своего сервера
+func serverBackupDir(srv *gameServer) string {
+	return filepath.Join(backupDir, srv.Name)
+}
+
+func createBackup(ctx context.Context, filePath string) string {
 	// Создаем имя для бэкап файла
 	fileName := filepath.Base(filePath)
 	backupFileName := fmt.Sprintf("%s_%s.backup",
 		strings.TrimSuffix(fileName, filepath.Ext(fileName)),
 		time.Now().Format("20060102_150405"))
 
-	backupPath := filepath.Join(backupDir, backupFileName)
+	// Файл из каталогов профиля относится к своему серверу, остальные - к выбранному.
+	// Имя файла слота не содержит SteamID, поэтому его бэкап называется <steamid>_<слот>_<время>
+	srv, steamid := serverForPath(filePath)
+	if srv == nil {
+		srv = serverFrom(ctx)
+	} else if base := strings.TrimSuffix(fileName, filepath.Ext(fileName)); base != steamid {
+		backupFileName = steamid + "_" + backupFileName
+	}
+	dir := serverBackupDir(srv)
+	backupPath := filepath.Join(dir, backupFileName)
 
 	// Создаем директорию для бэкапов если не существует
-	if err := os.MkdirAll(backupDir, 0755); err != nil {
-		log.Printf("Failed to create backup directory %s: %v", backupDir, err)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		logError(ctx, "Failed to create backup directory %s: %v", dir, err)
 		return ""
 	}
 
 	// Копируем файл
 	sourceFile, err := os.Open(filePath)
 	if err != nil {
-		log.Printf("Failed to open source file for backup %s: %v", filePath, err)
+		logError(ctx, "Failed to open source file for backup %s: %v", filePath, err)
 		return ""
 	}
 	defer sourceFile.Close()
 
 	backupFile, err := os.Create(backupPath)
 	if err != nil {
-		log.Printf("Failed to create backup file %s: %v", backupPath, err)
+		logError(ctx, "Failed to create backup file %s: %v", backupPath, err)
 		return ""
 	}
 	defer backupFile.Close()
 
-	_, err = io.Copy(backupFile, sourceFile)
+	copied, err := io.Copy(backupFile, sourceFile)
 	if err != nil {
-		log.Printf("Failed to copy file to backup %s: %v", backupPath, err)
+		logError(ctx, "Failed to copy file to backup %s: %v", backupPath, err)
 		return ""
 	}
+	backupsCreated.Inc()
+	backupBytesCreated.Add(float64(copied))
 
-	log.Printf("Backup created successfully: %s", backupPath)
+	logInfo(ctx, "Backup created successfully: %s", backupPath)
 	return backupPath
 }
 
-func deletePlayerFile(steamid string) DeleteFileResponse {
-	playerFile := filepath.Join(playersDir, steamid+".json")
-	return deleteFileByPath(playerFile, true) // Всегда делаем бэкап для файлов игроков
+func deletePlayerFile(ctx context.Context, steamid string) DeleteFileResponse {
+	playerFile := playerFilePath(ctx, steamid)
+	return deleteFileByPath(ctx, playerFile, true) // Всегда делаем бэкап для файлов игроков
 }
 
-func deleteSlotFile(steamid, slotID string) DeleteFileResponse {
-	slotFile := filepath.Join(slotsDir, steamid, slotID+".json")
-	return deleteFileByPath(slotFile, true) // Всегда делаем бэкап для файлов слотов
+func deleteSlotFile(ctx context.Context, steamid, slotID string) DeleteFileResponse {
+	slotFile := slotFilePath(ctx, steamid, slotID)
+	return deleteFileByPath(ctx, slotFile, true) // Всегда делаем бэкап для файлов слотов
 }
 
-func deleteEmptyDirectory(dirPath string) DeleteFileResponse {
-	log.Printf("Deleting directory: %s", dirPath)
+func deleteEmptyDirectory(ctx context.Context, dirPath string) DeleteFileResponse {
+	logInfo(ctx, "Deleting directory: %s", dirPath)
 
 	// Проверяем, что путь не пустой
 	if dirPath == "" {
 		result := DeleteFileResponse{
-			Success: false,
-			Error:   "Directory path is required",
+			Success:   false,
+			Error:     "Directory path is required",
+			ErrorCode: ErrInvalidRequest,
 		}
-		log.Printf("Directory path is empty")
+		logWarn(ctx, "Directory path is empty")
 		return result
 	}
 
@@ -1536,26 +1597,28 @@ func deleteEmptyDirectory(dirPath string) DeleteFileResponse {
 			Deleted:  false,
 			Message:  "Directory does not exist, nothing to delete",
 		}
-		log.Printf("Directory not found, nothing to delete: %s", dirPath)
+		logWarn(ctx, "Directory not found, nothing to delete: %s", dirPath)
 		return result
 	} else if err != nil {
 		result := DeleteFileResponse{
-			Success:  false,
-			FilePath: dirPath,
-			Error:    fmt.Sprintf("Error checking directory: %v", err),
+			Success:   false,
+			FilePath:  dirPath,
+			Error:     fmt.Sprintf("Error checking directory: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Error checking directory %s: %v", dirPath, err)
+		logError(ctx, "Error checking directory %s: %v", dirPath, err)
 		return result
 	}
 
 	// Проверяем, что это действительно директория
 	if !fileInfo.IsDir() {
 		result := DeleteFileResponse{
-			Success:  false,
-			FilePath: dirPath,
-			Error:    "Path is not a directory",
+			Success:   false,
+			FilePath:  dirPath,
+			Error:     "Path is not a directory",
+			ErrorCode: ErrInvalidRequest,
 		}
-		log.Printf("Path is not a directory: %s", dirPath)
+		logWarn(ctx, "Path is not a directory: %s", dirPath)
 		return result
 	}
 
@@ -1563,11 +1626,12 @@ func deleteEmptyDirectory(dirPath string) DeleteFileResponse {
 	dir, err := os.Open(dirPath)
 	if err != nil {
 		result := DeleteFileResponse{
-			Success:  false,
-			FilePath: dirPath,
-			Error:    fmt.Sprintf("Failed to open directory: %v", err),
+			Success:   false,
+			FilePath:  dirPath,
+			Error:     fmt.Sprintf("Failed to open directory: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to open directory %s: %v", dirPath, err)
+		logError(ctx, "Failed to open directory %s: %v", dirPath, err)
 		return result
 	}
 	defer dir.Close()
@@ -1575,22 +1639,24 @@ func deleteEmptyDirectory(dirPath string) DeleteFileResponse {
 	_, err = dir.Readdirnames(1) // Пытаемся прочитать хотя бы один файл
 	if err == nil {
 		result := DeleteFileResponse{
-			Success:  false,
-			FilePath: dirPath,
-			Error:    "Directory is not empty",
+			Success:   false,
+			FilePath:  dirPath,
+			Error:     "Directory is not empty",
+			ErrorCode: ErrConflict,
 		}
-		log.Printf("Directory is not empty: %s", dirPath)
+		logWarn(ctx, "Directory is not empty: %s", dirPath)
 		return result
 	}
 
 	// Удаляем пустую директорию
 	if err := os.Remove(dirPath); err != nil {
 		result := DeleteFileResponse{
-			Success:  false,
-			FilePath: dirPath,
-			Error:    fmt.Sprintf("Failed to delete directory: %v", err),
+			Success:   false,
+			FilePath:  dirPath,
+			Error:     fmt.Sprintf("Failed to delete directory: %v", err),
+			ErrorCode: ErrIO,
 		}
-		log.Printf("Failed to delete directory %s: %v", dirPath, err)
+		logError(ctx, "Failed to delete directory %s: %v", dirPath, err)
 		return result
 	}
 
@@ -1600,21 +1666,16 @@ func deleteEmptyDirectory(dirPath string) DeleteFileResponse {
 		FilePath: dirPath,
 		Deleted:  true,
 	}
-	log.Printf("Directory successfully deleted: %s", dirPath)
+	logInfo(ctx, "Directory successfully deleted: %s", dirPath)
 	return result
 }
 
 func deleteFileHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
 
 	var req FilePathRequest
 	backup := true // По умолчанию создаем бэкап
+	force := false
 
 	switch r.Method {
 	case "GET":
@@ -1622,8 +1683,8 @@ func deleteFileHandler(w http.ResponseWriter, r *http.Request) {
 		backupParam := r.URL.Query().Get("backup")
 
 		if filePath == "" {
-			log.Printf("Delete file handler: missing file_path parameter in GET request")
-			http.Error(w, `{"error": "file_path parameter is required"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "Delete file handler: missing file_path parameter in GET request")
+			writeError(w, r, ErrInvalidRequest, "file_path parameter is required")
 			return
 		}
 
@@ -1631,16 +1692,14 @@ func deleteFileHandler(w http.ResponseWriter, r *http.Request) {
 		if backupParam == "false" {
 			backup = false
 		}
+		force = r.URL.Query().Get("force") == "true"
 
 	case "POST":
-		var requestBody struct {
-			FilePath string `json:"file_path"`
-			Backup   *bool  `json:"backup,omitempty"`
-		}
+		var requestBody DeleteFileRequest
 
 		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-			log.Printf("Delete file handler: invalid JSON in POST request: %v", err)
-			http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "Delete file handler: invalid JSON in POST request: %v", err)
+			writeError(w, r, ErrInvalidJSON, "Invalid JSON")
 			return
 		}
 
@@ -1648,34 +1707,37 @@ func deleteFileHandler(w http.ResponseWriter, r *http.Request) {
 		if requestBody.Backup != nil {
 			backup = *requestBody.Backup
 		}
+		force = requestBody.Force
 
 	default:
-		log.Printf("Delete file handler: method not allowed: %s", r.Method)
-		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		logWarn(r.Context(), "Delete file handler: method not allowed: %s", r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	if req.FilePath == "" {
-		log.Printf("Delete file handler: file_path is required")
-		http.Error(w, `{"error": "file_path is required"}`, http.StatusBadRequest)
+		logWarn(r.Context(), "Delete file handler: file_path is required")
+		writeError(w, r, ErrInvalidRequest, "file_path is required")
 		return
 	}
 
-	log.Printf("Delete file handler processing request for path: %s, backup: %t", req.FilePath, backup)
-	response := deleteFileByPath(req.FilePath, backup)
-	log.Printf("Delete file handler response: Success=%t, Deleted=%t, Error=%s",
+	r, steamid, unlock, ok := guardFilePath(w, r, req.FilePath, force, "Delete file")
+	if !ok {
+		return
+	}
+	defer unlock()
+
+	logInfo(r.Context(), "Delete file handler processing request for path: %s, backup: %t", req.FilePath, backup)
+	audit := beginAudit(r, "delete-file", steamid, "", req.FilePath).details("backup=%t", backup)
+	response := deleteFileByPath(r.Context(), req.FilePath, backup)
+	audit.finish(response.Success, response.Error)
+	logInfo(r.Context(), "Delete file handler response: Success=%t, Deleted=%t, Error=%s",
 		response.Success, response.Deleted, response.Error)
-	json.NewEncoder(w).Encode(response)
+	writeResponse(w, r, response)
 }
 
 func deletePlayerFileHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
 
 	var req CheckRequest
 
@@ -1683,46 +1745,55 @@ func deletePlayerFileHandler(w http.ResponseWriter, r *http.Request) {
 	case "GET":
 		steamid := r.URL.Query().Get("steamid")
 		if steamid == "" {
-			log.Printf("Delete player file handler: missing steamid parameter in GET request")
-			http.Error(w, `{"error": "steamid parameter is required"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "Delete player file handler: missing steamid parameter in GET request")
+			writeError(w, r, ErrInvalidRequest, "steamid parameter is required")
 			return
 		}
 		req.SteamID = steamid
+		req.Force = r.URL.Query().Get("force") == "true"
 
 	case "POST":
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			log.Printf("Delete player file handler: invalid JSON in POST request: %v", err)
-			http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "Delete player file handler: invalid JSON in POST request: %v", err)
+			writeError(w, r, ErrInvalidJSON, "Invalid JSON")
 			return
 		}
 
 	default:
-		log.Printf("Delete player file handler: method not allowed: %s", r.Method)
-		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		logWarn(r.Context(), "Delete player file handler: method not allowed: %s", r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	if req.SteamID == "" {
-		log.Printf("Delete player file handler: steamid is required")
-		http.Error(w, `{"error": "steamid is required"}`, http.StatusBadRequest)
+		logWarn(r.Context(), "Delete player file handler: steamid is required")
+		writeError(w, r, ErrInvalidRequest, "steamid is required")
+		return
+	}
+	if !checkIDs(w, r, "Delete player file", req.SteamID) {
+		return
+	}
+	if r = requestServer(w, r, req.Server, "Delete player file"); r == nil {
 		return
 	}
 
-	log.Printf("Delete player file handler processing request for SteamID: %s", req.SteamID)
-	response := deletePlayerFile(req.SteamID)
-	log.Printf("Delete player file handler response: Success=%t, Deleted=%t, Error=%s",
+	logInfo(r.Context(), "Delete player file handler processing request for SteamID: %s", req.SteamID)
+	if !checkPlayerPresence(w, r, req.SteamID, req.Force, "Delete player file") {
+		return
+	}
+
+	unlock := lockPlayer(r.Context(), req.SteamID)
+	defer unlock()
+	audit := beginAudit(r, "delete-player-file", req.SteamID, "", playerFilePath(r.Context(), req.SteamID))
+	response := deletePlayerFile(r.Context(), req.SteamID)
+	audit.finish(response.Success, response.Error)
+	logInfo(r.Context(), "Delete player file handler response: Success=%t, Deleted=%t, Error=%s",
 		response.Success, response.Deleted, response.Error)
-	json.NewEncoder(w).Encode(response)
+	writeResponse(w, r, response)
 }
 
 func deleteSlotFileHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-
-	if r.Method == "OPTIONS" {
-		return
-	}
 
 	var req CheckRequest
 
@@ -1731,8 +1802,8 @@ func deleteSlotFileHandler(w http.ResponseWriter, r *http.Request) {
 		steamid := r.URL.Query().Get("steamid")
 		slotID := r.URL.Query().Get("slot_id")
 		if steamid == "" || slotID == "" {
-			log.Printf("Delete slot file handler: missing parameters in GET request - steamid: %s, slot_id: %s", steamid, slotID)
-			http.Error(w, `{"error": "steamid and slot_id parameters are required"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "Delete slot file handler: missing parameters in GET request - steamid: %s, slot_id: %s", steamid, slotID)
+			writeError(w, r, ErrInvalidRequest, "steamid and slot_id parameters are required")
 			return
 		}
 		req.SteamID = steamid
@@ -1740,51 +1811,143 @@ func deleteSlotFileHandler(w http.ResponseWriter, r *http.Request) {
 
 	case "POST":
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			log.Printf("Delete slot file handler: invalid JSON in POST request: %v", err)
-			http.Error(w, `{"error": "Invalid JSON"}`, http.StatusBadRequest)
+			logWarn(r.Context(), "Delete slot file handler: invalid JSON in POST request: %v", err)
+			writeError(w, r, ErrInvalidJSON, "Invalid JSON")
 			return
 		}
 
 	default:
-		log.Printf("Delete slot file handler: method not allowed: %s", r.Method)
-		http.Error(w, `{"error": "Method not allowed"}`, http.StatusMethodNotAllowed)
+		logWarn(r.Context(), "Delete slot file handler: method not allowed: %s", r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	if req.SteamID == "" || req.SlotID == "" {
-		log.Printf("Delete slot file handler: steamid and slot_id are required")
-		http.Error(w, `{"error": "steamid and slot_id are required"}`, http.StatusBadRequest)
+		logWarn(r.Context(), "Delete slot file handler: steamid and slot_id are required")
+		writeError(w, r, ErrInvalidRequest, "steamid and slot_id are required")
+		return
+	}
+	if !checkIDs(w, r, "Delete slot file", req.SteamID, req.SlotID) {
+		return
+	}
+	if r = requestServer(w, r, req.Server, "Delete slot file"); r == nil {
 		return
 	}
 
-	log.Printf("Delete slot file handler processing request for SteamID: %s, SlotID: %s", req.SteamID, req.SlotID)
-	response := deleteSlotFile(req.SteamID, req.SlotID)
-	log.Printf("Delete slot file handler response: Success=%t, Deleted=%t, Error=%s",
+	logInfo(r.Context(), "Delete slot file handler processing request for SteamID: %s, SlotID: %s", req.SteamID, req.SlotID)
+	unlock := lockPlayer(r.Context(), req.SteamID)
+	defer unlock()
+	audit := beginAudit(r, "delete-slot-file", req.SteamID, req.SlotID, slotFilePath(r.Context(), req.SteamID, req.SlotID))
+	response := deleteSlotFile(r.Context(), req.SteamID, req.SlotID)
+	audit.finish(response.Success, response.Error)
+	logInfo(r.Context(), "Delete slot file handler response: Success=%t, Deleted=%t, Error=%s",
 		response.Success, response.Deleted, response.Error)
-	json.NewEncoder(w).Encode(response)
+	writeResponse(w, r, response)
+}
+
+func newAgentHandler() http.Handler {
+	return requestLogging(corsMiddleware(csrfProtection(serverSelection(recordRoute(http.DefaultServeMux)))))
+}
+
+// Маршруты регистрируются отдельно от main, чтобы тесты поднимали тот же набор обработчиков
+func registerRoutes() {
+	handleV1("/check", "/v2/players/{steamid}", checkHandler)
+	handleV1("/player-file", "/v2/players/{steamid}", playerFileContentHandler)
+	handleV1("/slot-file", "/v2/players/{steamid}/slots/{slot}", slotFileContentHandler)
+	handleV1("/transfer", "/v2/players/{steamid}/slots/{slot}/transfer", legacyMutation(transferHandler))
+	handleV1("/empty-slot", "/v2/players/{steamid}/slots/{slot}/empty", legacyMutation(emptySlotHandler))
+	handleV1("/restore-slot", "/v2/players/{steamid}/slots/{slot}/restore", legacyMutation(restoreSlotHandler))
+	handleV1("/write-slot", "/v2/players/{steamid}/slots/{slot}", legacyMutation(writeSlotHandler))
+	handleV1("/file-content", "", fileContentByPathHandler)
+	handleV1("/write-file", "", legacyMutation(writeFileHandler))
+	handleV1("/file-info", "", fileInfoHandler)
+	handleV1("/delete-file", "", legacyMutation(deleteFileHandler))
+	handleV1("/delete-player-file", "/v2/players/{steamid}", legacyMutation(deletePlayerFileHandler))
+	handleV1("/delete-slot-file", "/v2/players/{steamid}/slots/{slot}", legacyMutation(deleteSlotFileHandler))
+	registerV2Routes()
+	handleRoute("/history", historyHandler)
+	handleRoute("/history/version", historyVersionHandler)
+	handleRoute("/history/rollback", legacyMutation(historyRollbackHandler))
+	handleRoute("/diff", diffHandler)
+	handleRoute("/batch", batchHandler)
+	handleRoute("/jobs", jobsHandler)
+	handleRoute("/jobs/{id}", jobHandler)
+	handleRoute("/jobs/{id}/cancel", jobCancelHandler)
+	handleRoute("/events", eventsHandler)
+	handleRoute("/ws", wsHandler)
+	handleRoute("/webhooks/test", webhookTestHandler)
+	handleRoute("/rcon/players", rconPlayersHandler)
+	handleRoute("/rcon/kick", legacyMutation(rconKickHandler))
+	handleRoute("/rcon/announce", legacyMutation(rconAnnounceHandler))
+	handleRoute("/rcon/save", legacyMutation(rconSaveHandler))
+	handleRoute("/rcon/command", legacyMutation(rconCommandHandler))
+	handleRoute("/audit", auditHandler)
+	handleRoute("/metrics", metricsHandler)
+	handleRoute("/health", healthLiveHandler)
+	handleRoute("/health/live", healthLiveHandler)
+	handleRoute("/health/ready", healthReadyHandler)
+	handleRoute("/openapi.json", openAPIHandler)
+	handleRoute("/docs", docsHandler)
 }
 
 func main() {
-	http.HandleFunc("/check", checkHandler)
-	http.HandleFunc("/player-file", playerFileContentHandler)
-	http.HandleFunc("/slot-file", slotFileContentHandler)
-	http.HandleFunc("/transfer", transferHandler)
-	http.HandleFunc("/empty-slot", emptySlotHandler)
-	http.HandleFunc("/restore-slot", restoreSlotHandler)
-	http.HandleFunc("/write-slot", writeSlotHandler)
-	http.HandleFunc("/file-content", fileContentByPathHandler)
-	http.HandleFunc("/write-file", writeFileHandler)
-	http.HandleFunc("/file-info", fileInfoHandler)
-	http.HandleFunc("/delete-file", deleteFileHandler)
-	http.HandleFunc("/delete-player-file", deletePlayerFileHandler)
-	http.HandleFunc("/delete-slot-file", deleteSlotFileHandler)
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("Health check requested from %s", r.RemoteAddr)
-		w.Write([]byte(`{"status": "ok"}`))
-	})
-
-	port := ":8080"
+	// С аргументами бинарник работает как утилита администрирования (см. cli.go)
+	if len(os.Args) > 1 && os.Args[1] != "serve" {
+		os.Exit(runCLI(os.Args[1:]))
+	}
+
+	registerRoutes()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := loadConfig()
+	if err != nil {
+		logError(ctx, "Failed to load config: %v", err)
+		os.Exit(1)
+	}
+	config = cfg
+
+	if err := setupLogging(config.Logging); err != nil {
+		logError(ctx, "Invalid logging config: %v", err)
+		os.Exit(1)
+	}
+
+	if err := setupServers(ctx); err != nil {
+		logError(ctx, "Invalid servers config: %v", err)
+		os.Exit(1)
+	}
+
+	if err := registerUIRoutes(ctx); err != nil {
+		logError(ctx, "Invalid ui config: %v", err)
+		os.Exit(1)
+	}
+
+	webhooks.Start()
+	jobs.Start()
+	go watcher.Run(ctx)
+
+	port := agentPort
 	fmt.Printf("Server starting on port %s\n", port)
-	log.Printf("Server started successfully on port %s", port)
-	log.Fatal(http.ListenAndServe(port, nil))
+	logInfo(ctx, "Server started successfully on port %s", port)
+	server := &http.Server{
+		Addr:    port,
+		Handler: newAgentHandler(),
+	}
+	server.RegisterOnShutdown(func() { close(shuttingDown) })
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		logError(ctx, "Server stopped: %v", err)
+		os.Exit(1)
+	case <-ctx.Done():
+		// Повторный сигнал завершит процесс сразу
+		stop()
+		shutdownAgent(server)
+	}
 }
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Метрики в текстовом формате Prometheus без сторонних зависимостей
+
+type metric interface {
+	write(w io.Writer)
+}
+
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+type histogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+var registeredMetrics []metric
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	c := &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	registeredMetrics = append(registeredMetrics, c)
+	return c
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	h := &histogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogramSeries)}
+	registeredMetrics = append(registeredMetrics, h)
+	return h
+}
+
+// Значения меток склеиваются в ключ через символ, который не встречается в метках
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// Текстовый формат Prometheus экранирует в значениях меток только \\, \" и перевод строки
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names []string, key string, extra ...string) string {
+	var pairs []string
+	if len(names) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, names[i], labelValueEscaper.Replace(value)))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], labelValueEscaper.Replace(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func (c *counterVec) Add(value float64, labels ...string) {
+	key := labelKey(labels)
+	c.mu.Lock()
+	c.values[key] += value
+	c.mu.Unlock()
+}
+
+func (c *counterVec) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	if len(c.labels) == 0 && len(c.values) == 0 {
+		fmt.Fprintf(w, "%s 0\n", c.name)
+		return
+	}
+
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, key), formatFloat(c.values[key]))
+	}
+}
+
+func (h *histogramVec) Observe(value float64, labels ...string) {
+	key := labelKey(labels)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	series, exists := h.series[key]
+	if !exists {
+		series = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = series
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		series := h.series[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, "le", formatFloat(bound)), series.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, "le", "+Inf"), series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, key), formatFloat(series.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, key), series.count)
+	}
+}
+
+var (
+	requestDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	lockWaitBuckets        = []float64{0.0001, 0.001, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30}
+)
+
+var (
+	httpRequestsTotal    = newCounterVec("dino_http_requests_total", "HTTP requests by route, method and status code.", "route", "method", "code")
+	httpRequestDuration  = newHistogramVec("dino_http_request_duration_seconds", "HTTP request latency by route.", requestDurationBuckets, "route")
+	operationsTotal      = newCounterVec("dino_operations_total", "Mutating operations by outcome.", "operation", "outcome")
+	fileBytesRead        = newCounterVec("dino_file_read_bytes_total", "Bytes read from save files.")
+	fileBytesWritten     = newCounterVec("dino_file_written_bytes_total", "Bytes written to save files.")
+	backupsCreated       = newCounterVec("dino_backups_created_total", "Backups created before deleting files.")
+	backupBytesCreated   = newCounterVec("dino_backup_created_bytes_total", "Bytes copied into backups.")
+	lockWaitSeconds      = newHistogramVec("dino_player_lock_wait_seconds", "Time spent waiting for a per-player lock.", lockWaitBuckets)
+	webhookDeliveries    = newCounterVec("dino_webhook_deliveries_total", "Webhook delivery attempts by outcome.", "outcome")
+	metricsStartTime     = time.Now()
+	metricsScanMu        sync.Mutex
+	metricsScanCache     map[string]saveFileStats
+	metricsScanFetchedAt time.Time
+)
+
+const metricsScanTTL = 15 * time.Second
+
+type saveFileStats struct {
+	players     int
+	slots       int
+	backups     int
+	backupBytes int64
+}
+
+// Файлы считаются не чаще раза в metricsScanTTL, чтобы частый scrape не нагружал диск.
+// Счётчики ведутся по серверам, у каждого свои каталоги сохранений и бэкапов
+func currentSaveFileStats() map[string]saveFileStats {
+	metricsScanMu.Lock()
+	defer metricsScanMu.Unlock()
+
+	if !metricsScanFetchedAt.IsZero() && time.Since(metricsScanFetchedAt) < metricsScanTTL {
+		return metricsScanCache
+	}
+
+	stats := make(map[string]saveFileStats, len(gameServers))
+	for _, file := range scanWatchedFiles() {
+		server := stats[file.server]
+		if file.kind == "player" {
+			server.players++
+		} else {
+			server.slots++
+		}
+		stats[file.server] = server
+	}
+
+	for _, srv := range gameServers {
+		server := stats[srv.Name]
+		entries, _ := os.ReadDir(serverBackupDir(srv))
+		for _, entry := range entries {
+			if entry.IsDir() || filepath.Ext(entry.Name()) != ".backup" {
+				continue
+			}
+			if info, err := entry.Info(); err == nil {
+				server.backups++
+				server.backupBytes += info.Size()
+			}
+		}
+		stats[srv.Name] = server
+	}
+
+	metricsScanCache = stats
+	metricsScanFetchedAt = time.Now()
+	return stats
+}
+
+func writeServerGauge(w io.Writer, name, help string, stats map[string]saveFileStats, value func(saveFileStats) float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	servers := make([]string, 0, len(stats))
+	for server := range stats {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+	for _, server := range servers {
+		fmt.Fprintf(w, "%s%s %s\n", name, formatLabels([]string{"server"}, labelKey([]string{server})), formatFloat(value(stats[server])))
+	}
+}
+
+func writeGauge(w io.Writer, name, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, help, name, name, formatFloat(value))
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	for _, m := range registeredMetrics {
+		m.write(w)
+	}
+
+	stats := currentSaveFileStats()
+	writeServerGauge(w, "dino_player_files", "Player save files in the Players directory by server.", stats,
+		func(s saveFileStats) float64 { return float64(s.players) })
+	writeServerGauge(w, "dino_slot_files", "Slot files across all players by server.", stats,
+		func(s saveFileStats) float64 { return float64(s.slots) })
+	writeServerGauge(w, "dino_backup_files", "Backup files in the server backup directory.", stats,
+		func(s saveFileStats) float64 { return float64(s.backups) })
+	writeServerGauge(w, "dino_backup_bytes", "Total size of backup files by server.", stats,
+		func(s saveFileStats) float64 { return float64(s.backupBytes) })
+	writeGauge(w, "dino_jobs_queued", "Background jobs waiting in the queue.", float64(len(jobs.List(jobQueued))))
+	writeGauge(w, "dino_jobs_running", "Background jobs currently running.", float64(len(jobs.List(jobRunning))))
+	writeGauge(w, "dino_uptime_seconds", "Seconds since the agent started.", time.Since(metricsStartTime).Seconds())
+}
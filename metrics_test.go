@@ -0,0 +1,11 @@
+package main
+
+import "testing"
+
+func TestFormatLabelsEscaping(t *testing.T) {
+	got := formatLabels([]string{"route", "server"}, labelKey([]string{"GET /a\\b\"c\nd", "ивент\t1"}))
+	want := `{route="GET /a\\b\"c\nd",server="ивент` + "\t" + `1"}`
+	if got != want {
+		t.Fatalf("formatLabels = %s, want %s", got, want)
+	}
+}
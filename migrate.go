@@ -0,0 +1,412 @@
+package main
+
+import (
+	"DinoAgentApi/api"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Перенос игрока между профилями серверов: файл игрока и все слоты копируются (или переносятся)
+// из каталогов одного профиля в каталоги другого. Сначала строится план и проверяются все исходные
+// файлы, и только потом что-то записывается, поэтому невалидный слот не оставит перенос на полпути.
+
+type (
+	MigrateRequest  = api.MigrateRequest
+	MigrateResponse = api.MigrateResponse
+	MigratedFile    = api.MigratedFile
+)
+
+const (
+	migrateCopy = "copy"
+	migrateMove = "move"
+
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+	conflictRename    = "rename"
+
+	migrateCopied      = "copied"
+	migrateOverwritten = "overwritten"
+	migrateRenamed     = "renamed"
+	migrateSkipped     = "skipped"
+
+	// Сколько суффиксов перебирается для нового номера слота при политике rename
+	maxRenameAttempts = 1000
+)
+
+type migrationFile struct {
+	MigratedFile
+	content []byte
+}
+
+type migration struct {
+	steamid    string
+	from       *gameServer
+	to         *gameServer
+	mode       string
+	onConflict string
+	files      []migrationFile
+}
+
+func (m *migration) response() MigrateResponse {
+	response := MigrateResponse{SteamID: m.steamid, From: m.from.Name, To: m.to.Name, Mode: m.mode, Files: []MigratedFile{}}
+	for _, file := range m.files {
+		response.Files = append(response.Files, file.MigratedFile)
+	}
+	return response
+}
+
+// Пути всех затронутых файлов для аудита: исходные меняются только при переносе, но хэши пригодятся и при копировании
+func (m *migration) paths() []string {
+	var paths []string
+	for _, file := range m.files {
+		paths = append(paths, file.Source)
+		if file.Action != migrateSkipped {
+			paths = append(paths, file.Target)
+		}
+	}
+	return paths
+}
+
+func readMigrationSource(ctx context.Context, path string, response *MigrateResponse) ([]byte, bool) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		response.Error = fmt.Sprintf("Failed to read %s: %v", path, err)
+		response.ErrorCode = ErrIO
+		logError(ctx, "Migrate: failed to read %s: %v", path, err)
+		return nil, false
+	}
+	fileBytesRead.Add(float64(len(content)))
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		response.Error = fmt.Sprintf("Source file %s is not a valid JSON object: %v", path, err)
+		response.ErrorCode = ErrInvalidJSON
+		logWarn(ctx, "Migrate: invalid source file %s: %v", path, err)
+		return nil, false
+	}
+	return content, true
+}
+
+// Новый номер слота для политики rename: <слот>_1, <слот>_2 и так далее
+func freeSlotID(slotID string, taken map[string]bool) (string, bool) {
+	for n := 1; n <= maxRenameAttempts; n++ {
+		candidate := fmt.Sprintf("%s_%d", slotID, n)
+		if !validID(candidate) {
+			return "", false
+		}
+		if !taken[candidate] {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// В слоте, сохранённом через transfer, записан его номер; после переименования он должен совпадать с именем файла
+func renameSlotContent(content []byte, slotID string) []byte {
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		return content
+	}
+	if _, exists := decoded["slot_id"]; !exists {
+		return content
+	}
+	decoded["slot_id"] = slotID
+	renamed, err := json.MarshalIndent(decoded, "", "  ")
+	if err != nil {
+		return content
+	}
+	return renamed
+}
+
+func planMigration(ctx context.Context, steamid string, from, to *gameServer, mode, onConflict string) (*migration, MigrateResponse) {
+	if mode == "" {
+		mode = migrateCopy
+	}
+	if onConflict == "" {
+		onConflict = conflictSkip
+	}
+	m := &migration{steamid: steamid, from: from, to: to, mode: mode, onConflict: onConflict}
+	response := m.response()
+
+	if mode != migrateCopy && mode != migrateMove {
+		response.Error = "mode must be copy or move"
+		response.ErrorCode = ErrInvalidRequest
+		logWarn(ctx, "Migrate: invalid mode %q", mode)
+		return nil, response
+	}
+	if onConflict != conflictSkip && onConflict != conflictOverwrite && onConflict != conflictRename {
+		response.Error = "on_conflict must be skip, overwrite or rename"
+		response.ErrorCode = ErrInvalidRequest
+		logWarn(ctx, "Migrate: invalid conflict policy %q", onConflict)
+		return nil, response
+	}
+	if from == to {
+		response.Error = "Source and target server must differ"
+		response.ErrorCode = ErrInvalidRequest
+		logWarn(ctx, "Migrate: source and target are both %s", from.Name)
+		return nil, response
+	}
+
+	fromCtx := withServer(ctx, from)
+	toCtx := withServer(ctx, to)
+
+	sourceSlots, err := listPlayerSlots(fromCtx, steamid)
+	if err != nil {
+		response.Error = fmt.Sprintf("Failed to list source slots: %v", err)
+		response.ErrorCode = ErrIO
+		logError(ctx, "Migrate: failed to list slots of %s on %s: %v", steamid, from.Name, err)
+		return nil, response
+	}
+	targetSlots, err := listPlayerSlots(toCtx, steamid)
+	if err != nil {
+		response.Error = fmt.Sprintf("Failed to list target slots: %v", err)
+		response.ErrorCode = ErrIO
+		logError(ctx, "Migrate: failed to list slots of %s on %s: %v", steamid, to.Name, err)
+		return nil, response
+	}
+
+	// Занятыми считаются и слоты цели, и номера переносимых слотов, чтобы переименованный слот не столкнулся с ещё не скопированным
+	existing := make(map[string]bool)
+	taken := make(map[string]bool)
+	for _, slot := range targetSlots {
+		existing[slot.SlotID] = true
+		taken[slot.SlotID] = true
+	}
+	for _, slot := range sourceSlots {
+		taken[slot.SlotID] = true
+	}
+
+	playerFile := playerFilePath(fromCtx, steamid)
+	if _, err := os.Stat(playerFile); err == nil {
+		content, ok := readMigrationSource(ctx, playerFile, &response)
+		if !ok {
+			return nil, response
+		}
+		file := migrationFile{MigratedFile: MigratedFile{Kind: "player", Source: playerFile, Target: playerFilePath(toCtx, steamid), Action: migrateCopied}, content: content}
+		if _, err := os.Stat(file.Target); err == nil {
+			// Файл игрока всегда называется по SteamID, переименовать его нельзя
+			file.Action = migrateSkipped
+			if onConflict == conflictOverwrite {
+				file.Action = migrateOverwritten
+			}
+		}
+		m.files = append(m.files, file)
+	} else if !os.IsNotExist(err) {
+		response.Error = fmt.Sprintf("Error checking player file: %v", err)
+		response.ErrorCode = ErrIO
+		logError(ctx, "Migrate: error checking player file %s: %v", playerFile, err)
+		return nil, response
+	}
+
+	for _, slot := range sourceSlots {
+		source := slotFilePath(fromCtx, steamid, slot.SlotID)
+		content, ok := readMigrationSource(ctx, source, &response)
+		if !ok {
+			return nil, response
+		}
+
+		file := migrationFile{MigratedFile: MigratedFile{Kind: "slot", SlotID: slot.SlotID, TargetSlotID: slot.SlotID, Source: source, Action: migrateCopied}, content: content}
+		if existing[slot.SlotID] {
+			switch onConflict {
+			case conflictSkip:
+				file.Action = migrateSkipped
+			case conflictOverwrite:
+				file.Action = migrateOverwritten
+			case conflictRename:
+				renamed, ok := freeSlotID(slot.SlotID, taken)
+				if !ok {
+					response.Error = fmt.Sprintf("No free slot name for slot %s on server %s", slot.SlotID, to.Name)
+					response.ErrorCode = ErrConflict
+					logWarn(ctx, "Migrate: no free slot name for %s on %s", slot.SlotID, to.Name)
+					return nil, response
+				}
+				taken[renamed] = true
+				file.TargetSlotID = renamed
+				file.Action = migrateRenamed
+				file.content = renameSlotContent(content, renamed)
+			}
+		}
+		file.Target = slotFilePath(toCtx, steamid, file.TargetSlotID)
+		m.files = append(m.files, file)
+	}
+
+	if len(m.files) == 0 {
+		response.Error = fmt.Sprintf("No player or slot files for %s on server %s", steamid, from.Name)
+		response.ErrorCode = ErrNotFound
+		logWarn(ctx, "Migrate: nothing to migrate for %s on %s", steamid, from.Name)
+		return nil, response
+	}
+
+	logInfo(ctx, "Migrate: planned %d file(s) of %s from %s to %s (mode: %s, on_conflict: %s)",
+		len(m.files), steamid, from.Name, to.Name, mode, onConflict)
+	return m, m.response()
+}
+
+func (m *migration) run(ctx context.Context, dryRun bool) (result MigrateResponse) {
+	ctx = withLogAttrs(ctx, slog.String("steamid", m.steamid), slog.String("from", m.from.Name), slog.String("to", m.to.Name))
+	fromCtx := withServer(ctx, m.from)
+	toCtx := withServer(ctx, m.to)
+
+	var moved, skipped int
+	for _, file := range m.files {
+		if file.Action == migrateSkipped {
+			skipped++
+		} else {
+			moved++
+		}
+	}
+
+	if dryRun {
+		result = m.response()
+		result.Success = true
+		result.DryRun = true
+		result.Message = fmt.Sprintf("Dry run: %d file(s) would be %s to %s, %d skipped", moved, m.verb(), m.to.Name, skipped)
+		return result
+	}
+
+	defer func() {
+		emitWebhook(toCtx, WebhookEvent{Operation: "migrate", Success: result.Success, SteamID: m.steamid, Error: result.Error, Data: result})
+	}()
+
+	logInfo(ctx, "Migrate: %s %d file(s) of %s from %s to %s", m.mode, moved, m.steamid, m.from.Name, m.to.Name)
+	for i := range m.files {
+		file := &m.files[i]
+		if file.Action == migrateSkipped {
+			logInfo(ctx, "Migrate: skipping %s, target %s already exists", file.Source, file.Target)
+			continue
+		}
+
+		if file.Action == migrateOverwritten {
+			// Без бэкапа существующий файл цели не перезаписываем
+			file.BackupPath = createBackup(toCtx, file.Target)
+			if file.BackupPath == "" {
+				return m.failed(i, ErrIO, fmt.Sprintf("Failed to back up %s", file.Target))
+			}
+		}
+
+		if err := os.MkdirAll(filepath.Dir(file.Target), 0755); err != nil {
+			logError(ctx, "Migrate: failed to create directory for %s: %v", file.Target, err)
+			return m.failed(i, ErrIO, fmt.Sprintf("Failed to create directory: %v", err))
+		}
+		recordFileVersion(toCtx, file.Target, "migrate")
+		if err := os.WriteFile(file.Target, file.content, 0644); err != nil {
+			logError(ctx, "Migrate: failed to write %s: %v", file.Target, err)
+			return m.failed(i, ErrIO, fmt.Sprintf("Failed to write %s: %v", file.Target, err))
+		}
+		fileBytesWritten.Add(float64(len(file.content)))
+		logInfo(ctx, "Migrate: %s %s -> %s", file.Action, file.Source, file.Target)
+	}
+
+	// Исходные файлы удаляются только после того, как все копии записаны; пропущенные остаются на месте
+	if m.mode == migrateMove {
+		for _, file := range m.files {
+			if file.Action == migrateSkipped {
+				continue
+			}
+			recordFileVersion(fromCtx, file.Source, "migrate")
+			if err := os.Remove(file.Source); err != nil {
+				// Копия уже записана, поэтому только предупреждаем
+				logWarn(ctx, "Migrate: failed to remove source file %s: %v", file.Source, err)
+			}
+		}
+		// Каталог слотов удалится, только если в нём ничего не осталось
+		os.Remove(playerSlotsDir(fromCtx, m.steamid))
+	}
+
+	result = m.response()
+	result.Success = true
+	result.Message = fmt.Sprintf("%d file(s) %s from %s to %s, %d skipped", moved, m.verb(), m.from.Name, m.to.Name, skipped)
+	logInfo(ctx, "Migrate completed: %s", result.Message)
+	return result
+}
+
+func (m *migration) verb() string {
+	if m.mode == migrateMove {
+		return "moved"
+	}
+	return "copied"
+}
+
+// Ответ об ошибке перечисляет только файлы, записанные до сбоя
+func (m *migration) failed(index int, code ErrorCode, message string) MigrateResponse {
+	result := m.response()
+	result.Files = []MigratedFile{}
+	for _, file := range m.files[:index] {
+		if file.Action != migrateSkipped {
+			result.Files = append(result.Files, file.MigratedFile)
+		}
+	}
+	result.Error = fmt.Sprintf("%s; %d file(s) written before the failure, source files left in place", message, len(result.Files))
+	result.ErrorCode = code
+	return result
+}
+
+func v2MigratePlayerHandler(w http.ResponseWriter, r *http.Request) {
+	steamid := r.PathValue("steamid")
+
+	body, ok := readJSONBody(w, r, "Migrate player")
+	if !ok {
+		return
+	}
+	var req MigrateRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		logWarn(r.Context(), "Migrate player handler: invalid request: %v", err)
+		writeError(w, r, ErrInvalidJSON, "Invalid JSON")
+		return
+	}
+	if req.To == "" {
+		logWarn(r.Context(), "Migrate player handler: to is required")
+		writeError(w, r, ErrInvalidRequest, "to is required")
+		return
+	}
+	if !checkIDs(w, r, "Migrate player", steamid) {
+		return
+	}
+	if r = requestServer(w, r, req.From, "Migrate player"); r == nil {
+		return
+	}
+	to, ok := lookupServer(req.To)
+	if !ok {
+		logWarn(r.Context(), "Migrate player handler: unknown target server %q", req.To)
+		writeError(w, r, ErrNotFound, "Unknown server: "+req.To)
+		return
+	}
+	from := serverFrom(r.Context())
+
+	logInfo(r.Context(), "Migrate player handler processing request for SteamID: %s, %s -> %s, mode: %q, on_conflict: %q, dry_run: %t",
+		steamid, from.Name, to.Name, req.Mode, req.OnConflict, req.DryRun)
+
+	// Игрок не должен быть онлайн на сервере назначения, а при переносе и на исходном
+	if !req.DryRun {
+		if req.Mode == migrateMove && !checkPlayerPresence(w, r, steamid, req.Force, "Migrate player") {
+			return
+		}
+		if !checkPlayerPresence(w, r.WithContext(withServer(r.Context(), to)), steamid, req.Force, "Migrate player") {
+			return
+		}
+	}
+
+	unlock := lockPlayerOnServers(r.Context(), from, to, steamid)
+	defer unlock()
+	plan, response := planMigration(r.Context(), steamid, from, to, req.Mode, req.OnConflict)
+	if plan == nil {
+		writeResponse(w, r, response)
+		return
+	}
+	if req.DryRun {
+		writeResponse(w, r, plan.run(r.Context(), true))
+		return
+	}
+
+	audit := beginAuditAs(withServer(r.Context(), to), requestActor(r), "migrate-player", steamid, "", plan.paths()...).
+		details("from=%s to=%s mode=%s on_conflict=%s", from.Name, to.Name, plan.mode, plan.onConflict)
+	response = plan.run(r.Context(), false)
+	audit.finish(response.Success, response.Error)
+	logInfo(r.Context(), "Migrate player handler response: Success=%t, Error=%s", response.Success, response.Error)
+	writeResponse(w, r, response)
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Описание API в формате OpenAPI 3.1. Схемы строятся рефлексией из тех же структур,
+// что используют обработчики, поэтому поля в документации не расходятся с кодом.
+
+const apiSpecVersion = "2.0.0"
+
+type jsonObject = map[string]interface{}
+
+type apiParam struct {
+	Name        string
+	In          string
+	Type        string
+	Required    bool
+	Description string
+}
+
+type apiOperation struct {
+	Method      string
+	Path        string
+	Summary     string
+	Tag         string
+	Params      []apiParam
+	Request     interface{}
+	Response    interface{}
+	Status      int
+	ContentType string
+	Deprecated  bool
+}
+
+var (
+	registeredRoutes []string
+
+	openAPIOnce     sync.Once
+	openAPIDocument []byte
+
+	//go:embed assets/docs.html
+	docsPage []byte
+)
+
+// Все документируемые маршруты регистрируются через handleRoute, иначе проверка покрытия их не увидит
+func handleRoute(pattern string, handler http.HandlerFunc) {
+	registeredRoutes = append(registeredRoutes, pattern)
+	http.HandleFunc(pattern, handler)
+}
+
+// Служебные маршруты (JSON 404/405 для v2) в описание не входят
+func handleHiddenRoute(pattern string, handler http.HandlerFunc) {
+	http.HandleFunc(pattern, handler)
+}
+
+func queryParam(name, description string) apiParam {
+	return apiParam{Name: name, In: "query", Type: "string", Description: description}
+}
+
+func requiredQueryParam(name, description string) apiParam {
+	return apiParam{Name: name, In: "query", Type: "string", Required: true, Description: description}
+}
+
+func boolQueryParam(name, description string) apiParam {
+	return apiParam{Name: name, In: "query", Type: "boolean", Description: description}
+}
+
+func intQueryParam(name, description string) apiParam {
+	return apiParam{Name: name, In: "query", Type: "integer", Description: description}
+}
+
+// Маршрут v1: GET с параметрами в query и POST с тем же запросом в JSON теле
+func legacyOperations(path, summary, tag string, mutation bool, request, response interface{}, params ...apiParam) []apiOperation {
+	return []apiOperation{
+		{Method: "GET", Path: path, Summary: summary, Tag: tag, Params: params, Response: response, Deprecated: mutation},
+		{Method: "POST", Path: path, Summary: summary, Tag: tag, Request: request, Response: response},
+	}
+}
+
+func forceParam() apiParam {
+	return boolQueryParam("force", "Skip the online player check")
+}
+
+func apiOperations() []apiOperation {
+	var ops []apiOperation
+	add := func(list ...apiOperation) { ops = append(ops, list...) }
+	addAll := func(list []apiOperation) { ops = append(ops, list...) }
+
+	steamid := requiredQueryParam("steamid", "Player SteamID")
+	slotID := requiredQueryParam("slot_id", "Slot identifier")
+	oldSlotID := requiredQueryParam("old_slot_id", "Slot the current dinosaur is saved to")
+	filePath := requiredQueryParam("file_path", "Absolute path of the file")
+
+	addAll(legacyOperations("/check", "Check whether a player file exists", "players", false, CheckRequest{}, CheckResponse{}, steamid))
+	addAll(legacyOperations("/player-file", "Read a player file", "players", false, CheckRequest{}, FileContentResponse{}, steamid))
+	addAll(legacyOperations("/slot-file", "Read a slot file", "players", false, CheckRequest{}, FileContentResponse{}, steamid, slotID))
+	addAll(legacyOperations("/transfer", "Save the current dinosaur into a slot", "players", true, CheckRequest{}, TransferResponse{}, steamid, oldSlotID, forceParam()))
+	addAll(legacyOperations("/empty-slot", "Create an empty slot", "players", true, CheckRequest{}, EmptySlotResponse{}, steamid, oldSlotID))
+	addAll(legacyOperations("/restore-slot", "Restore a slot into the player file", "players", true, CheckRequest{}, RestoreSlotResponse{}, steamid, slotID, forceParam()))
+	addAll(legacyOperations("/write-slot", "Write slot JSON", "players", true, WriteSlotRequest{}, WriteSlotResponse{},
+		steamid, requiredQueryParam("file_name", "Slot file name"), queryParam("data", "Slot JSON"), forceParam()))
+	addAll(legacyOperations("/delete-player-file", "Delete a player file with backup", "players", true, CheckRequest{}, DeleteFileResponse{}, steamid, forceParam()))
+	addAll(legacyOperations("/delete-slot-file", "Delete a slot file with backup", "players", true, CheckRequest{}, DeleteFileResponse{}, steamid, slotID))
+
+	addAll(legacyOperations("/file-content", "Read any file", "files", false, FilePathRequest{}, FileContentByPathResponse{}, filePath))
+	addAll(legacyOperations("/write-file", "Write JSON to any file", "files", true, WriteFileRequest{}, WriteFileResponse{},
+		filePath, queryParam("data", "File JSON"), forceParam()))
+	addAll(legacyOperations("/file-info", "File metadata", "files", false, FilePathRequest{}, FileInfoResponse{}, filePath))
+	addAll(legacyOperations("/delete-file", "Delete any file", "files", true, DeleteFileRequest{}, DeleteFileResponse{},
+		filePath, boolQueryParam("backup", "Create a backup first (default true)"), forceParam()))
+
+	historyParams := []apiParam{queryParam("steamid", "Player SteamID"), queryParam("slot_id", "Slot identifier"), queryParam("file_path", "Absolute path of the file")}
+	addAll(legacyOperations("/history", "List saved versions of a file", "history", false, FileHistoryRequest{}, FileVersionsResponse{}, historyParams...))
+	addAll(legacyOperations("/history/version", "Read a saved version", "history", false, FileHistoryRequest{}, FileVersionContentResponse{},
+		append(historyParams, intQueryParam("version_id", "Version number"))...))
+	addAll(legacyOperations("/history/rollback", "Roll a file back to a saved version", "history", true, FileHistoryRequest{}, RollbackResponse{},
+		append(historyParams, intQueryParam("version_id", "Version number"), forceParam())...))
+
+	var diffParams []apiParam
+	for _, side := range []string{"left", "right"} {
+		diffParams = append(diffParams,
+			queryParam(side+"_type", "Source type: player, slot, backup, path or version"),
+			queryParam(side+"_server", "Server profile of a player, slot or backup source"),
+			queryParam(side+"_steamid", "Player SteamID"),
+			queryParam(side+"_slot_id", "Slot identifier"),
+			queryParam(side+"_backup", "Backup file name"),
+			queryParam(side+"_file_path", "Absolute path of the file"),
+			intQueryParam(side+"_version_id", "Version number"))
+	}
+	addAll(legacyOperations("/diff", "Structural diff of two JSON sources", "history", false, DiffRequest{}, DiffResponse{},
+		append(diffParams, queryParam("format", "Set to text for a plain text diff"))...))
+
+	add(
+		apiOperation{Method: "POST", Path: "/batch", Summary: "Run several operations in one request", Tag: "batch", Request: BatchRequest{}, Response: BatchResponse{}},
+		apiOperation{Method: "GET", Path: "/jobs", Summary: "List background jobs", Tag: "jobs", Params: []apiParam{queryParam("status", "Filter by status")}, Response: JobListResponse{}},
+		apiOperation{Method: "POST", Path: "/jobs", Summary: "Submit a background job", Tag: "jobs", Request: JobSubmitRequest{}, Response: JobResponse{}, Status: http.StatusAccepted},
+		apiOperation{Method: "GET", Path: "/jobs/{id}", Summary: "Get a job", Tag: "jobs", Response: JobResponse{}},
+		apiOperation{Method: "DELETE", Path: "/jobs/{id}", Summary: "Cancel a job", Tag: "jobs", Response: JobResponse{}},
+		apiOperation{Method: "POST", Path: "/jobs/{id}/cancel", Summary: "Cancel a job", Tag: "jobs", Response: JobResponse{}},
+		apiOperation{Method: "GET", Path: "/events", Summary: "Server-sent file change events", Tag: "events", ContentType: "text/event-stream", Response: FileEvent{},
+			Params: []apiParam{queryParam("steamid", "Only events for this player"), queryParam("kind", "player or slot")}},
+		apiOperation{Method: "GET", Path: "/ws", Summary: "WebSocket JSON-RPC endpoint", Tag: "events", Status: http.StatusSwitchingProtocols},
+	)
+	add(apiOperation{Method: "POST", Path: "/webhooks/test", Summary: "Send a test event to configured webhook endpoints", Tag: "webhooks",
+		Request: WebhookTestRequest{}, Response: WebhookTestResponse{}})
+
+	rconParams := []apiParam{queryParam("steamid", "Player SteamID"), queryParam("reason", "Kick reason"), queryParam("message", "Message text"),
+		queryParam("command", "Command name"), queryParam("payload", "Command payload")}
+	addAll(legacyOperations("/rcon/players", "List online players", "rcon", false, RCONRequest{}, RCONPlayersResponse{}))
+	addAll(legacyOperations("/rcon/kick", "Kick a player", "rcon", true, RCONRequest{}, RCONResponse{}, rconParams[:2]...))
+	addAll(legacyOperations("/rcon/announce", "Announce or direct message", "rcon", true, RCONRequest{}, RCONResponse{}, rconParams[0], rconParams[2]))
+	addAll(legacyOperations("/rcon/save", "Save the world", "rcon", true, RCONRequest{}, RCONResponse{}))
+	addAll(legacyOperations("/rcon/command", "Run an allowed RCON command", "rcon", true, RCONRequest{}, RCONResponse{}, rconParams[3:]...))
+
+	add(
+		apiOperation{Method: "GET", Path: "/audit", Summary: "Query the audit log", Tag: "audit", Response: AuditQueryResponse{}, Params: []apiParam{
+			queryParam("from", "RFC 3339 start time"), queryParam("to", "RFC 3339 end time"), queryParam("operation", "Operation name"),
+			queryParam("steamid", "Player SteamID"), queryParam("slot_id", "Slot identifier"), queryParam("caller", "Caller name"),
+			queryParam("path", "File path"), boolQueryParam("success", "Only successful or failed entries"), intQueryParam("limit", "Maximum entries (default 100)")}},
+		apiOperation{Method: "GET", Path: "/metrics", Summary: "Prometheus metrics", Tag: "system", ContentType: "text/plain"},
+		apiOperation{Method: "GET", Path: "/health", Summary: "Liveness probe", Tag: "system", Response: map[string]string{}},
+		apiOperation{Method: "GET", Path: "/health/live", Summary: "Liveness probe", Tag: "system", Response: map[string]string{}},
+		apiOperation{Method: "GET", Path: "/health/ready", Summary: "Readiness probe", Tag: "system", Response: HealthResponse{},
+			Params: []apiParam{queryParam("server", "Check only this server profile")}},
+		apiOperation{Method: "GET", Path: "/openapi.json", Summary: "This document", Tag: "system", Response: jsonObject{}},
+		apiOperation{Method: "GET", Path: "/docs", Summary: "API documentation page", Tag: "system", ContentType: "text/html"},
+	)
+
+	player := "/v2/players/{steamid}"
+	slot := player + "/slots/{slot}"
+	force := []apiParam{forceParam()}
+	add(
+		apiOperation{Method: "GET", Path: "/v2/players", Summary: "List player files", Tag: "v2", Response: PlayerListResponse{}},
+		apiOperation{Method: "GET", Path: player, Summary: "Read a player file", Tag: "v2", Response: FileContentResponse{}},
+		apiOperation{Method: "PUT", Path: player, Summary: "Replace a player file", Tag: "v2", Params: force, Request: json.RawMessage{}, Response: WriteFileResponse{}},
+		apiOperation{Method: "PATCH", Path: player, Summary: "Merge patch a player file (RFC 7396)", Tag: "v2", Params: force, Request: json.RawMessage{}, Response: WriteFileResponse{}},
+		apiOperation{Method: "DELETE", Path: player, Summary: "Delete a player file with backup", Tag: "v2", Params: force, Response: DeleteFileResponse{}},
+		apiOperation{Method: "GET", Path: player + "/slots", Summary: "List player slots", Tag: "v2", Response: SlotListResponse{}},
+		apiOperation{Method: "GET", Path: slot, Summary: "Read a slot file", Tag: "v2", Response: FileContentResponse{}},
+		apiOperation{Method: "PUT", Path: slot, Summary: "Replace a slot file", Tag: "v2", Params: force, Request: json.RawMessage{}, Response: WriteSlotResponse{}},
+		apiOperation{Method: "PATCH", Path: slot, Summary: "Merge patch a slot file (RFC 7396)", Tag: "v2", Params: force, Request: json.RawMessage{}, Response: WriteSlotResponse{}},
+		apiOperation{Method: "DELETE", Path: slot, Summary: "Delete a slot file with backup", Tag: "v2", Response: DeleteFileResponse{}},
+		apiOperation{Method: "POST", Path: slot + "/transfer", Summary: "Save the current dinosaur into the slot", Tag: "v2", Params: force, Response: TransferResponse{}},
+		apiOperation{Method: "POST", Path: slot + "/restore", Summary: "Restore the slot into the player file", Tag: "v2", Params: force, Response: RestoreSlotResponse{}},
+		apiOperation{Method: "POST", Path: slot + "/empty", Summary: "Create an empty slot", Tag: "v2", Response: EmptySlotResponse{}},
+		apiOperation{Method: "POST", Path: player + "/migrate", Summary: "Copy or move a player file and all slots to another server profile", Tag: "v2",
+			Request: MigrateRequest{}, Response: MigrateResponse{}},
+		apiOperation{Method: "GET", Path: "/v2/backups", Summary: "List backup files, newest first", Tag: "v2",
+			Params: []apiParam{queryParam("prefix", "Only backups whose name starts with this prefix")}, Response: BackupListResponse{}},
+		apiOperation{Method: "POST", Path: "/v2/backups/{name}/restore", Summary: "Restore a backup into a player or slot file", Tag: "v2",
+			Request: BackupRestoreRequest{}, Response: BackupRestoreResponse{}},
+		apiOperation{Method: "GET", Path: "/v2/servers", Summary: "List configured server profiles", Tag: "v2", Response: ServerListResponse{}},
+	)
+
+	// Профиль сервера выбирается одинаково для всех маршрутов API, кроме служебных
+	server := queryParam("server", "Server profile (default profile when omitted)")
+	for i := range ops {
+		if ops[i].Tag != "system" {
+			ops[i].Params = append(append([]apiParam{}, ops[i].Params...), server)
+		}
+	}
+
+	return ops
+}
+
+type schemaBuilder struct {
+	schemas jsonObject
+}
+
+var (
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	timeType       = reflect.TypeOf(time.Time{})
+	errorCodeType  = reflect.TypeOf(ErrorCode(""))
+)
+
+func schemaRef(name string) jsonObject {
+	return jsonObject{"$ref": "#/components/schemas/" + name}
+}
+
+func (b *schemaBuilder) schemaFor(t reflect.Type) jsonObject {
+	switch t {
+	case rawMessageType:
+		return jsonObject{"description": "Arbitrary JSON value"}
+	case timeType:
+		return jsonObject{"type": "string", "format": "date-time"}
+	case errorCodeType:
+		return schemaRef("ErrorCode")
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return b.schemaFor(t.Elem())
+	case reflect.String:
+		return jsonObject{"type": "string"}
+	case reflect.Bool:
+		return jsonObject{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return jsonObject{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return jsonObject{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return jsonObject{"type": "array", "items": b.schemaFor(t.Elem())}
+	case reflect.Map:
+		return jsonObject{"type": "object", "additionalProperties": b.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		// Заглушка до построения защищает от бесконечной рекурсии на вложенных типах
+		if _, exists := b.schemas[t.Name()]; !exists {
+			b.schemas[t.Name()] = jsonObject{}
+			b.schemas[t.Name()] = b.structSchema(t)
+		}
+		return schemaRef(t.Name())
+	}
+	return jsonObject{}
+}
+
+func (b *schemaBuilder) structSchema(t reflect.Type) jsonObject {
+	properties := jsonObject{}
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = b.schemaFor(field.Type)
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Ptr {
+			required = append(required, name)
+		}
+	}
+
+	schema := jsonObject{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+var pathParamPattern = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+func (b *schemaBuilder) operation(op apiOperation) jsonObject {
+	var params []jsonObject
+	for _, match := range pathParamPattern.FindAllStringSubmatch(op.Path, -1) {
+		params = append(params, jsonObject{"name": match[1], "in": "path", "required": true, "schema": jsonObject{"type": "string"}})
+	}
+	for _, param := range op.Params {
+		params = append(params, jsonObject{
+			"name":        param.Name,
+			"in":          param.In,
+			"required":    param.Required,
+			"description": param.Description,
+			"schema":      jsonObject{"type": param.Type},
+		})
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	contentType := op.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	success := jsonObject{"description": http.StatusText(status)}
+	if op.Response != nil {
+		success["content"] = jsonObject{contentType: jsonObject{"schema": b.schemaFor(reflect.TypeOf(op.Response))}}
+	} else if op.ContentType != "" {
+		success["content"] = jsonObject{contentType: jsonObject{"schema": jsonObject{"type": "string"}}}
+	}
+
+	// v1 отдаёт плоскую ошибку, v2 (и X-API-Version: 2) - ErrorEnvelope
+	errorSchema := "LegacyError"
+	if strings.HasPrefix(op.Path, "/v2/") {
+		errorSchema = "ErrorEnvelope"
+	}
+
+	result := jsonObject{
+		"summary":     op.Summary,
+		"operationId": operationID(op),
+		"tags":        []string{op.Tag},
+		"responses": jsonObject{
+			fmt.Sprint(status): success,
+			"default": jsonObject{
+				"description": "Error",
+				"content":     jsonObject{"application/json": jsonObject{"schema": schemaRef(errorSchema)}},
+			},
+		},
+	}
+	if len(params) > 0 {
+		result["parameters"] = params
+	}
+	if op.Request != nil {
+		result["requestBody"] = jsonObject{
+			"required": true,
+			"content":  jsonObject{"application/json": jsonObject{"schema": b.schemaFor(reflect.TypeOf(op.Request))}},
+		}
+	}
+	if op.Deprecated {
+		result["deprecated"] = true
+		result["description"] = "Mutation over GET is deprecated and rejected in strict mode; use POST."
+	}
+	return result
+}
+
+func operationID(op apiOperation) string {
+	var parts []string
+	for _, part := range strings.FieldsFunc(op.Path, func(c rune) bool { return c == '/' || c == '-' || c == '.' || c == '{' || c == '}' || c == '_' }) {
+		parts = append(parts, strings.ToUpper(part[:1])+part[1:])
+	}
+	return strings.ToLower(op.Method) + strings.Join(parts, "")
+}
+
+func buildOpenAPI() jsonObject {
+	builder := &schemaBuilder{schemas: jsonObject{}}
+	paths := jsonObject{}
+
+	for _, op := range apiOperations() {
+		item, _ := paths[op.Path].(jsonObject)
+		if item == nil {
+			item = jsonObject{}
+			paths[op.Path] = item
+		}
+		item[strings.ToLower(op.Method)] = builder.operation(op)
+	}
+
+	var codes []string
+	for code := range errorStatuses {
+		codes = append(codes, string(code))
+	}
+	sort.Strings(codes)
+	builder.schemas["ErrorCode"] = jsonObject{"type": "string", "enum": codes}
+	builder.schemaFor(reflect.TypeOf(ErrorEnvelope{}))
+	builder.schemas["LegacyError"] = jsonObject{
+		"type":     "object",
+		"required": []string{"error"},
+		"properties": jsonObject{
+			"error":      jsonObject{"type": "string"},
+			"error_code": schemaRef("ErrorCode"),
+		},
+		"additionalProperties": true,
+	}
+
+	return jsonObject{
+		"openapi": "3.1.0",
+		"info": jsonObject{
+			"title":       "Dino Agent API",
+			"version":     apiSpecVersion,
+			"description": "Routes without a prefix are also available under /v1. Send X-API-Version: 2 to get v2 error envelopes and HTTP statuses on v1 routes.",
+		},
+		"paths": paths,
+		"components": jsonObject{
+			"schemas": builder.schemas,
+			"securitySchemes": jsonObject{
+				"apiKey": jsonObject{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+				"bearer": jsonObject{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []jsonObject{{}, {"apiKey": []string{}}, {"bearer": []string{}}},
+	}
+}
+
+// Маршрут без описания или описание без маршрута - ошибка; проверяется в openapi_test.go
+func checkOpenAPICoverage() []string {
+	documented := map[string]bool{}
+	documentedPaths := map[string]bool{}
+	for _, op := range apiOperations() {
+		documented[op.Method+" "+op.Path] = true
+		documentedPaths[op.Path] = true
+	}
+
+	var problems []string
+	covered := map[string]bool{}
+	for _, pattern := range registeredRoutes {
+		method, path, hasMethod := strings.Cut(pattern, " ")
+		if !hasMethod {
+			method, path = "", pattern
+		}
+		path = strings.TrimPrefix(path, "/v1")
+
+		if method != "" {
+			if !documented[method+" "+path] {
+				problems = append(problems, fmt.Sprintf("route %q is not described in the OpenAPI document", pattern))
+			}
+			covered[method+" "+path] = true
+			continue
+		}
+		if !documentedPaths[path] {
+			problems = append(problems, fmt.Sprintf("route %q is not described in the OpenAPI document", pattern))
+		}
+		for key := range documented {
+			if strings.HasSuffix(key, " "+path) {
+				covered[key] = true
+			}
+		}
+	}
+
+	for key := range documented {
+		if !covered[key] {
+			problems = append(problems, fmt.Sprintf("operation %q is described but no route is registered", key))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	openAPIOnce.Do(func() {
+		document, err := json.MarshalIndent(buildOpenAPI(), "", "  ")
+		if err != nil {
+			logError(context.Background(), "Failed to build OpenAPI document: %v", err)
+			return
+		}
+		openAPIDocument = document
+	})
+
+	if openAPIDocument == nil {
+		writeError(w, r, ErrInternal, "OpenAPI document is not available")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDocument)
+}
+
+func docsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docsPage)
+}
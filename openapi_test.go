@@ -0,0 +1,21 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+var routesOnce sync.Once
+
+// DefaultServeMux не допускает повторной регистрации, поэтому маршруты регистрируются один раз на все тесты
+func registerTestRoutes() {
+	routesOnce.Do(registerRoutes)
+}
+
+func TestOpenAPICoverage(t *testing.T) {
+	registerTestRoutes()
+
+	for _, problem := range checkOpenAPICoverage() {
+		t.Error(problem)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type PresenceProvider interface {
+	IsOnline(steamid string) (bool, error)
+}
+
+type PlayerOnlineError struct {
+	SteamID string
+}
+
+func (e *PlayerOnlineError) Error() string {
+	return fmt.Sprintf("Player %s is online, changes would be overwritten by the game", e.SteamID)
+}
+
+type PresenceUnavailableError struct {
+	Err error
+}
+
+func (e *PresenceUnavailableError) Error() string {
+	return fmt.Sprintf("Unable to check whether player is online: %v", e.Err)
+}
+
+type noPresence struct{}
+
+func (noPresence) IsOnline(steamid string) (bool, error) {
+	return false, nil
+}
+
+type rconPresence struct {
+	client *RCONClient
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	online  map[string]bool
+	fetched time.Time
+}
+
+func (p *rconPresence) IsOnline(steamid string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Список игроков кэшируется, чтобы пакетные операции не дёргали RCON на каждый файл
+	if p.online == nil || time.Since(p.fetched) > p.ttl {
+		players, err := p.client.Players()
+		if err != nil {
+			return false, err
+		}
+		p.online = make(map[string]bool, len(players))
+		for _, player := range players {
+			p.online[player.SteamID] = true
+		}
+		p.fetched = time.Now()
+	}
+
+	return p.online[steamid], nil
+}
+
+func (p *rconPresence) invalidate() {
+	p.mu.Lock()
+	p.online = nil
+	p.mu.Unlock()
+}
+
+func newPresence(ctx context.Context, srv *gameServer) PresenceProvider {
+	switch config.Presence.Provider {
+	case "none":
+		return noPresence{}
+	case "", "rcon":
+		if srv.rcon == nil {
+			if config.Presence.Provider == "rcon" {
+				logWarn(ctx, "Presence: provider rcon requested but RCON is not configured for server %s, online checks disabled", srv.Name)
+			}
+			return noPresence{}
+		}
+		logInfo(ctx, "Presence: using RCON player list of server %s, online policy: %s", srv.Name, config.Presence.OnlinePolicy)
+		return &rconPresence{
+			client: srv.rcon,
+			ttl:    time.Duration(config.Presence.CacheSeconds) * time.Second,
+		}
+	default:
+		logWarn(ctx, "Presence: unknown provider %q, online checks disabled", config.Presence.Provider)
+		return noPresence{}
+	}
+}
+
+func ensurePlayerOffline(ctx context.Context, steamid string, force bool) error {
+	if force {
+		logInfo(ctx, "Presence: online check for %s skipped by force flag", steamid)
+		return nil
+	}
+
+	// Игрок онлайн только на том сервере, чьи файлы меняются
+	srv := serverFrom(ctx)
+	online, err := srv.presence.IsOnline(steamid)
+	if err != nil {
+		if config.Presence.AllowWhenUnavailable {
+			// Остановленный сервер не отвечает по RCON - значит, онлайн никого нет
+			logWarn(ctx, "Presence: check for %s failed, allowing operation: %v", steamid, err)
+			return nil
+		}
+		return &PresenceUnavailableError{Err: err}
+	}
+	if !online {
+		return nil
+	}
+
+	if config.Presence.OnlinePolicy != "kick" || srv.rcon == nil {
+		logWarn(ctx, "Presence: player %s is online, refusing operation", steamid)
+		return &PlayerOnlineError{SteamID: steamid}
+	}
+
+	logInfo(ctx, "Presence: player %s is online, kicking before applying changes", steamid)
+	if _, err := srv.rcon.Kick(steamid, config.Presence.KickReason); err != nil {
+		return &PresenceUnavailableError{Err: fmt.Errorf("failed to kick player: %v", err)}
+	}
+
+	// Даём игре время сохранить и выгрузить игрока, но не держим отменённый запрос или задание
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Duration(config.Presence.KickWaitSeconds) * time.Second):
+	}
+
+	if cached, ok := srv.presence.(*rconPresence); ok {
+		cached.invalidate()
+	}
+	online, err = srv.presence.IsOnline(steamid)
+	if err != nil {
+		return &PresenceUnavailableError{Err: err}
+	}
+	if online {
+		logWarn(ctx, "Presence: player %s still online after kick", steamid)
+		return &PlayerOnlineError{SteamID: steamid}
+	}
+
+	logInfo(ctx, "Presence: player %s kicked, continuing", steamid)
+	return nil
+}
+
+// Проверка идёт до lockPlayer намеренно: блокировка упорядочивает только запросы агента,
+// а игрок может зайти в игру в любой момент после проверки, поэтому перенос под блокировку окна не закрывает.
+// Другой запрос, прошедший между проверкой и блокировкой, сам проходит эту же проверку,
+// а ожидание после кика не держит блокировку игрока
+func checkPlayerPresence(w http.ResponseWriter, r *http.Request, steamid string, force bool, name string) bool {
+	err := ensurePlayerOffline(r.Context(), steamid, force)
+	if err == nil {
+		return true
+	}
+
+	logWarn(r.Context(), "%s handler: %v", name, err)
+	if _, ok := err.(*PlayerOnlineError); ok {
+		writeErrorDetails(w, r, ErrLocked, err.Error(), map[string]interface{}{"online": true})
+	} else {
+		writeError(w, r, ErrUnavailable, err.Error())
+	}
+	return false
+}
+
+// Файл из каталогов профиля, изменяемый по пути, защищается так же, как по SteamID: проверка онлайна
+// на сервере файла и блокировка игрока. Запрос возвращается с контекстом этого сервера
+func guardFilePath(w http.ResponseWriter, r *http.Request, filePath string, force bool, name string) (*http.Request, string, func(), bool) {
+	srv, steamid := serverForPath(filePath)
+	if srv == nil {
+		return r, "", func() {}, true
+	}
+
+	r = r.WithContext(withServer(r.Context(), srv))
+	if !checkPlayerPresence(w, r, steamid, force, name) {
+		return r, steamid, nil, false
+	}
+	return r, steamid, lockPlayer(r.Context(), steamid), true
+}
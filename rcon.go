@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Байты команд RCON The Isle Evrima
+const (
+	rconLogin         byte = 0x01
+	rconCommand       byte = 0x02
+	rconAnnounce      byte = 0x10
+	rconDirectMessage byte = 0x11
+	rconServerDetails byte = 0x12
+	rconWipeCorpses   byte = 0x13
+	rconKick          byte = 0x30
+	rconPlayerList    byte = 0x40
+	rconSave          byte = 0x50
+)
+
+// Команды, доступные через /rcon/command
+var rconCommands = map[string]byte{
+	"announce":      rconAnnounce,
+	"directmessage": rconDirectMessage,
+	"serverdetails": rconServerDetails,
+	"wipecorpses":   rconWipeCorpses,
+	"kick":          rconKick,
+	"playerlist":    rconPlayerList,
+	"save":          rconSave,
+}
+
+const rconReadIdle = 200 * time.Millisecond
+
+// Ошибка записи пакета: команда до сервера не дошла, и её можно безопасно повторить
+type rconWriteError struct {
+	err error
+}
+
+func (e *rconWriteError) Error() string {
+	return e.err.Error()
+}
+
+func (e *rconWriteError) Unwrap() error {
+	return e.err
+}
+
+var steamIDPattern = regexp.MustCompile(`\b\d{17}\b`)
+
+type RCONPlayer struct {
+	SteamID string `json:"steamid"`
+	Name    string `json:"name,omitempty"`
+}
+
+type RCONRequest struct {
+	SteamID string `json:"steamid,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+	Command string `json:"command,omitempty"`
+	Payload string `json:"payload,omitempty"`
+}
+
+type RCONResponse struct {
+	Success   bool      `json:"success"`
+	Response  string    `json:"response,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	ErrorCode ErrorCode `json:"error_code,omitempty"`
+}
+
+type RCONPlayersResponse struct {
+	Success   bool         `json:"success"`
+	Count     int          `json:"count"`
+	Players   []RCONPlayer `json:"players"`
+	Error     string       `json:"error,omitempty"`
+	ErrorCode ErrorCode    `json:"error_code,omitempty"`
+}
+
+type RCONClient struct {
+	addr     string
+	password string
+	timeout  time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func NewRCONClient(host string, port int, password string, timeout time.Duration) *RCONClient {
+	return &RCONClient{
+		addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		password: password,
+		timeout:  timeout,
+	}
+}
+
+func (c *RCONClient) connect() error {
+	conn, err := net.DialTimeout("tcp", c.addr, c.timeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to RCON at %s: %v", c.addr, err)
+	}
+
+	packet := append([]byte{rconLogin}, c.password...)
+	packet = append(packet, 0x00)
+
+	response, err := c.roundTrip(conn, packet)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("RCON login failed: %v", err)
+	}
+	if !strings.Contains(strings.ToLower(response), "accepted") {
+		conn.Close()
+		return fmt.Errorf("RCON login rejected: %s", strings.TrimSpace(response))
+	}
+
+	c.conn = conn
+	logInfo(context.Background(), "RCON: connected to %s", c.addr)
+	return nil
+}
+
+func (c *RCONClient) roundTrip(conn net.Conn, packet []byte) (string, error) {
+	conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	if _, err := conn.Write(packet); err != nil {
+		return "", &rconWriteError{err: err}
+	}
+
+	// Протокол не передаёт длину ответа: ждём первый кусок полный таймаут,
+	// затем дочитываем, пока сервер не замолчит или не закроет соединение
+	// (так он отвечает на неверный пароль)
+	var response bytes.Buffer
+	buf := make([]byte, 4096)
+	deadline := time.Now().Add(c.timeout)
+
+	for {
+		conn.SetReadDeadline(deadline)
+		n, err := conn.Read(buf)
+		response.Write(buf[:n])
+
+		if err != nil {
+			var netErr net.Error
+			if response.Len() > 0 && (errors.Is(err, io.EOF) || errors.As(err, &netErr) && netErr.Timeout()) {
+				break
+			}
+			return response.String(), err
+		}
+		deadline = time.Now().Add(rconReadIdle)
+	}
+
+	return strings.TrimRight(response.String(), "\x00"), nil
+}
+
+func (c *RCONClient) Execute(command byte, payload string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	packet := []byte{rconCommand, command}
+	packet = append(packet, payload...)
+	packet = append(packet, 0x00)
+
+	// Одна повторная попытка с переподключением, если сервер закрыл сохранённое соединение
+	// и пакет не удалось записать. После успешной записи команда могла выполниться
+	// (kick, announce), поэтому ошибки чтения не повторяются
+	for attempt := 1; attempt <= 2; attempt++ {
+		reused := c.conn != nil
+		if !reused {
+			if err := c.connect(); err != nil {
+				return "", err
+			}
+		}
+
+		response, err := c.roundTrip(c.conn, packet)
+		if err == nil {
+			return response, nil
+		}
+
+		logWarn(context.Background(), "RCON: command 0x%02x failed on attempt %d: %v", command, attempt, err)
+		c.conn.Close()
+		c.conn = nil
+
+		var writeErr *rconWriteError
+		if !reused || !errors.As(err, &writeErr) {
+			return "", fmt.Errorf("RCON command failed: %v", err)
+		}
+	}
+	return "", nil
+}
+
+func (c *RCONClient) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+func parseRCONPlayerList(response string) []RCONPlayer {
+	players := []RCONPlayer{}
+
+	// Формат ответа: "PlayerList\n<id>,<id>,\n<name>,<name>,"
+	lines := strings.Split(strings.ReplaceAll(response, "\r", ""), "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(line), "PlayerList") || i+1 >= len(lines) {
+			continue
+		}
+
+		ids := strings.Split(lines[i+1], ",")
+		var names []string
+		if i+2 < len(lines) {
+			names = strings.Split(lines[i+2], ",")
+		}
+
+		for j, id := range ids {
+			id = strings.TrimSpace(id)
+			if id == "" {
+				continue
+			}
+			player := RCONPlayer{SteamID: id}
+			if j < len(names) {
+				player.Name = strings.TrimSpace(names[j])
+			}
+			players = append(players, player)
+		}
+		return players
+	}
+
+	// Неизвестный формат - достаём хотя бы SteamID
+	for _, id := range steamIDPattern.FindAllString(response, -1) {
+		players = append(players, RCONPlayer{SteamID: id})
+	}
+	return players
+}
+
+func (c *RCONClient) Players() ([]RCONPlayer, error) {
+	response, err := c.Execute(rconPlayerList, "")
+	if err != nil {
+		return nil, err
+	}
+	return parseRCONPlayerList(response), nil
+}
+
+func (c *RCONClient) Kick(steamid, reason string) (string, error) {
+	return c.Execute(rconKick, steamid+","+reason)
+}
+
+func (c *RCONClient) Announce(message string) (string, error) {
+	return c.Execute(rconAnnounce, message)
+}
+
+func (c *RCONClient) DirectMessage(steamid, message string) (string, error) {
+	return c.Execute(rconDirectMessage, steamid+","+message)
+}
+
+func (c *RCONClient) Save() (string, error) {
+	return c.Execute(rconSave, "")
+}
+
+// Команды уходят на RCON выбранного сервера
+func parseRCONRequest(w http.ResponseWriter, r *http.Request, name string) (*RCONClient, RCONRequest, bool) {
+	var req RCONRequest
+
+	srv := serverFrom(r.Context())
+	if srv.rcon == nil {
+		logWarn(r.Context(), "%s handler: RCON is not configured for server %s", name, srv.Name)
+		writeError(w, r, ErrUnavailable, "RCON is not configured for server "+srv.Name)
+		return nil, req, false
+	}
+
+	switch r.Method {
+	case "GET":
+		query := r.URL.Query()
+		req.SteamID = query.Get("steamid")
+		req.Reason = query.Get("reason")
+		req.Message = query.Get("message")
+		req.Command = query.Get("command")
+		req.Payload = query.Get("payload")
+
+	case "POST":
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				logWarn(r.Context(), "%s handler: invalid JSON in POST request: %v", name, err)
+				writeError(w, r, ErrInvalidJSON, "Invalid JSON")
+				return nil, req, false
+			}
+		}
+
+	default:
+		logWarn(r.Context(), "%s handler: method not allowed: %s", name, r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
+		return nil, req, false
+	}
+
+	return srv.rcon, req, true
+}
+
+func writeRCONResponse(w http.ResponseWriter, r *http.Request, name string, response string, err error) {
+	result := RCONResponse{Success: err == nil, Response: strings.TrimSpace(response)}
+	if err != nil {
+		result.Error = err.Error()
+		result.ErrorCode = ErrUpstream
+	}
+	logInfo(r.Context(), "%s handler response: Success=%t, Error=%s", name, result.Success, result.Error)
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusBadGateway
+	}
+	writeResponseStatus(w, r, status, result)
+}
+
+func rconPlayersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rcon, _, ok := parseRCONRequest(w, r, "RCON players")
+	if !ok {
+		return
+	}
+
+	players, err := rcon.Players()
+	if err != nil {
+		logError(r.Context(), "RCON players handler: %v", err)
+		writeResponseStatus(w, r, http.StatusBadGateway, RCONPlayersResponse{Success: false, Players: []RCONPlayer{}, Error: err.Error(), ErrorCode: ErrUpstream})
+		return
+	}
+
+	logInfo(r.Context(), "RCON players handler response: %d players online", len(players))
+	writeResponse(w, r, RCONPlayersResponse{Success: true, Count: len(players), Players: players})
+}
+
+func rconKickHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rcon, req, ok := parseRCONRequest(w, r, "RCON kick")
+	if !ok {
+		return
+	}
+
+	if req.SteamID == "" {
+		logWarn(r.Context(), "RCON kick handler: steamid is required")
+		writeError(w, r, ErrInvalidRequest, "steamid is required")
+		return
+	}
+	// Поля команды разделяются запятой, поэтому SteamID проверяется как в остальных обработчиках
+	if !checkIDs(w, r, "RCON kick", req.SteamID) {
+		return
+	}
+
+	logInfo(r.Context(), "RCON kick handler kicking SteamID: %s, reason: %s", req.SteamID, req.Reason)
+	response, err := rcon.Kick(req.SteamID, req.Reason)
+	beginAudit(r, "rcon-kick", req.SteamID, "").details("reason=%s", req.Reason).finish(err == nil, errString(err))
+	writeRCONResponse(w, r, "RCON kick", response, err)
+}
+
+func rconAnnounceHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rcon, req, ok := parseRCONRequest(w, r, "RCON announce")
+	if !ok {
+		return
+	}
+
+	if req.Message == "" {
+		logWarn(r.Context(), "RCON announce handler: message is required")
+		writeError(w, r, ErrInvalidRequest, "message is required")
+		return
+	}
+
+	if req.SteamID != "" && !checkIDs(w, r, "RCON announce", req.SteamID) {
+		return
+	}
+
+	var response string
+	var err error
+	if req.SteamID != "" {
+		logInfo(r.Context(), "RCON announce handler sending direct message to %s", req.SteamID)
+		response, err = rcon.DirectMessage(req.SteamID, req.Message)
+	} else {
+		logInfo(r.Context(), "RCON announce handler sending announcement")
+		response, err = rcon.Announce(req.Message)
+	}
+	beginAudit(r, "rcon-announce", req.SteamID, "").details("message=%s", req.Message).finish(err == nil, errString(err))
+	writeRCONResponse(w, r, "RCON announce", response, err)
+}
+
+func rconSaveHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rcon, _, ok := parseRCONRequest(w, r, "RCON save")
+	if !ok {
+		return
+	}
+
+	logInfo(r.Context(), "RCON save handler requesting world save")
+	response, err := rcon.Save()
+	beginAudit(r, "rcon-save", "", "").finish(err == nil, errString(err))
+	writeRCONResponse(w, r, "RCON save", response, err)
+}
+
+func rconCommandHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	rcon, req, ok := parseRCONRequest(w, r, "RCON command")
+	if !ok {
+		return
+	}
+
+	command, exists := rconCommands[strings.ToLower(req.Command)]
+	if !exists {
+		logWarn(r.Context(), "RCON command handler: unknown command %q", req.Command)
+		writeError(w, r, ErrInvalidRequest, "Unknown RCON command")
+		return
+	}
+
+	logInfo(r.Context(), "RCON command handler executing %s", req.Command)
+	response, err := rcon.Execute(command, req.Payload)
+	beginAudit(r, "rcon-command", "", "").details("command=%s payload=%s", req.Command, req.Payload).finish(err == nil, errString(err))
+	writeRCONResponse(w, r, "RCON command", response, err)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testRCONPassword = "secret"
+
+// Локальный RCON сервер: принимает вход по паролю, записывает команды и отвечает через handle
+type fakeRCONServer struct {
+	listener net.Listener
+	handle   func(conn net.Conn, payload string)
+
+	mu       sync.Mutex
+	logins   int
+	commands []string
+}
+
+func newFakeRCONServer(t *testing.T, handle func(conn net.Conn, payload string)) *fakeRCONServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &fakeRCONServer{listener: listener, handle: handle}
+	t.Cleanup(func() { listener.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *fakeRCONServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *fakeRCONServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	buf := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil || n < 2 {
+			return
+		}
+
+		if buf[0] == rconLogin {
+			s.mu.Lock()
+			s.logins++
+			s.mu.Unlock()
+			if strings.TrimRight(string(buf[1:n]), "\x00") != testRCONPassword {
+				conn.Write([]byte("Incorrect password\x00"))
+				return
+			}
+			conn.Write([]byte("Password Accepted\x00"))
+			continue
+		}
+
+		payload := strings.TrimRight(string(buf[2:n]), "\x00")
+		s.mu.Lock()
+		s.commands = append(s.commands, payload)
+		s.mu.Unlock()
+		if s.handle != nil {
+			s.handle(conn, payload)
+		}
+	}
+}
+
+func (s *fakeRCONServer) counts() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins, len(s.commands)
+}
+
+func (s *fakeRCONServer) client(t *testing.T, password string) *RCONClient {
+	t.Helper()
+	addr := s.listener.Addr().(*net.TCPAddr)
+	c := NewRCONClient("127.0.0.1", addr.Port, password, 300*time.Millisecond)
+	t.Cleanup(c.Close)
+	return c
+}
+
+func replyOK(conn net.Conn, payload string) {
+	conn.Write([]byte("OK\x00"))
+}
+
+func TestRCONLoginRejected(t *testing.T) {
+	server := newFakeRCONServer(t, replyOK)
+
+	if _, err := server.client(t, "wrong").Save(); err == nil || !strings.Contains(err.Error(), "rejected") {
+		t.Fatalf("Save with wrong password error = %v, want login rejected", err)
+	}
+	if _, commands := server.counts(); commands != 0 {
+		t.Fatalf("commands after rejected login = %d, want 0", commands)
+	}
+}
+
+func TestRCONMultiPacketReply(t *testing.T) {
+	// Ответ приходит несколькими кусками с паузой меньше rconReadIdle
+	server := newFakeRCONServer(t, func(conn net.Conn, payload string) {
+		conn.Write([]byte("PlayerList\n76561198000000001,765611980"))
+		time.Sleep(rconReadIdle / 4)
+		conn.Write([]byte("00000002,\nRex,Trike,\n\x00"))
+	})
+
+	players, err := server.client(t, testRCONPassword).Players()
+	if err != nil {
+		t.Fatalf("Players: %v", err)
+	}
+	want := []RCONPlayer{{SteamID: "76561198000000001", Name: "Rex"}, {SteamID: "76561198000000002", Name: "Trike"}}
+	if len(players) != len(want) || players[0] != want[0] || players[1] != want[1] {
+		t.Fatalf("Players = %+v, want %+v", players, want)
+	}
+}
+
+func TestRCONCommandWithoutReply(t *testing.T) {
+	server := newFakeRCONServer(t, nil)
+
+	if _, err := server.client(t, testRCONPassword).Save(); err == nil {
+		t.Fatal("Save without reply succeeded, want timeout error")
+	}
+	// Команда дошла до сервера, повторять её нельзя
+	if logins, commands := server.counts(); logins != 1 || commands != 1 {
+		t.Fatalf("logins, commands = %d, %d, want 1, 1", logins, commands)
+	}
+}
+
+func TestRCONRetryOnlyWhenWriteFails(t *testing.T) {
+	var drop atomic.Bool
+	server := newFakeRCONServer(t, func(conn net.Conn, payload string) {
+		if drop.Load() {
+			conn.Close()
+			return
+		}
+		replyOK(conn, payload)
+	})
+	c := server.client(t, testRCONPassword)
+
+	if _, err := c.Save(); err != nil {
+		t.Fatalf("first Save: %v", err)
+	}
+
+	// Запись в закрытое соединение не удаётся: команда повторяется на новом соединении
+	c.conn.Close()
+	if response, err := c.Save(); err != nil || response != "OK" {
+		t.Fatalf("Save after failed write = %q, %v, want OK", response, err)
+	}
+	if logins, commands := server.counts(); logins != 2 || commands != 2 {
+		t.Fatalf("logins, commands after failed write = %d, %d, want 2, 2", logins, commands)
+	}
+
+	// Сервер принял команду и оборвал соединение: повтора нет
+	drop.Store(true)
+	if _, err := c.Kick(testSteamID, "test"); err == nil {
+		t.Fatal("Kick on dropped connection succeeded, want error")
+	}
+	if logins, commands := server.counts(); logins != 2 || commands != 3 {
+		t.Fatalf("logins, commands after dropped connection = %d, %d, want 2, 3", logins, commands)
+	}
+}
+
+func TestRCONKickRejectsInvalidSteamID(t *testing.T) {
+	server := newFakeRCONServer(t, replyOK)
+	srv := &gameServer{ServerProfile: ServerProfile{Name: "test"}, rcon: server.client(t, testRCONPassword)}
+
+	req := httptest.NewRequest("POST", "/rcon/kick", strings.NewReader(`{"steamid":"76561198000000001,extra","reason":"test"}`))
+	req = req.WithContext(withServer(context.Background(), srv))
+	recorder := httptest.NewRecorder()
+	rconKickHandler(recorder, req)
+
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), string(ErrInvalidID)) {
+		t.Fatalf("kick with comma in steamid = %d %s, want 400 %s", recorder.Code, recorder.Body.String(), ErrInvalidID)
+	}
+	if _, commands := server.counts(); commands != 0 {
+		t.Fatalf("commands sent = %d, want 0", commands)
+	}
+}
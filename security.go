@@ -0,0 +1,120 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Защита изменяющих запросов: строгий режим методов, CSRF для браузеров и учёт устаревших GET-мутаций
+
+func isSafeMethod(method string) bool {
+	return method == "GET" || method == "HEAD" || method == "OPTIONS"
+}
+
+func trustedOrigin(origin string) bool {
+	for _, trusted := range config.Security.TrustedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(trusted, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Браузер сам выставляет Sec-Fetch-Site и Origin; запросы без них (curl, сервисы) проверку проходят
+func crossOriginError(r *http.Request) string {
+	origin := r.Header.Get("Origin")
+	if origin != "" && (trustedOrigin(origin) || corsOriginListed(origin)) {
+		return ""
+	}
+
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+	default:
+		return "Cross-site request blocked"
+	}
+
+	if origin == "" {
+		return ""
+	}
+
+	// Origin "null" (sandbox, file://) не содержит хоста и тоже отклоняется
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Host == "" || !strings.EqualFold(parsed.Host, r.Host) {
+		return "Cross-origin request blocked"
+	}
+	return ""
+}
+
+func jsonContentType(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || mediaType == "application/merge-patch+json"
+}
+
+// csrfProtection проверяет все изменяющие методы; GET-мутации v1 проверяет legacyMutation
+func csrfProtection(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isSafeMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if reason := crossOriginError(r); reason != "" {
+			logWarn(r.Context(), "CSRF: %s %s rejected: %s (origin %q)", r.Method, r.URL.Path, reason, r.Header.Get("Origin"))
+			writeError(w, r, ErrForbidden, reason)
+			return
+		}
+
+		// В строгом режиме тело - только JSON: HTML-форма не может отправить его без CORS preflight
+		if config.Security.StrictMode && r.ContentLength != 0 && !jsonContentType(r) {
+			logWarn(r.Context(), "Strict mode: %s %s rejected: content type %q", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+			writeError(w, r, ErrUnsupportedMediaType, "Request body must be application/json")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// legacyMutation оборачивает v1 обработчики, которые исторически меняют файлы по GET
+func legacyMutation(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			handler(w, r)
+			return
+		}
+
+		query := r.URL.Query()
+		slotID := query.Get("slot_id")
+		if slotID == "" {
+			slotID = query.Get("old_slot_id")
+		}
+		audit := beginAudit(r, "legacy-get-mutation", query.Get("steamid"), slotID).details("path=%s", r.URL.Path)
+
+		if config.Security.StrictMode {
+			logWarn(r.Context(), "Strict mode: GET mutation %s rejected", r.URL.Path)
+			audit.finish(false, "rejected by strict mode")
+			w.Header().Set("Allow", "POST, OPTIONS")
+			writeError(w, r, ErrMethodNotAllowed, "Mutations require POST with a JSON body")
+			return
+		}
+
+		// Ссылку на мутацию можно подсунуть в <img> или превью, поэтому чужие источники отсекаем и здесь
+		if reason := crossOriginError(r); reason != "" {
+			logWarn(r.Context(), "CSRF: GET mutation %s rejected: %s", r.URL.Path, reason)
+			audit.finish(false, reason)
+			writeError(w, r, ErrForbidden, reason)
+			return
+		}
+
+		logWarn(r.Context(), "Deprecated GET mutation used: %s", r.URL.Path)
+		audit.finish(true, "")
+		w.Header().Set("Deprecation", "true")
+		w.Header().Add("Warning", `299 - "GET mutations are deprecated, use POST with a JSON body"`)
+		handler(w, r)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"DinoAgentApi/api"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Профили серверов: на одном хосте может работать несколько инстансов Evrima, у каждого свои
+// каталоги Players и Slots, свой RCON и своя проверка онлайна. Профиль выбирается параметром server
+// и доходит до операций через контекст; бэкапы, история, задачи и аудит общие для всех профилей.
+
+type (
+	ServerInfo         = api.ServerInfo
+	ServerListResponse = api.ServerListResponse
+)
+
+const defaultServerName = "default"
+
+type gameServer struct {
+	ServerProfile
+
+	// Клиент RCON, nil если у профиля RCON не настроен
+	rcon     *RCONClient
+	presence PresenceProvider
+
+	rconHealth rconHealthCache
+}
+
+var (
+	defaultServer = &gameServer{
+		ServerProfile: ServerProfile{Name: defaultServerName, PlayersDir: defaultPlayersDir, SlotsDir: defaultSlotsDir},
+		presence:      noPresence{},
+	}
+
+	// Порядок профилей как в конфиге
+	gameServers = []*gameServer{defaultServer}
+)
+
+func sameDir(a, b string) bool {
+	return strings.EqualFold(filepath.Clean(a), filepath.Clean(b))
+}
+
+func setupServers(ctx context.Context) error {
+	profiles := config.Servers
+	if len(profiles) == 0 {
+		// Без профилей агент работает как раньше: один сервер с каталогами по умолчанию и общим RCON
+		profiles = []ServerProfile{{Name: defaultServerName, PlayersDir: defaultPlayersDir, SlotsDir: defaultSlotsDir, RCON: config.RCON}}
+	}
+
+	servers := make([]*gameServer, 0, len(profiles))
+	for _, profile := range profiles {
+		if !validID(profile.Name) {
+			return fmt.Errorf("invalid server name %q", profile.Name)
+		}
+		if profile.PlayersDir == "" || profile.SlotsDir == "" {
+			return fmt.Errorf("server %s: players_dir and slots_dir are required", profile.Name)
+		}
+		for _, other := range servers {
+			if other.Name == profile.Name {
+				return fmt.Errorf("duplicate server name %s", profile.Name)
+			}
+			// Иначе путь файла нельзя однозначно отнести к одному серверу
+			if sameDir(other.PlayersDir, profile.PlayersDir) || sameDir(other.SlotsDir, profile.SlotsDir) {
+				return fmt.Errorf("servers %s and %s share a save directory", other.Name, profile.Name)
+			}
+		}
+
+		// Порт и таймаут, не заданные в профиле, берутся из общего блока rcon
+		if profile.RCON.Port == 0 {
+			profile.RCON.Port = config.RCON.Port
+		}
+		if profile.RCON.TimeoutSeconds == 0 {
+			profile.RCON.TimeoutSeconds = config.RCON.TimeoutSeconds
+		}
+
+		srv := &gameServer{ServerProfile: profile}
+		if profile.RCON.Host != "" {
+			srv.rcon = NewRCONClient(profile.RCON.Host, profile.RCON.Port, profile.RCON.Password,
+				time.Duration(profile.RCON.TimeoutSeconds)*time.Second)
+			logInfo(ctx, "Server %s: RCON configured for %s:%d", profile.Name, profile.RCON.Host, profile.RCON.Port)
+		}
+		srv.presence = newPresence(ctx, srv)
+		servers = append(servers, srv)
+	}
+
+	name := config.DefaultServer
+	if name == "" {
+		name = servers[0].Name
+	}
+	var selected *gameServer
+	for _, srv := range servers {
+		if srv.Name == name {
+			selected = srv
+		}
+	}
+	if selected == nil {
+		return fmt.Errorf("default_server %s is not a configured server", name)
+	}
+
+	gameServers = servers
+	defaultServer = selected
+	logInfo(ctx, "Configured %d server profile(s), default: %s", len(servers), defaultServer.Name)
+	return nil
+}
+
+func closeServers() {
+	for _, srv := range gameServers {
+		if srv.rcon != nil {
+			srv.rcon.Close()
+		}
+	}
+}
+
+func lookupServer(name string) (*gameServer, bool) {
+	if name == "" {
+		return defaultServer, true
+	}
+	for _, srv := range gameServers {
+		if srv.Name == name {
+			return srv, true
+		}
+	}
+	return nil, false
+}
+
+type serverKey struct{}
+
+func withServer(ctx context.Context, srv *gameServer) context.Context {
+	ctx = context.WithValue(ctx, serverKey{}, srv)
+	return withLogAttrs(ctx, slog.String("server", srv.Name))
+}
+
+func serverFrom(ctx context.Context) *gameServer {
+	if srv, ok := ctx.Value(serverKey{}).(*gameServer); ok {
+		return srv
+	}
+	return defaultServer
+}
+
+// Параметр server принимает любой маршрут; без него операции идут на сервер по умолчанию
+func serverSelection(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("server")
+		if name == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		srv, ok := lookupServer(name)
+		if !ok {
+			logWarn(r.Context(), "Unknown server requested: %q", name)
+			writeError(w, r, ErrNotFound, "Unknown server: "+name)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withServer(r.Context(), srv)))
+	})
+}
+
+// Поле server из JSON тела v1 запроса имеет приоритет над параметром в query;
+// nil означает, что ответ с ошибкой уже отправлен
+func requestServer(w http.ResponseWriter, r *http.Request, name, handler string) *http.Request {
+	if name == "" {
+		return r
+	}
+
+	srv, ok := lookupServer(name)
+	if !ok {
+		logWarn(r.Context(), "%s handler: unknown server %q", handler, name)
+		writeError(w, r, ErrNotFound, "Unknown server: "+name)
+		return nil
+	}
+	return r.WithContext(withServer(r.Context(), srv))
+}
+
+func playerFilePath(ctx context.Context, steamid string) string {
+	return filepath.Join(serverFrom(ctx).PlayersDir, steamid+".json")
+}
+
+func playerSlotsDir(ctx context.Context, steamid string) string {
+	return filepath.Join(serverFrom(ctx).SlotsDir, steamid)
+}
+
+func slotFilePath(ctx context.Context, steamid, slotID string) string {
+	return filepath.Join(playerSlotsDir(ctx, steamid), slotID+".json")
+}
+
+// Файл из каталогов профиля относится к его серверу: возвращает сервер и SteamID владельца
+func serverForPath(filePath string) (*gameServer, string) {
+	cleanPath := filepath.Clean(filePath)
+	if filepath.Ext(cleanPath) != ".json" {
+		return nil, ""
+	}
+
+	dir := filepath.Dir(cleanPath)
+	for _, srv := range gameServers {
+		if sameDir(dir, srv.PlayersDir) {
+			return srv, strings.TrimSuffix(filepath.Base(cleanPath), ".json")
+		}
+		if sameDir(filepath.Dir(dir), srv.SlotsDir) {
+			return srv, filepath.Base(dir)
+		}
+	}
+	return nil, ""
+}
+
+func listServers() []ServerInfo {
+	servers := make([]ServerInfo, 0, len(gameServers))
+	for _, srv := range gameServers {
+		servers = append(servers, ServerInfo{
+			Name:       srv.Name,
+			PlayersDir: srv.PlayersDir,
+			SlotsDir:   srv.SlotsDir,
+			RCON:       srv.rcon != nil,
+			Default:    srv == defaultServer,
+		})
+	}
+	return servers
+}
+
+func v2ListServersHandler(w http.ResponseWriter, r *http.Request) {
+	logInfo(r.Context(), "List servers handler processing request")
+	writeResponse(w, r, ServerListResponse{Success: true, Servers: listServers()})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Закрывается при остановке сервера: долгоживущие SSE и WebSocket соединения
+// не учитываются http.Server.Shutdown и должны завершиться сами
+var shuttingDown = make(chan struct{})
+
+// Запросы WebSocket выполняются после Hijack, поэтому Shutdown их не ждёт
+var wsRequests sync.WaitGroup
+
+func waitWithContext(ctx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func shutdownAgent(server *http.Server) {
+	timeout := time.Duration(config.ShutdownTimeoutSeconds) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	logInfo(ctx, "Shutting down, waiting up to %s for in-flight operations", timeout)
+
+	// Сначала перестаём принимать запросы и ждём активные обработчики
+	if err := server.Shutdown(ctx); err != nil {
+		logWarn(ctx, "HTTP server shutdown did not complete: %v", err)
+	}
+	if !waitWithContext(ctx, &wsRequests) {
+		logWarn(ctx, "WebSocket operations still running after shutdown timeout")
+	}
+
+	// Затем фоновые задачи и доставку вебхуков, которые они могли породить
+	jobs.Shutdown(ctx)
+	webhooks.Shutdown(ctx)
+
+	closeServers()
+	auditLog.Close()
+
+	logInfo(context.Background(), "Agent stopped")
+}
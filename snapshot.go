@@ -0,0 +1,214 @@
+package main
+
+import (
+	"DinoAgentApi/api"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	SnapshotRequest = api.SnapshotRequest
+	SnapshotResult  = api.SnapshotResult
+)
+
+type ScanResult struct {
+	Players          int      `json:"players"`
+	PlayerBytes      int64    `json:"player_bytes"`
+	SlotOwners       int      `json:"slot_owners"`
+	Slots            int      `json:"slots"`
+	SlotBytes        int64    `json:"slot_bytes"`
+	InvalidFiles     []string `json:"invalid_files"`
+	OrphanSlotOwners []string `json:"orphan_slot_owners"`
+}
+
+type snapshotFile struct {
+	source string
+	target string
+	player bool
+}
+
+func listSnapshotFiles(srv *gameServer, targetDir string) ([]snapshotFile, error) {
+	var files []snapshotFile
+	playersDir, slotsDir := srv.PlayersDir, srv.SlotsDir
+
+	playerEntries, err := os.ReadDir(playersDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read players directory: %v", err)
+	}
+	for _, entry := range playerEntries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		files = append(files, snapshotFile{
+			source: filepath.Join(playersDir, entry.Name()),
+			target: filepath.Join(targetDir, "Players", entry.Name()),
+			player: true,
+		})
+	}
+
+	err = filepath.WalkDir(slotsDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == slotsDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			return nil
+		}
+		relPath, err := filepath.Rel(slotsDir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, snapshotFile{
+			source: path,
+			target: filepath.Join(targetDir, "Slots", relPath),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk slots directory: %v", err)
+	}
+
+	return files, nil
+}
+
+func copyFile(source, target string) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, err
+	}
+
+	sourceFile, err := os.Open(source)
+	if err != nil {
+		return 0, err
+	}
+	defer sourceFile.Close()
+
+	targetFile, err := os.Create(target)
+	if err != nil {
+		return 0, err
+	}
+
+	// Ошибка Close означает, что копия могла остаться неполной
+	copied, err := io.Copy(targetFile, sourceFile)
+	if closeErr := targetFile.Close(); err == nil {
+		err = closeErr
+	}
+	return copied, err
+}
+
+func createSnapshot(ctx context.Context, label string, progress func(done, total int, message string)) (SnapshotResult, error) {
+	name := time.Now().Format("20060102_150405")
+	if label != "" {
+		// Метка попадает в имя каталога - оставляем только безопасные символы
+		label = strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+				return r
+			}
+			return '_'
+		}, label)
+		name = name + "_" + label
+	}
+	// Снимки разных серверов не смешиваются
+	srv := serverFrom(ctx)
+	targetDir := filepath.Join(backupDir, "snapshots", srv.Name, name)
+	logInfo(ctx, "Creating snapshot of server %s in %s", srv.Name, targetDir)
+
+	result := SnapshotResult{Path: targetDir}
+
+	files, err := listSnapshotFiles(srv, targetDir)
+	if err != nil {
+		return result, err
+	}
+
+	for i, file := range files {
+		if err := ctx.Err(); err != nil {
+			logInfo(ctx, "Snapshot %s canceled after %d of %d files", targetDir, i, len(files))
+			return result, err
+		}
+
+		written, err := copyFile(file.source, file.target)
+		if err != nil {
+			return result, fmt.Errorf("failed to copy %s: %v", file.source, err)
+		}
+
+		result.Bytes += written
+		if file.player {
+			result.Players++
+		} else {
+			result.Slots++
+		}
+
+		if progress != nil {
+			progress(i+1, len(files), filepath.Base(file.source))
+		}
+	}
+
+	logInfo(ctx, "Snapshot created: %s, players: %d, slots: %d, size: %d bytes", targetDir, result.Players, result.Slots, result.Bytes)
+	return result, nil
+}
+
+func scanSaveFiles(ctx context.Context, progress func(done, total int, message string)) (ScanResult, error) {
+	srv := serverFrom(ctx)
+	logInfo(ctx, "Scanning save directories of server %s", srv.Name)
+
+	result := ScanResult{
+		InvalidFiles:     []string{},
+		OrphanSlotOwners: []string{},
+	}
+
+	files, err := listSnapshotFiles(srv, "")
+	if err != nil {
+		return result, err
+	}
+
+	owners := make(map[string]bool)
+	players := make(map[string]bool)
+
+	for i, file := range files {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		content, err := os.ReadFile(file.source)
+		if err != nil {
+			return result, fmt.Errorf("failed to read %s: %v", file.source, err)
+		}
+		if !json.Valid(content) {
+			result.InvalidFiles = append(result.InvalidFiles, file.source)
+		}
+
+		if file.player {
+			result.Players++
+			result.PlayerBytes += int64(len(content))
+			players[strings.TrimSuffix(filepath.Base(file.source), ".json")] = true
+		} else {
+			result.Slots++
+			result.SlotBytes += int64(len(content))
+			owners[filepath.Base(filepath.Dir(file.source))] = true
+		}
+
+		if progress != nil {
+			progress(i+1, len(files), filepath.Base(file.source))
+		}
+	}
+
+	result.SlotOwners = len(owners)
+	for steamid := range owners {
+		if !players[steamid] {
+			result.OrphanSlotOwners = append(result.OrphanSlotOwners, steamid)
+		}
+	}
+	sort.Strings(result.OrphanSlotOwners)
+
+	logInfo(ctx, "Scan completed: players=%d, slots=%d, invalid=%d", result.Players, result.Slots, len(result.InvalidFiles))
+	return result, nil
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"DinoAgentApi/client"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Построчный интерфейс для терминала: список игроков, их слоты, просмотр данных динозавра
+// и операции над слотами с подтверждением. Работает только с локальными каталогами.
+
+const tuiPageSize = 20
+
+// Поля сохранения Evrima, которые показываем первыми; остальные выводятся после них по алфавиту
+var dinoPreviewKeys = []string{"CharacterClass", "DNA", "Growth", "Health", "Stamina", "Hunger", "Thirst",
+	"bGender", "Location_Isle_V3", "ProgressionPoints", "slot_id", "datafile"}
+
+const tuiPlayersHelp = `Commands:
+  <number>      open player from the list
+  s <steamid>   open player by SteamID
+  /<text>       filter by SteamID ("/" clears the filter)
+  n, p          next / previous page
+  r             reload the list
+  q             quit
+`
+
+const tuiPlayerHelp = `Commands:
+  v             preview the player file
+  v <slot>      preview a slot
+  t <slot>      save the current dinosaur into a slot (transfer)
+  r <slot>      restore a slot into the player file
+  e <slot>      create an empty slot
+  d <slot>      delete a slot file (a backup is kept)
+  D             delete the player file (a backup is kept)
+  l             reload
+  b             back to the player list
+  q             quit
+`
+
+var errTUIQuit = errors.New("quit")
+
+type tui struct {
+	ctx     context.Context
+	backend *localBackend
+	lines   chan string
+	out     io.Writer
+}
+
+func runTUI(ctx context.Context, backend *localBackend, in io.Reader, out io.Writer) error {
+	t := &tui{ctx: ctx, backend: backend, lines: make(chan string), out: out}
+
+	// Чтение stdin блокируется, поэтому читаем в горутине, чтобы Ctrl+C завершал интерфейс сразу
+	go func() {
+		defer close(t.lines)
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			select {
+			case t.lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	err := t.playersScreen()
+	if errors.Is(err, errTUIQuit) {
+		return nil
+	}
+	return err
+}
+
+func (t *tui) printf(format string, args ...interface{}) {
+	fmt.Fprintf(t.out, format, args...)
+}
+
+func (t *tui) prompt(label string) (string, error) {
+	t.printf("%s> ", label)
+	select {
+	case line, ok := <-t.lines:
+		if !ok {
+			t.printf("\n")
+			return "", errTUIQuit
+		}
+		return strings.TrimSpace(line), nil
+	case <-t.ctx.Done():
+		t.printf("\n")
+		return "", errTUIQuit
+	}
+}
+
+func (t *tui) confirm(question string) (bool, error) {
+	answer, err := t.prompt(question + " [y/N]")
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes", nil
+}
+
+func (t *tui) playersScreen() error {
+	filter := ""
+	page := 0
+
+	for {
+		players, err := listPlayers(t.ctx)
+		if err != nil {
+			return err
+		}
+		if filter != "" {
+			filtered := players[:0]
+			for _, player := range players {
+				if strings.Contains(player.SteamID, filter) {
+					filtered = append(filtered, player)
+				}
+			}
+			players = filtered
+		}
+
+		pages := (len(players) + tuiPageSize - 1) / tuiPageSize
+		if page >= pages {
+			page = max(pages-1, 0)
+		}
+		start := page * tuiPageSize
+		end := min(start+tuiPageSize, len(players))
+
+		srv := serverFrom(t.ctx)
+		t.printf("\nPlayers of server %s in %s", srv.Name, srv.PlayersDir)
+		if filter != "" {
+			t.printf(" matching %q", filter)
+		}
+		t.printf(": %d (page %d/%d)\n", len(players), page+1, max(pages, 1))
+		w := tabwriter.NewWriter(t.out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "#\tSTEAMID\tSIZE\tMODIFIED")
+		for i := start; i < end; i++ {
+			fmt.Fprintf(w, "%d\t%s\t%d\t%s\n", i+1, players[i].SteamID, players[i].Size, formatCLITime(players[i].ModTime))
+		}
+		w.Flush()
+
+		input, err := t.prompt("players (? for help)")
+		if err != nil {
+			return err
+		}
+
+		var index int
+		switch {
+		case input == "":
+		case input == "q":
+			return errTUIQuit
+		case input == "?":
+			t.printf("%s", tuiPlayersHelp)
+		case input == "n":
+			if page+1 < pages {
+				page++
+			}
+		case input == "p":
+			if page > 0 {
+				page--
+			}
+		case input == "r":
+		case strings.HasPrefix(input, "/"):
+			filter = strings.TrimSpace(input[1:])
+			page = 0
+		case strings.HasPrefix(input, "s "):
+			steamid := strings.TrimSpace(input[2:])
+			if !validID(steamid) {
+				t.printf("Invalid SteamID %q\n", steamid)
+				continue
+			}
+			if err := t.playerScreen(steamid); err != nil {
+				return err
+			}
+		case scanIndex(input, &index) && index >= 1 && index <= len(players):
+			if err := t.playerScreen(players[index-1].SteamID); err != nil {
+				return err
+			}
+		default:
+			t.printf("Unknown command %q, ? for help\n", input)
+		}
+	}
+}
+
+func scanIndex(input string, index *int) bool {
+	_, err := fmt.Sscanf(input, "%d", index)
+	return err == nil && fmt.Sprint(*index) == input
+}
+
+// Возвращает nil при возврате к списку игроков и errTUIQuit при выходе
+func (t *tui) playerScreen(steamid string) error {
+	for {
+		check := checkPlayerFile(t.ctx, steamid)
+		t.printf("\nPlayer %s\n", steamid)
+		if check.Exists {
+			t.printf("  player file: %s\n", dinoSummary(getPlayerFileContent(t.ctx, steamid)))
+		} else {
+			t.printf("  player file: none\n")
+		}
+
+		slots, err := listPlayerSlots(t.ctx, steamid)
+		if err != nil {
+			t.printf("  failed to list slots: %v\n", err)
+		} else if len(slots) == 0 {
+			t.printf("  no slots\n")
+		} else {
+			w := tabwriter.NewWriter(t.out, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "  SLOT\tSIZE\tMODIFIED\tDINOSAUR")
+			for _, slot := range slots {
+				summary := dinoSummary(getSlotFileContent(t.ctx, steamid, slot.SlotID))
+				fmt.Fprintf(w, "  %s\t%d\t%s\t%s\n", slot.SlotID, slot.Size, formatCLITime(slot.ModTime), summary)
+			}
+			w.Flush()
+		}
+
+		input, err := t.prompt(steamid + " (? for help)")
+		if err != nil {
+			return err
+		}
+		command, arg, _ := strings.Cut(input, " ")
+		arg = strings.TrimSpace(arg)
+
+		switch command {
+		case "":
+		case "q":
+			return errTUIQuit
+		case "b":
+			return nil
+		case "?":
+			t.printf("%s", tuiPlayerHelp)
+		case "l":
+		case "v":
+			if arg == "" {
+				t.preview("Player file", getPlayerFileContent(t.ctx, steamid))
+			} else if t.slotArg(arg) {
+				t.preview("Slot "+arg, getSlotFileContent(t.ctx, steamid, arg))
+			}
+		case "t":
+			if !t.slotArg(arg) {
+				continue
+			}
+			if err := t.run(fmt.Sprintf("Save the current dinosaur of %s into slot %s? The player file will be removed.", steamid, arg), true,
+				func(force bool) (string, error) {
+					resp, err := t.backend.Transfer(t.ctx, steamid, arg, force)
+					if err != nil {
+						return "", err
+					}
+					return resp.Message, nil
+				}); err != nil {
+				return err
+			}
+		case "r":
+			if !t.slotArg(arg) {
+				continue
+			}
+			if err := t.run(fmt.Sprintf("Restore slot %s into the player file of %s?", arg, steamid), true,
+				func(force bool) (string, error) {
+					resp, err := t.backend.RestoreSlot(t.ctx, steamid, arg, force)
+					if err != nil {
+						return "", err
+					}
+					return resp.Message, nil
+				}); err != nil {
+				return err
+			}
+		case "e":
+			if !t.slotArg(arg) {
+				continue
+			}
+			if err := t.run(fmt.Sprintf("Create an empty slot %s for %s? An existing slot %s will be overwritten.", arg, steamid, arg), false,
+				func(bool) (string, error) {
+					resp, err := t.backend.EmptySlot(t.ctx, steamid, arg)
+					if err != nil {
+						return "", err
+					}
+					return resp.Message, nil
+				}); err != nil {
+				return err
+			}
+		case "d":
+			if !t.slotArg(arg) {
+				continue
+			}
+			if err := t.run(fmt.Sprintf("Delete slot %s of %s?", arg, steamid), false,
+				func(bool) (string, error) {
+					resp, err := t.backend.DeleteSlotFile(t.ctx, steamid, arg)
+					if err != nil {
+						return "", err
+					}
+					return resp.Message, nil
+				}); err != nil {
+				return err
+			}
+		case "D":
+			if err := t.run(fmt.Sprintf("Delete the player file of %s?", steamid), true,
+				func(force bool) (string, error) {
+					resp, err := t.backend.DeletePlayerFile(t.ctx, steamid, force)
+					if err != nil {
+						return "", err
+					}
+					return resp.Message, nil
+				}); err != nil {
+				return err
+			}
+		default:
+			t.printf("Unknown command %q, ? for help\n", input)
+		}
+	}
+}
+
+func (t *tui) slotArg(slotID string) bool {
+	if slotID == "" {
+		t.printf("Slot is required\n")
+		return false
+	}
+	if !validID(slotID) {
+		t.printf("Invalid slot %q\n", slotID)
+		return false
+	}
+	return true
+}
+
+// run спрашивает подтверждение и выполняет операцию; если игрок онлайн, предлагает повторить с force
+func (t *tui) run(question string, presence bool, operation func(force bool) (string, error)) error {
+	ok, err := t.confirm(question)
+	if err != nil || !ok {
+		return err
+	}
+
+	message, opErr := operation(false)
+	if presence && (client.IsCode(opErr, ErrLocked) || client.IsCode(opErr, ErrUnavailable)) {
+		t.printf("%v\n", opErr)
+		ok, err := t.confirm("Run anyway? The game may overwrite the change.")
+		if err != nil || !ok {
+			return err
+		}
+		message, opErr = operation(true)
+	}
+
+	if opErr != nil {
+		t.printf("Failed: %v\n", opErr)
+		return nil
+	}
+	t.printf("%s\n", message)
+	return nil
+}
+
+func (t *tui) preview(title string, content FileContentResponse) {
+	if !content.Success {
+		t.printf("%s: %s\n", title, content.Error)
+		return
+	}
+	t.printf("\n%s:\n", title)
+	w := tabwriter.NewWriter(t.out, 0, 0, 2, ' ', 0)
+	for _, line := range previewDinoData(content.Content) {
+		fmt.Fprintf(w, "  %s\n", line)
+	}
+	w.Flush()
+}
+
+func previewDinoData(content json.RawMessage) []string {
+	value, err := decodeDiffJSON(content)
+	if err != nil {
+		return []string{"invalid JSON: " + err.Error()}
+	}
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return []string{previewValue(value)}
+	}
+
+	var lines []string
+	shown := map[string]bool{}
+	for _, key := range dinoPreviewKeys {
+		if fieldValue, exists := object[key]; exists {
+			lines = append(lines, key+":\t"+previewValue(fieldValue))
+			shown[key] = true
+		}
+	}
+
+	var rest []string
+	for key := range object {
+		if !shown[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	for _, key := range rest {
+		lines = append(lines, key+":\t"+previewValue(object[key]))
+	}
+	return lines
+}
+
+func previewValue(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return fmt.Sprintf("{%d field(s)}", len(typed))
+	case []interface{}:
+		return fmt.Sprintf("[%d item(s)]", len(typed))
+	case string:
+		if len(typed) > 60 {
+			typed = typed[:57] + "..."
+		}
+		return fmt.Sprintf("%q", typed)
+	default:
+		return fmt.Sprint(typed)
+	}
+}
+
+// Одна строка для таблицы слотов: класс и рост, если они есть в сохранении
+func dinoSummary(content FileContentResponse) string {
+	if !content.Success {
+		return content.Error
+	}
+	value, err := decodeDiffJSON(content.Content)
+	if err != nil {
+		return "invalid JSON"
+	}
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return previewValue(value)
+	}
+	if datafile, exists := object["datafile"]; exists && datafile == nil && len(object) <= 2 {
+		return "empty slot"
+	}
+
+	var parts []string
+	for _, key := range []string{"CharacterClass", "Growth"} {
+		if fieldValue, exists := object[key]; exists {
+			parts = append(parts, key+"="+previewValue(fieldValue))
+		}
+	}
+	if len(parts) == 0 {
+		return previewValue(object)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// Веб-панель администратора: статические файлы из assets/ui, все данные страница берёт из API агента
+
+//go:embed assets/ui
+var uiAssets embed.FS
+
+func uiPath(path string) (string, error) {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	// Корень перехватил бы все неизвестные маршруты, включая ошибки API
+	if path == "/" {
+		return "", fmt.Errorf("ui path must not be the root")
+	}
+	for _, route := range registeredRoutes {
+		pattern := route
+		if _, rest, found := strings.Cut(route, " "); found {
+			pattern = rest
+		}
+		if strings.HasPrefix(pattern, path) {
+			return "", fmt.Errorf("ui path %s overlaps API route %s", path, route)
+		}
+	}
+	return path, nil
+}
+
+// Путь задаётся в конфиге, поэтому маршрут регистрируется после его загрузки
+func registerUIRoutes(ctx context.Context) error {
+	if !config.UI.Enabled {
+		logInfo(ctx, "Web UI disabled")
+		return nil
+	}
+
+	path, err := uiPath(config.UI.Path)
+	if err != nil {
+		return err
+	}
+	files, err := fs.Sub(uiAssets, "assets/ui")
+	if err != nil {
+		return err
+	}
+
+	fileServer := http.StripPrefix(path, http.FileServer(http.FS(files)))
+	http.Handle(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("Cache-Control", "no-cache")
+		fileServer.ServeHTTP(w, r)
+	}))
+	// Без завершающего слэша относительные ссылки страницы указывали бы мимо панели
+	http.Handle(strings.TrimSuffix(path, "/"), http.RedirectHandler(path, http.StatusMovedPermanently))
+
+	logInfo(ctx, "Web UI available at %s", path)
+	return nil
+}
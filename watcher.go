@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type FileEvent struct {
+	ID      int64     `json:"id"`
+	Type    string    `json:"type"`
+	Server  string    `json:"server,omitempty"`
+	Kind    string    `json:"kind"`
+	SteamID string    `json:"steamid"`
+	SlotID  string    `json:"slot_id,omitempty"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+const (
+	fileCreated  = "created"
+	fileModified = "modified"
+	fileDeleted  = "deleted"
+)
+
+const (
+	watchInterval       = 2 * time.Second
+	eventHeartbeat      = 15 * time.Second
+	subscriberQueueSize = 64
+)
+
+type watchedFile struct {
+	server  string
+	kind    string
+	steamid string
+	slotID  string
+	size    int64
+	modTime time.Time
+}
+
+type fileWatcher struct {
+	mu          sync.Mutex
+	subscribers map[chan FileEvent]struct{}
+	lastID      int64
+}
+
+var watcher = &fileWatcher{subscribers: make(map[chan FileEvent]struct{})}
+
+func scanWatchedFiles() map[string]watchedFile {
+	files := make(map[string]watchedFile)
+	for _, srv := range gameServers {
+		scanServerFiles(srv, files)
+	}
+	return files
+}
+
+func scanServerFiles(srv *gameServer, files map[string]watchedFile) {
+	entries, err := os.ReadDir(srv.PlayersDir)
+	if err != nil && !os.IsNotExist(err) {
+		logError(context.Background(), "Watcher: failed to read players directory of server %s: %v", srv.Name, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files[filepath.Join(srv.PlayersDir, entry.Name())] = watchedFile{
+			server:  srv.Name,
+			kind:    "player",
+			steamid: strings.TrimSuffix(entry.Name(), ".json"),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		}
+	}
+
+	owners, err := os.ReadDir(srv.SlotsDir)
+	if err != nil && !os.IsNotExist(err) {
+		logError(context.Background(), "Watcher: failed to read slots directory of server %s: %v", srv.Name, err)
+	}
+	for _, owner := range owners {
+		if !owner.IsDir() {
+			continue
+		}
+		ownerDir := filepath.Join(srv.SlotsDir, owner.Name())
+		slots, err := os.ReadDir(ownerDir)
+		if err != nil {
+			continue
+		}
+		for _, slot := range slots {
+			if slot.IsDir() || filepath.Ext(slot.Name()) != ".json" {
+				continue
+			}
+			info, err := slot.Info()
+			if err != nil {
+				continue
+			}
+			files[filepath.Join(ownerDir, slot.Name())] = watchedFile{
+				server:  srv.Name,
+				kind:    "slot",
+				steamid: owner.Name(),
+				slotID:  strings.TrimSuffix(slot.Name(), ".json"),
+				size:    info.Size(),
+				modTime: info.ModTime(),
+			}
+		}
+	}
+}
+
+func (fw *fileWatcher) Run(ctx context.Context) {
+	// Первый проход только запоминает состояние, без событий
+	state := scanWatchedFiles()
+	logInfo(ctx, "Watcher started, tracking %d files, interval: %s", len(state), watchInterval)
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logInfo(ctx, "Watcher stopped")
+			return
+		case <-ticker.C:
+		}
+
+		current := scanWatchedFiles()
+
+		for path, file := range current {
+			previous, existed := state[path]
+			switch {
+			case !existed:
+				fw.publish(fileCreated, path, file)
+			case previous.size != file.size || !previous.modTime.Equal(file.modTime):
+				fw.publish(fileModified, path, file)
+			}
+		}
+		for path, file := range state {
+			if _, exists := current[path]; !exists {
+				file.size = 0
+				fw.publish(fileDeleted, path, file)
+			}
+		}
+
+		state = current
+	}
+}
+
+func (fw *fileWatcher) publish(eventType, path string, file watchedFile) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	fw.lastID++
+	event := FileEvent{
+		ID:      fw.lastID,
+		Type:    eventType,
+		Server:  file.server,
+		Kind:    file.kind,
+		SteamID: file.steamid,
+		SlotID:  file.slotID,
+		Path:    path,
+		Size:    file.size,
+		Time:    time.Now(),
+	}
+
+	for ch := range fw.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Медленный клиент не должен тормозить остальных
+			logWarn(context.Background(), "Watcher: subscriber queue full, dropping event %d", event.ID)
+		}
+	}
+}
+
+func (fw *fileWatcher) Subscribe() (chan FileEvent, func()) {
+	ch := make(chan FileEvent, subscriberQueueSize)
+
+	fw.mu.Lock()
+	fw.subscribers[ch] = struct{}{}
+	fw.mu.Unlock()
+
+	return ch, func() {
+		fw.mu.Lock()
+		delete(fw.subscribers, ch)
+		fw.mu.Unlock()
+	}
+}
+
+func eventMatches(event FileEvent, server, steamid, kind string) bool {
+	if server != "" && event.Server != server {
+		return false
+	}
+	if steamid != "" && event.SteamID != steamid {
+		return false
+	}
+	if kind != "" && event.Kind != kind {
+		return false
+	}
+	return true
+}
+
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		logWarn(r.Context(), "Events handler: method not allowed: %s", r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		logError(r.Context(), "Events handler: streaming not supported")
+		writeError(w, r, ErrInternal, "Streaming not supported")
+		return
+	}
+
+	// Без параметра server поток содержит события всех серверов
+	server := r.URL.Query().Get("server")
+	steamid := r.URL.Query().Get("steamid")
+	kind := r.URL.Query().Get("kind")
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	events, unsubscribe := watcher.Subscribe()
+	defer unsubscribe()
+
+	logInfo(r.Context(), "Events handler: client %s subscribed (server: %q, steamid: %q, kind: %q)", r.RemoteAddr, server, steamid, kind)
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			logInfo(r.Context(), "Events handler: client %s disconnected", r.RemoteAddr)
+			return
+
+		case <-shuttingDown:
+			logInfo(r.Context(), "Events handler: closing stream for %s, agent is shutting down", r.RemoteAddr)
+			return
+
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+
+		case event := <-events:
+			if !eventMatches(event, server, steamid, kind) {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				logError(r.Context(), "Events handler: failed to marshal event: %v", err)
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	Operation string      `json:"operation"`
+	Success   bool        `json:"success"`
+	Timestamp time.Time   `json:"timestamp"`
+	SteamID   string      `json:"steamid,omitempty"`
+	SlotID    string      `json:"slot_id,omitempty"`
+	FilePath  string      `json:"file_path,omitempty"`
+	Server    string      `json:"server,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Test      bool        `json:"test,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+type WebhookDelivery struct {
+	URL        string `json:"url"`
+	Success    bool   `json:"success"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Attempts   int    `json:"attempts"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Тестовое событие уходит только на настроенные адреса: произвольный URL превратил бы агент в прокси
+type WebhookTestRequest struct {
+	Endpoint *int `json:"endpoint,omitempty"`
+}
+
+type WebhookTestResponse struct {
+	Success    bool              `json:"success"`
+	Event      *WebhookEvent     `json:"event,omitempty"`
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	Error      string            `json:"error,omitempty"`
+	ErrorCode  ErrorCode         `json:"error_code,omitempty"`
+}
+
+type deadLetterEntry struct {
+	Event     WebhookEvent `json:"event"`
+	URL       string       `json:"url"`
+	Attempts  int          `json:"attempts"`
+	LastError string       `json:"last_error"`
+	FailedAt  time.Time    `json:"failed_at"`
+}
+
+const (
+	webhookQueueSize     = 1000
+	maxWebhookDeliveries = 8
+	maxWebhookBackoff    = 5 * time.Minute
+)
+
+type webhookDispatcher struct {
+	queue        chan WebhookEvent
+	deliveries   chan struct{}
+	client       *http.Client
+	deadLetterMu sync.Mutex
+
+	ctx     context.Context
+	abort   context.CancelFunc
+	drain   chan struct{}
+	stopped chan struct{}
+	wg      sync.WaitGroup
+}
+
+var webhooks = newWebhookDispatcher()
+
+func newWebhookDispatcher() *webhookDispatcher {
+	ctx, abort := context.WithCancel(context.Background())
+	return &webhookDispatcher{
+		queue:      make(chan WebhookEvent, webhookQueueSize),
+		deliveries: make(chan struct{}, maxWebhookDeliveries),
+		client:     &http.Client{},
+		ctx:        ctx,
+		abort:      abort,
+		drain:      make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+}
+
+func emitWebhook(ctx context.Context, event WebhookEvent) {
+	if len(config.Webhooks.Endpoints) == 0 {
+		return
+	}
+
+	event.ID = newRandomID()
+	event.Server = serverFrom(ctx).Name
+	event.Timestamp = time.Now()
+	if event.Success {
+		event.Event = event.Operation + ".succeeded"
+	} else {
+		event.Event = event.Operation + ".failed"
+	}
+
+	select {
+	case webhooks.queue <- event:
+	default:
+		logWarn(context.Background(), "Webhooks: queue full, dropping event %s (%s)", event.ID, event.Event)
+	}
+}
+
+func webhookWanted(endpoint WebhookEndpoint, event WebhookEvent) bool {
+	if len(endpoint.Events) == 0 {
+		return true
+	}
+	for _, name := range endpoint.Events {
+		if name == "*" || name == event.Operation || name == event.Event {
+			return true
+		}
+	}
+	return false
+}
+
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *webhookDispatcher) dispatch(event WebhookEvent) {
+	for _, endpoint := range config.Webhooks.Endpoints {
+		if !webhookWanted(endpoint, event) {
+			continue
+		}
+
+		// Каждая доставка в своей горутине, чтобы недоступный адрес
+		// с ретраями не задерживал остальные. Все слоты могут быть заняты
+		// доставками в backoff, поэтому ожидание слота прерывается остановкой
+		select {
+		case d.deliveries <- struct{}{}:
+		case <-d.ctx.Done():
+			delivery := WebhookDelivery{URL: endpoint.URL, Error: "delivery aborted by agent shutdown"}
+			webhookDeliveries.Inc("dead_letter")
+			if !event.Test {
+				d.writeDeadLetter(event, endpoint.URL, delivery)
+			}
+			continue
+		}
+		d.wg.Add(1)
+		go func(endpoint WebhookEndpoint, event WebhookEvent) {
+			defer d.wg.Done()
+			defer func() { <-d.deliveries }()
+			d.deliver(endpoint, event, config.Webhooks.MaxAttempts)
+		}(endpoint, event)
+	}
+}
+
+func (d *webhookDispatcher) Start() {
+	go func() {
+		defer close(d.stopped)
+		for {
+			select {
+			case event := <-d.queue:
+				d.dispatch(event)
+			case <-d.drain:
+				// При остановке отправляем всё, что уже в очереди, и выходим
+				for {
+					select {
+					case event := <-d.queue:
+						d.dispatch(event)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+	logInfo(context.Background(), "Webhook dispatcher started, %d endpoints configured", len(config.Webhooks.Endpoints))
+}
+
+func (d *webhookDispatcher) Shutdown(ctx context.Context) {
+	close(d.drain)
+
+	// Разбор очереди тоже ждёт в пределах таймаута: dispatch может стоять на занятых слотах доставки
+	done := make(chan struct{})
+	go func() {
+		<-d.stopped
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logInfo(context.Background(), "Webhooks: all deliveries finished")
+	case <-ctx.Done():
+		logWarn(context.Background(), "Webhooks: shutdown timeout reached, aborting pending deliveries")
+		d.abort()
+		<-done
+	}
+}
+
+func (d *webhookDispatcher) post(endpoint WebhookEndpoint, event WebhookEvent, body []byte, attempt int) (int, error) {
+	req, err := http.NewRequestWithContext(d.ctx, "POST", endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "DinoAgentApi-Webhook")
+	req.Header.Set("X-Dino-Event", event.Event)
+	req.Header.Set("X-Dino-Delivery", event.ID)
+	req.Header.Set("X-Dino-Attempt", strconv.Itoa(attempt))
+	if endpoint.Secret != "" {
+		req.Header.Set("X-Dino-Signature", signWebhook(endpoint.Secret, body))
+	}
+
+	client := *d.client
+	client.Timeout = time.Duration(config.Webhooks.TimeoutSeconds) * time.Second
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *webhookDispatcher) deliver(endpoint WebhookEndpoint, event WebhookEvent, maxAttempts int) WebhookDelivery {
+	delivery := WebhookDelivery{URL: endpoint.URL}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		delivery.Error = fmt.Sprintf("Failed to marshal event: %v", err)
+		logError(context.Background(), "Webhooks: failed to marshal event %s: %v", event.ID, err)
+		return delivery
+	}
+
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	backoff := time.Duration(config.Webhooks.InitialBackoffSeconds) * time.Second
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		delivery.Attempts = attempt
+		statusCode, err := d.post(endpoint, event, body, attempt)
+		delivery.StatusCode = statusCode
+
+		if err == nil {
+			delivery.Success = true
+			delivery.Error = ""
+			webhookDeliveries.Inc("delivered")
+			logInfo(context.Background(), "Webhooks: delivered %s (%s) to %s on attempt %d", event.ID, event.Event, endpoint.URL, attempt)
+			return delivery
+		}
+
+		delivery.Error = err.Error()
+		webhookDeliveries.Inc("failed_attempt")
+		logWarn(context.Background(), "Webhooks: attempt %d/%d to deliver %s to %s failed: %v", attempt, maxAttempts, event.ID, endpoint.URL, err)
+
+		if attempt < maxAttempts {
+			select {
+			case <-time.After(backoff):
+			case <-d.ctx.Done():
+				// Остановка агента: недоставленное событие уходит в dead-letter
+				delivery.Error = "delivery aborted by agent shutdown: " + delivery.Error
+				webhookDeliveries.Inc("dead_letter")
+				if !event.Test {
+					d.writeDeadLetter(event, endpoint.URL, delivery)
+				}
+				return delivery
+			}
+			backoff *= 2
+			if backoff > maxWebhookBackoff {
+				backoff = maxWebhookBackoff
+			}
+		}
+	}
+
+	// Тестовые события не засоряют dead-letter файл
+	webhookDeliveries.Inc("dead_letter")
+	if !event.Test {
+		d.writeDeadLetter(event, endpoint.URL, delivery)
+	}
+	return delivery
+}
+
+func (d *webhookDispatcher) writeDeadLetter(event WebhookEvent, url string, delivery WebhookDelivery) {
+	d.deadLetterMu.Lock()
+	defer d.deadLetterMu.Unlock()
+
+	path := config.Webhooks.DeadLetterFile
+	if path == "" {
+		logWarn(context.Background(), "Webhooks: event %s to %s undeliverable and no dead-letter file configured", event.ID, url)
+		return
+	}
+
+	entry, err := json.Marshal(deadLetterEntry{
+		Event:     event,
+		URL:       url,
+		Attempts:  delivery.Attempts,
+		LastError: delivery.Error,
+		FailedAt:  time.Now(),
+	})
+	if err != nil {
+		logError(context.Background(), "Webhooks: failed to marshal dead-letter entry for %s: %v", event.ID, err)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		logError(context.Background(), "Webhooks: failed to create dead-letter directory: %v", err)
+		return
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		logError(context.Background(), "Webhooks: failed to open dead-letter file %s: %v", path, err)
+		return
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(entry, '\n')); err != nil {
+		logError(context.Background(), "Webhooks: failed to write dead-letter entry: %v", err)
+		return
+	}
+	logWarn(context.Background(), "Webhooks: event %s to %s written to dead-letter file after %d attempts", event.ID, url, delivery.Attempts)
+}
+
+func webhookTestHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Только POST, чтобы запрос проходил проверку CSRF
+	if r.Method != "POST" {
+		logWarn(r.Context(), "Webhook test handler: method not allowed: %s", r.Method)
+		writeError(w, r, ErrMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req WebhookTestRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			logWarn(r.Context(), "Webhook test handler: invalid JSON in POST request: %v", err)
+			writeError(w, r, ErrInvalidJSON, "Invalid JSON")
+			return
+		}
+	}
+
+	endpoints := config.Webhooks.Endpoints
+	if len(endpoints) == 0 {
+		logWarn(r.Context(), "Webhook test handler: no webhook endpoints configured")
+		writeError(w, r, ErrInvalidRequest, "No webhook endpoints configured")
+		return
+	}
+
+	if req.Endpoint != nil {
+		if *req.Endpoint < 0 || *req.Endpoint >= len(endpoints) {
+			logWarn(r.Context(), "Webhook test handler: endpoint index %d out of range", *req.Endpoint)
+			writeError(w, r, ErrInvalidRequest, fmt.Sprintf("Endpoint index must be between 0 and %d", len(endpoints)-1))
+			return
+		}
+		endpoints = endpoints[*req.Endpoint : *req.Endpoint+1]
+	}
+
+	event := WebhookEvent{
+		ID:        newRandomID(),
+		Event:     "test.succeeded",
+		Operation: "test",
+		Success:   true,
+		Timestamp: time.Now(),
+		SteamID:   "76561198000000000",
+		SlotID:    "1",
+		Server:    serverFrom(r.Context()).Name,
+		Test:      true,
+		Data: TransferResponse{
+			Success:    true,
+			Message:    "Sample webhook event",
+			PlayerFile: playerFilePath(r.Context(), "76561198000000000"),
+			SlotFile:   slotFilePath(r.Context(), "76561198000000000", "1"),
+		},
+	}
+
+	logInfo(r.Context(), "Webhook test handler sending sample event %s to %d endpoints", event.ID, len(endpoints))
+
+	// Одна попытка на адрес, чтобы ответ пришёл сразу
+	response := WebhookTestResponse{Success: true, Event: &event}
+	for _, endpoint := range endpoints {
+		delivery := webhooks.deliver(endpoint, event, 1)
+		if !delivery.Success {
+			response.Success = false
+		}
+		response.Deliveries = append(response.Deliveries, delivery)
+	}
+
+	logInfo(r.Context(), "Webhook test handler response: Success=%t, Deliveries=%d", response.Success, len(response.Deliveries))
+	writeResponse(w, r, response)
+}
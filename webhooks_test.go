@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func postWebhookTest(t *testing.T, server *httptest.Server, body string) (*http.Response, WebhookTestResponse) {
+	t.Helper()
+	resp, err := http.Post(server.URL+"/webhooks/test", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /webhooks/test: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result WebhookTestResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return resp, result
+}
+
+func TestWebhookTestConfiguredEndpoints(t *testing.T) {
+	server := newTestAgent(t)
+
+	var received []string
+	receiver := func(name string) *httptest.Server {
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = append(received, name)
+		}))
+		t.Cleanup(s.Close)
+		return s
+	}
+	config.Webhooks.Endpoints = []WebhookEndpoint{{URL: receiver("first").URL}, {URL: receiver("second").URL}}
+
+	_, result := postWebhookTest(t, server, `{"endpoint":1}`)
+	if !result.Success || len(result.Deliveries) != 1 || len(received) != 1 || received[0] != "second" {
+		t.Fatalf("test delivery to endpoint 1 = %+v, received by %v, want only second", result, received)
+	}
+
+	// Адрес из запроса не принимается, событие уходит на все настроенные
+	received = nil
+	_, result = postWebhookTest(t, server, `{"url":"http://127.0.0.1:1/"}`)
+	if len(result.Deliveries) != 2 || len(received) != 2 {
+		t.Fatalf("test delivery with url = %+v, received by %v, want both configured endpoints", result, received)
+	}
+
+	resp, result := postWebhookTest(t, server, `{"endpoint":2}`)
+	if resp.StatusCode != http.StatusBadRequest || result.ErrorCode != ErrInvalidRequest {
+		t.Fatalf("endpoint out of range = %d %+v, want 400 %s", resp.StatusCode, result, ErrInvalidRequest)
+	}
+
+	get, err := http.Get(server.URL + "/webhooks/test?url=http://127.0.0.1:1/")
+	if err != nil {
+		t.Fatalf("GET /webhooks/test: %v", err)
+	}
+	get.Body.Close()
+	if get.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("GET /webhooks/test status = %d, want %d", get.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestWebhookShutdownWhileRetrying(t *testing.T) {
+	var attempts atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(receiver.Close)
+
+	savedConfig := config
+	t.Cleanup(func() { config = savedConfig })
+	config = defaultConfig()
+	deadLetter := filepath.Join(t.TempDir(), "dead_letter.jsonl")
+	config.Webhooks = WebhooksConfig{
+		Endpoints:             []WebhookEndpoint{{URL: receiver.URL}},
+		MaxAttempts:           5,
+		InitialBackoffSeconds: 60,
+		TimeoutSeconds:        5,
+		DeadLetterFile:        deadLetter,
+	}
+
+	d := newWebhookDispatcher()
+	d.Start()
+
+	// Событий больше, чем слотов доставки: все слоты заняты ретраями, и разбор очереди ждёт свободного
+	events := maxWebhookDeliveries + 2
+	for i := 0; i < events; i++ {
+		d.queue <- WebhookEvent{ID: strconv.Itoa(i), Operation: "transfer", Event: "transfer.failed"}
+	}
+	for deadline := time.Now().Add(5 * time.Second); attempts.Load() < maxWebhookDeliveries; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("receiver got %d attempts, want %d deliveries in backoff", attempts.Load(), maxWebhookDeliveries)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		d.Shutdown(ctx)
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown did not return after the timeout")
+	}
+
+	data, err := os.ReadFile(deadLetter)
+	if err != nil {
+		t.Fatalf("read dead-letter file: %v", err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != events {
+		t.Fatalf("dead-letter entries = %d, want %d", lines, events)
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type wsRequest struct {
+	JSONRPC string          `json:"jsonrpc,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type wsError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type wsResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *wsError        `json:"error,omitempty"`
+}
+
+type wsNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type wsSubscribeParams struct {
+	Server  string `json:"server,omitempty"`
+	SteamID string `json:"steamid,omitempty"`
+	Kind    string `json:"kind,omitempty"`
+}
+
+// Коды ошибок из спецификации JSON-RPC 2.0
+const (
+	wsParseError     = -32700
+	wsInvalidRequest = -32600
+	wsMethodNotFound = -32601
+	wsInvalidParams  = -32602
+	wsPlayerOnline   = -32001
+)
+
+const (
+	wsWriteTimeout = 10 * time.Second
+	wsPongTimeout  = 60 * time.Second
+	wsPingInterval = 45 * time.Second
+	wsMaxMessage   = 10 * 1024 * 1024
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	// Браузерное подключение принимаем с того же хоста, доверенных или явно перечисленных в CORS
+	// источников - то же правило, что csrfProtection применяет к POST; "*" сюда не относится
+	CheckOrigin: func(r *http.Request) bool {
+		return r.Header.Get("Origin") == "" || crossOriginError(r) == ""
+	},
+}
+
+type wsConn struct {
+	conn    *websocket.Conn
+	ctx     context.Context
+	actor   AuditActor
+	writeMu sync.Mutex
+
+	filterMu   sync.Mutex
+	subscribed bool
+	filter     wsSubscribeParams
+}
+
+func (c *wsConn) send(message interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return c.conn.WriteJSON(message)
+}
+
+func (c *wsConn) reply(id json.RawMessage, result interface{}) {
+	if err := c.send(wsResponse{JSONRPC: "2.0", ID: id, Result: result}); err != nil {
+		logWarn(c.ctx, "WebSocket: failed to send response: %v", err)
+	}
+}
+
+func (c *wsConn) replyError(id json.RawMessage, code int, message string) {
+	if err := c.send(wsResponse{JSONRPC: "2.0", ID: id, Error: &wsError{Code: code, Message: message}}); err != nil {
+		logWarn(c.ctx, "WebSocket: failed to send error response: %v", err)
+	}
+}
+
+func (c *wsConn) wantsEvent(event FileEvent) bool {
+	c.filterMu.Lock()
+	defer c.filterMu.Unlock()
+
+	return c.subscribed && eventMatches(event, c.filter.Server, c.filter.SteamID, c.filter.Kind)
+}
+
+// Сервер из параметров вызова заменяет выбранный при подключении
+func (c *wsConn) serverContext(id json.RawMessage, name string) (context.Context, bool) {
+	if name == "" {
+		return c.ctx, true
+	}
+	srv, ok := lookupServer(name)
+	if !ok {
+		c.replyError(id, wsInvalidParams, "Unknown server: "+name)
+		return nil, false
+	}
+	return withServer(c.ctx, srv), true
+}
+
+func (c *wsConn) ensureOffline(ctx context.Context, id json.RawMessage, steamid string, force bool) bool {
+	if err := ensurePlayerOffline(ctx, steamid, force); err != nil {
+		c.replyError(id, wsPlayerOnline, err.Error())
+		return false
+	}
+	return true
+}
+
+func (c *wsConn) handle(req wsRequest) {
+	switch req.Method {
+	case "check", "player-file", "slot-file", "transfer", "restore-slot":
+		var params CheckRequest
+		if err := json.Unmarshal(req.Params, &params); err != nil || params.SteamID == "" {
+			c.replyError(req.ID, wsInvalidParams, "steamid is required")
+			return
+		}
+		for _, id := range []string{params.SteamID, params.SlotID, params.OldSlotID} {
+			if id != "" && !validID(id) {
+				c.replyError(req.ID, wsInvalidParams, "Invalid identifier: "+id)
+				return
+			}
+		}
+		ctx, ok := c.serverContext(req.ID, params.Server)
+		if !ok {
+			return
+		}
+
+		switch req.Method {
+		case "check":
+			c.reply(req.ID, checkPlayerFile(ctx, params.SteamID))
+
+		case "player-file":
+			c.reply(req.ID, getPlayerFileContent(ctx, params.SteamID))
+
+		case "slot-file":
+			if params.SlotID == "" {
+				c.replyError(req.ID, wsInvalidParams, "steamid and slot_id are required")
+				return
+			}
+			c.reply(req.ID, getSlotFileContent(ctx, params.SteamID, params.SlotID))
+
+		case "transfer":
+			if params.OldSlotID == "" {
+				c.replyError(req.ID, wsInvalidParams, "steamid and old_slot_id are required")
+				return
+			}
+			if !c.ensureOffline(ctx, req.ID, params.SteamID, params.Force) {
+				return
+			}
+			unlock := lockPlayer(ctx, params.SteamID)
+			audit := beginAuditAs(ctx, c.actor, "transfer", params.SteamID, params.OldSlotID, playerFilePath(ctx, params.SteamID), slotFilePath(ctx, params.SteamID, params.OldSlotID)).details("ws")
+			response := transferPlayerSlot(ctx, params.SteamID, params.OldSlotID)
+			audit.finish(response.Success, response.Error)
+			unlock()
+			c.reply(req.ID, response)
+
+		case "restore-slot":
+			if params.SlotID == "" {
+				c.replyError(req.ID, wsInvalidParams, "steamid and slot_id are required")
+				return
+			}
+			if !c.ensureOffline(ctx, req.ID, params.SteamID, params.Force) {
+				return
+			}
+			unlock := lockPlayer(ctx, params.SteamID)
+			audit := beginAuditAs(ctx, c.actor, "restore-slot", params.SteamID, params.SlotID, playerFilePath(ctx, params.SteamID), slotFilePath(ctx, params.SteamID, params.SlotID)).details("ws")
+			response := restoreSlotFromFile(ctx, params.SteamID, params.SlotID)
+			audit.finish(response.Success, response.Error)
+			unlock()
+			c.reply(req.ID, response)
+		}
+
+	case "write-slot":
+		var params WriteSlotRequest
+		if err := json.Unmarshal(req.Params, &params); err != nil || params.SteamID == "" || params.FileName == "" {
+			c.replyError(req.ID, wsInvalidParams, "steamid and file_name are required")
+			return
+		}
+		if !validID(params.SteamID) || !validID(params.FileName) {
+			c.replyError(req.ID, wsInvalidParams, "Invalid identifier")
+			return
+		}
+		ctx, ok := c.serverContext(req.ID, params.Server)
+		if !ok {
+			return
+		}
+		if !c.ensureOffline(ctx, req.ID, params.SteamID, params.Force) {
+			return
+		}
+		unlock := lockPlayer(ctx, params.SteamID)
+		slotID := strings.TrimSuffix(params.FileName, ".json")
+		audit := beginAuditAs(ctx, c.actor, "write-slot", params.SteamID, slotID, slotFilePath(ctx, params.SteamID, slotID)).details("ws")
+		response := writeSlotFile(ctx, params.SteamID, params.FileName, params.Data)
+		audit.finish(response.Success, response.Error)
+		unlock()
+		c.reply(req.ID, response)
+
+	case "subscribe":
+		var params wsSubscribeParams
+		if len(req.Params) > 0 {
+			if err := json.Unmarshal(req.Params, &params); err != nil {
+				c.replyError(req.ID, wsInvalidParams, "Invalid subscribe params")
+				return
+			}
+		}
+		if params.Server != "" {
+			if _, ok := lookupServer(params.Server); !ok {
+				c.replyError(req.ID, wsInvalidParams, "Unknown server: "+params.Server)
+				return
+			}
+		}
+		c.filterMu.Lock()
+		c.subscribed = true
+		c.filter = params
+		c.filterMu.Unlock()
+		c.reply(req.ID, map[string]interface{}{"success": true, "server": params.Server, "steamid": params.SteamID, "kind": params.Kind})
+
+	case "unsubscribe":
+		c.filterMu.Lock()
+		c.subscribed = false
+		c.filterMu.Unlock()
+		c.reply(req.ID, map[string]interface{}{"success": true})
+
+	default:
+		c.replyError(req.ID, wsMethodNotFound, "Method not found: "+req.Method)
+	}
+}
+
+func wsHandler(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade сам отвечает клиенту с ошибкой
+		logWarn(r.Context(), "WebSocket handler: upgrade failed for %s: %v", r.RemoteAddr, err)
+		return
+	}
+	defer conn.Close()
+
+	// По умолчанию клиент получает все события, фильтр меняется через subscribe
+	c := &wsConn{conn: conn, ctx: r.Context(), actor: requestActor(r), subscribed: true}
+	// Сервер, выбранный параметром при подключении, ограничивает и поток событий
+	c.filter.Server = r.URL.Query().Get("server")
+	logInfo(r.Context(), "WebSocket handler: client %s connected", r.RemoteAddr)
+
+	conn.SetReadLimit(wsMaxMessage)
+	conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	events, unsubscribe := watcher.Subscribe()
+	defer unsubscribe()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ping := time.NewTicker(wsPingInterval)
+		defer ping.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+
+			case <-shuttingDown:
+				c.writeMu.Lock()
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, "agent is shutting down"),
+					time.Now().Add(wsWriteTimeout))
+				c.writeMu.Unlock()
+				conn.Close()
+				return
+
+			case <-ping.C:
+				c.writeMu.Lock()
+				err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+				c.writeMu.Unlock()
+				if err != nil {
+					return
+				}
+
+			case event := <-events:
+				if !c.wantsEvent(event) {
+					continue
+				}
+				if err := c.send(wsNotification{JSONRPC: "2.0", Method: "event", Params: event}); err != nil {
+					logWarn(r.Context(), "WebSocket: failed to push event to %s: %v", r.RemoteAddr, err)
+					return
+				}
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				logWarn(r.Context(), "WebSocket handler: read error from %s: %v", r.RemoteAddr, err)
+			}
+			logInfo(r.Context(), "WebSocket handler: client %s disconnected", r.RemoteAddr)
+			return
+		}
+
+		var req wsRequest
+		if err := json.Unmarshal(message, &req); err != nil {
+			c.replyError(nil, wsParseError, "Invalid JSON")
+			continue
+		}
+		if req.Method == "" {
+			c.replyError(req.ID, wsInvalidRequest, "method is required")
+			continue
+		}
+
+		logInfo(r.Context(), "WebSocket handler: %s called %s", r.RemoteAddr, req.Method)
+
+		// Долгие операции не блокируют чтение следующих запросов
+		wg.Add(1)
+		wsRequests.Add(1)
+		go func() {
+			defer wg.Done()
+			defer wsRequests.Done()
+			c.handle(req)
+		}()
+	}
+}